@@ -0,0 +1,104 @@
+package auth
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+
+	"gopkg.in/yaml.v2"
+)
+
+// Client is the owner of the API key
+type Client struct {
+	Name string `yaml:"name"`
+	Key  string `yaml:"key"`
+	// Secret is an optional HMAC key. If it's set every request of the client has to be signed
+	Secret string `yaml:"secret"`
+	// Originators the client is allowed to send the messages from (any originator if empty)
+	Originators []string `yaml:"originators"`
+	// DailyQuota is the amount of message parts the client could send per day (not limited if zero)
+	DailyQuota int `yaml:"daily_quota"`
+	// Admin clients are allowed to use the service management endpoints
+	Admin bool `yaml:"admin"`
+}
+
+// AllowsOriginator checks if the client could send the messages from the originator
+func (c *Client) AllowsOriginator(o string) bool {
+	if len(c.Originators) == 0 {
+		return true
+	}
+
+	for _, i := range c.Originators {
+		if i == o {
+			return true
+		}
+	}
+
+	return false
+}
+
+// KeyStore keeps the clients by their API keys
+type KeyStore interface {
+	Get(key string) (*Client, bool)
+}
+
+type keyStore struct {
+	Clients map[string]*Client
+}
+
+// InitKeyStore is KeyStore factory method. Every client has to have unique name and API key
+func InitKeyStore(cs []*Client) (KeyStore, error) {
+	s := &keyStore{map[string]*Client{}}
+	names := map[string]bool{}
+
+	for i, c := range cs {
+		if c.Name == "" || c.Key == "" {
+			return nil, fmt.Errorf("client #%d: name and key must have a value", i+1)
+		}
+
+		if names[c.Name] {
+			return nil, fmt.Errorf("client %q: name is already used", c.Name)
+		}
+
+		if _, ok := s.Clients[c.Key]; ok {
+			return nil, fmt.Errorf("client %q: key is already used", c.Name)
+		}
+
+		if c.DailyQuota < 0 {
+			return nil, fmt.Errorf("client %q: daily quota should not be negative", c.Name)
+		}
+
+		names[c.Name] = true
+		s.Clients[c.Key] = c
+	}
+
+	return s, nil
+}
+
+// LoadKeyStore reads the clients from YAML or JSON file
+func LoadKeyStore(path string) (KeyStore, error) {
+	b, err := ioutil.ReadFile(path)
+
+	if err != nil {
+		return nil, err
+	}
+
+	var cs []*Client
+
+	if err := yaml.UnmarshalStrict(b, &cs); err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+
+	if len(cs) == 0 {
+		return nil, errors.New(path + ": no clients")
+	}
+
+	return InitKeyStore(cs)
+}
+
+// Get returns the client by API key
+func (s *keyStore) Get(key string) (*Client, bool) {
+	c, ok := s.Clients[key]
+
+	return c, ok
+}
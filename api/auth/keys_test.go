@@ -0,0 +1,65 @@
+package auth_test
+
+import (
+	"api/auth"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestClient_AllowsOriginator(t *testing.T) {
+	t.Run("any originator is allowed if none are listed", func(t *testing.T) {
+		assert.True(t, (&auth.Client{}).AllowsOriginator("Shop"))
+	})
+
+	t.Run("only listed originators are allowed", func(t *testing.T) {
+		c := &auth.Client{Originators: []string{"Shop"}}
+
+		assert.True(t, c.AllowsOriginator("Shop"))
+		assert.False(t, c.AllowsOriginator("Bank"))
+	})
+}
+
+func TestInitKeyStore(t *testing.T) {
+	cases := []struct {
+		name    string
+		clients []*auth.Client
+		err     string
+	}{
+		{"name is required", []*auth.Client{{Key: "k"}}, "client #1: name and key must have a value"},
+		{"key is required", []*auth.Client{{Name: "n"}}, "client #1: name and key must have a value"},
+		{"names are unique", []*auth.Client{{Name: "n", Key: "k1"}, {Name: "n", Key: "k2"}}, `client "n": name is already used`},
+		{"keys are unique", []*auth.Client{{Name: "n1", Key: "k"}, {Name: "n2", Key: "k"}}, `client "n2": key is already used`},
+		{"quota is not negative", []*auth.Client{{Name: "n", Key: "k", DailyQuota: -1}}, `client "n": daily quota should not be negative`},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			_, err := auth.InitKeyStore(c.clients)
+			assert.EqualError(t, err, c.err)
+		})
+	}
+}
+
+func TestLoadKeyStore(t *testing.T) {
+	t.Run("returns clients by their keys", func(t *testing.T) {
+		ks, err := auth.LoadKeyStore("testdata/keys.yaml")
+		assert.Nil(t, err)
+
+		c, ok := ks.Get("shop-key")
+		assert.True(t, ok)
+		assert.Equal(t, &auth.Client{Name: "shop", Key: "shop-key", Originators: []string{"Shop", "31612345678"}, DailyQuota: 1000}, c)
+
+		c, ok = ks.Get("bank-key")
+		assert.True(t, ok)
+		assert.Equal(t, "bank-secret", c.Secret)
+
+		_, ok = ks.Get("unknown")
+		assert.False(t, ok)
+	})
+
+	t.Run("returns error for missing file", func(t *testing.T) {
+		_, err := auth.LoadKeyStore("testdata/missing.yaml")
+		assert.NotNil(t, err)
+	})
+}
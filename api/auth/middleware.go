@@ -0,0 +1,109 @@
+package auth
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"time"
+	"utils"
+
+	"github.com/labstack/echo"
+)
+
+const (
+	// HeaderAPIKey is the header the API key is passed with
+	HeaderAPIKey = "X-API-Key"
+	// HeaderSignature is the header with the request signature (required for the clients with the secret)
+	HeaderSignature = "X-Signature"
+	// HeaderTimestamp is the header with the unix time the request was signed at
+	HeaderTimestamp = "X-Timestamp"
+)
+
+// clientKey is the key the authenticated client is kept within the request context
+const clientKey = "client"
+
+// signatureTolerance is how old (or how far in the future) the signed request could be
+const signatureTolerance = 5 * time.Minute
+
+// Signature returns base64 encoded HMAC-SHA256 of the timestamp and the request body separated by the new line
+func Signature(secret string, ts string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(ts + "\n"))
+	mac.Write(body)
+
+	return base64.StdEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// Authenticate only lets through the requests with the known API key. Requests of the clients with the secret
+// have to be signed as well. Authenticated client is kept within the request context
+func Authenticate(ks KeyStore, c utils.Clock) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(ctx echo.Context) error {
+			req := ctx.Request()
+			cl, ok := ks.Get(req.Header.Get(HeaderAPIKey))
+
+			if !ok {
+				return ctx.JSON(http.StatusUnauthorized, map[string]string{"api_key": "missing or unknown API key"})
+			}
+
+			if cl.Secret != "" {
+				body, err := ioutil.ReadAll(req.Body)
+
+				if err != nil {
+					return err
+				}
+
+				// let the handler read the body again
+				req.Body = ioutil.NopCloser(bytes.NewReader(body))
+
+				if !verify(cl.Secret, req.Header.Get(HeaderSignature), req.Header.Get(HeaderTimestamp), body, c.Now()) {
+					return ctx.JSON(http.StatusUnauthorized, map[string]string{"signature": "missing, invalid or expired request signature"})
+				}
+			}
+
+			ctx.Set(clientKey, cl)
+
+			return next(ctx)
+		}
+	}
+}
+
+func verify(secret string, sig string, ts string, body []byte, now time.Time) bool {
+	sec, err := strconv.ParseInt(ts, 10, 64)
+
+	if sig == "" || err != nil {
+		return false
+	}
+
+	d := now.Sub(time.Unix(sec, 0))
+
+	if d > signatureTolerance || d < -signatureTolerance {
+		return false
+	}
+
+	return hmac.Equal([]byte(sig), []byte(Signature(secret, ts, body)))
+}
+
+// RequireAdmin only lets through the requests of the admin clients. It has to follow Authenticate
+func RequireAdmin() echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(ctx echo.Context) error {
+			if cl, ok := ClientFrom(ctx); !ok || !cl.Admin {
+				return ctx.JSON(http.StatusForbidden, map[string]string{"api_key": "is not allowed to manage the service"})
+			}
+
+			return next(ctx)
+		}
+	}
+}
+
+// ClientFrom returns the client that was authenticated within the request
+func ClientFrom(ctx echo.Context) (*Client, bool) {
+	cl, ok := ctx.Get(clientKey).(*Client)
+
+	return cl, ok
+}
@@ -0,0 +1,115 @@
+package auth_test
+
+import (
+	"api/auth"
+	"bytes"
+	"mocks"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSignature(t *testing.T) {
+	t.Run("signs timestamp and body", func(t *testing.T) {
+		assert.Equal(t, "WP18p2bsJsB5adBCgwcPpri/aOXqPriuVk63omgN4Lc=", auth.Signature("secret", "1509876000", []byte(`{"message":"hi"}`)))
+	})
+}
+
+func TestAuthenticate(t *testing.T) {
+	now := time.Date(2017, 11, 5, 10, 0, 0, 0, time.UTC)
+	ts := strconv.FormatInt(now.Unix(), 10)
+	body := `{"message":"hi"}`
+
+	ks, _ := auth.InitKeyStore([]*auth.Client{
+		{Name: "shop", Key: "shop-key"},
+		{Name: "bank", Key: "bank-key", Secret: "secret"},
+		{Name: "ops", Key: "ops-key", Admin: true},
+	})
+
+	e := echo.New()
+	authenticate := auth.Authenticate(ks, mocks.NewClockMock(now))
+
+	// handler renders the name of the authenticated client and the body it has read
+	handler := func(c echo.Context) error {
+		cl, _ := auth.ClientFrom(c)
+		b := &bytes.Buffer{}
+		b.WriteString(cl.Name + ":")
+
+		buf := make([]byte, 100)
+		n, _ := c.Request().Body.Read(buf)
+		b.Write(buf[:n])
+
+		return c.String(http.StatusOK, b.String())
+	}
+
+	serve := func(h echo.HandlerFunc, headers map[string]string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(echo.POST, "/message", strings.NewReader(body))
+
+		for k, v := range headers {
+			req.Header.Set(k, v)
+		}
+
+		rec := httptest.NewRecorder()
+		_ = h(e.NewContext(req, rec))
+
+		return rec
+	}
+
+	t.Run("lets the request with known key through", func(t *testing.T) {
+		rec := serve(authenticate(handler), map[string]string{auth.HeaderAPIKey: "shop-key"})
+
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Equal(t, "shop:"+body, rec.Body.String())
+	})
+
+	t.Run("rejects the request with missing or unknown key", func(t *testing.T) {
+		for _, k := range []string{"", "unknown"} {
+			rec := serve(authenticate(handler), map[string]string{auth.HeaderAPIKey: k})
+
+			assert.Equal(t, http.StatusUnauthorized, rec.Code)
+			assert.JSONEq(t, `{"api_key": "missing or unknown API key"}`, rec.Body.String())
+		}
+	})
+
+	t.Run("lets the signed request through and keeps the body", func(t *testing.T) {
+		rec := serve(authenticate(handler), map[string]string{
+			auth.HeaderAPIKey:    "bank-key",
+			auth.HeaderTimestamp: ts,
+			auth.HeaderSignature: auth.Signature("secret", ts, []byte(body)),
+		})
+
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Equal(t, "bank:"+body, rec.Body.String())
+	})
+
+	t.Run("rejects not signed, wrongly signed or expired request", func(t *testing.T) {
+		expired := strconv.FormatInt(now.Add(-10*time.Minute).Unix(), 10)
+
+		for _, h := range []map[string]string{
+			{auth.HeaderAPIKey: "bank-key"},
+			{auth.HeaderAPIKey: "bank-key", auth.HeaderTimestamp: ts, auth.HeaderSignature: auth.Signature("wrong", ts, []byte(body))},
+			{auth.HeaderAPIKey: "bank-key", auth.HeaderTimestamp: expired, auth.HeaderSignature: auth.Signature("secret", expired, []byte(body))},
+		} {
+			rec := serve(authenticate(handler), h)
+
+			assert.Equal(t, http.StatusUnauthorized, rec.Code)
+			assert.JSONEq(t, `{"signature": "missing, invalid or expired request signature"}`, rec.Body.String())
+		}
+	})
+
+	t.Run("only admin clients are allowed to manage the service", func(t *testing.T) {
+		h := authenticate(auth.RequireAdmin()(handler))
+
+		assert.Equal(t, http.StatusOK, serve(h, map[string]string{auth.HeaderAPIKey: "ops-key"}).Code)
+
+		rec := serve(h, map[string]string{auth.HeaderAPIKey: "shop-key"})
+		assert.Equal(t, http.StatusForbidden, rec.Code)
+		assert.JSONEq(t, `{"api_key": "is not allowed to manage the service"}`, rec.Body.String())
+	})
+}
@@ -0,0 +1,80 @@
+package auth
+
+import (
+	"sync"
+	"utils"
+)
+
+// Quota counts the message parts sent by the clients per day (UTC)
+type Quota interface {
+	Take(c *Client, parts int) bool
+	Refund(c *Client, parts int)
+}
+
+type usage struct {
+	Day   string
+	Parts int
+}
+
+type quota struct {
+	Mutex *sync.Mutex
+	Clock utils.Clock
+	Usage map[string]*usage
+}
+
+// InitQuota is Quota factory method
+func InitQuota(c utils.Clock) Quota {
+	return &quota{&sync.Mutex{}, c, map[string]*usage{}}
+}
+
+// Take counts the parts against the daily quota of the client. Nothing is counted if the quota would be exceeded
+func (q *quota) Take(c *Client, parts int) bool {
+	if c.DailyQuota == 0 {
+		return true
+	}
+
+	q.Mutex.Lock()
+	defer q.Mutex.Unlock()
+
+	day := q.today()
+	u, ok := q.Usage[c.Name]
+
+	// usage starts from scratch every day
+	if !ok || u.Day != day {
+		u = &usage{day, 0}
+		q.Usage[c.Name] = u
+	}
+
+	if u.Parts+parts > c.DailyQuota {
+		return false
+	}
+
+	u.Parts += parts
+
+	return true
+}
+
+// Refund gives back the parts counted today, e.g. when the message wasn't queued after all
+func (q *quota) Refund(c *Client, parts int) {
+	if c.DailyQuota == 0 {
+		return
+	}
+
+	q.Mutex.Lock()
+	defer q.Mutex.Unlock()
+
+	u, ok := q.Usage[c.Name]
+
+	// parts counted on the previous day are not counted anymore anyway
+	if !ok || u.Day != q.today() {
+		return
+	}
+
+	if u.Parts -= parts; u.Parts < 0 {
+		u.Parts = 0
+	}
+}
+
+func (q *quota) today() string {
+	return q.Clock.Now().UTC().Format("2006-01-02")
+}
@@ -0,0 +1,65 @@
+package auth_test
+
+import (
+	"api/auth"
+	"mocks"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestQuota_Take(t *testing.T) {
+	c := mocks.NewClockMock(time.Date(2017, 11, 5, 23, 0, 0, 0, time.UTC))
+	q := auth.InitQuota(c)
+
+	limited := &auth.Client{Name: "limited", DailyQuota: 10}
+
+	t.Run("parts are counted till the quota is reached", func(t *testing.T) {
+		assert.True(t, q.Take(limited, 6))
+		assert.True(t, q.Take(limited, 4))
+		assert.False(t, q.Take(limited, 1))
+	})
+
+	t.Run("rejected parts are not counted", func(t *testing.T) {
+		other := &auth.Client{Name: "other", DailyQuota: 10}
+
+		assert.False(t, q.Take(other, 11))
+		assert.True(t, q.Take(other, 10))
+	})
+
+	t.Run("quota is renewed on the next day", func(t *testing.T) {
+		c.Advance(time.Hour)
+
+		assert.True(t, q.Take(limited, 10))
+	})
+
+	t.Run("not limited if quota is zero", func(t *testing.T) {
+		assert.True(t, q.Take(&auth.Client{Name: "unlimited"}, 1000000))
+	})
+}
+
+func TestQuota_Refund(t *testing.T) {
+	c := mocks.NewClockMock(time.Date(2017, 11, 5, 23, 0, 0, 0, time.UTC))
+	q := auth.InitQuota(c)
+
+	limited := &auth.Client{Name: "limited", DailyQuota: 10}
+
+	t.Run("refunded parts could be taken again", func(t *testing.T) {
+		assert.True(t, q.Take(limited, 10))
+		q.Refund(limited, 4)
+
+		assert.True(t, q.Take(limited, 4))
+		assert.False(t, q.Take(limited, 1))
+	})
+
+	t.Run("refund never makes more parts available than the quota", func(t *testing.T) {
+		c.Advance(time.Hour)
+		assert.True(t, q.Take(limited, 6))
+
+		q.Refund(limited, 20)
+
+		assert.True(t, q.Take(limited, 10))
+		assert.False(t, q.Take(limited, 1))
+	})
+}
@@ -0,0 +1,82 @@
+package controllers
+
+import (
+	"net/http"
+	"queue"
+	"utils"
+
+	"github.com/labstack/echo"
+)
+
+// AdminControllers interface consists all the service management endpoints handlers
+type AdminControllers interface {
+	HandleDeadLetters(c echo.Context) error
+	HandleReplayDeadLetter(c echo.Context) error
+	HandleOriginators(c echo.Context) error
+	HandleApproveOriginator(c echo.Context) error
+	HandleRevokeOriginator(c echo.Context) error
+}
+
+type acontroller struct {
+	Queue       queue.MessageQueue
+	Dead        queue.DeadLetterStore
+	Originators utils.OriginatorRegistry
+}
+
+// HandleDeadLetters controller renders all the messages that won't be sent anymore
+func (ac *acontroller) HandleDeadLetters(c echo.Context) error {
+	return c.JSON(http.StatusOK, ac.Dead.List())
+}
+
+// HandleReplayDeadLetter controller sends failed message back to the queue
+func (ac *acontroller) HandleReplayDeadLetter(c echo.Context) error {
+	if !ac.Queue.Replay(c.Param("id")) {
+		return echo.NewHTTPError(http.StatusNotFound, "dead letter not found")
+	}
+
+	return c.NoContent(http.StatusAccepted)
+}
+
+// HandleOriginators controller renders all the approved originators
+func (ac *acontroller) HandleOriginators(c echo.Context) error {
+	return c.JSON(http.StatusOK, ac.Originators.List())
+}
+
+// HandleApproveOriginator controller adds the originator to the registry or replaces the clients allowed to use it
+func (ac *acontroller) HandleApproveOriginator(c echo.Context) error {
+	a := &utils.ApprovedOriginator{}
+
+	if err := c.Bind(a); err != nil {
+		return err
+	}
+
+	if err := c.Validate(a); err != nil {
+		return c.JSON(http.StatusUnprocessableEntity, utils.HumaniseValidationErrors(err))
+	}
+
+	if err := ac.Originators.Approve(a); err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, a)
+}
+
+// HandleRevokeOriginator controller removes the originator from the registry
+func (ac *acontroller) HandleRevokeOriginator(c echo.Context) error {
+	ok, err := ac.Originators.Revoke(c.Param("originator"))
+
+	if err != nil {
+		return err
+	}
+
+	if !ok {
+		return echo.NewHTTPError(http.StatusNotFound, "originator not found")
+	}
+
+	return c.NoContent(http.StatusNoContent)
+}
+
+// InitAdminControllers creates the admin controller instance
+func InitAdminControllers(q queue.MessageQueue, dl queue.DeadLetterStore, reg utils.OriginatorRegistry) AdminControllers {
+	return &acontroller{q, dl, reg}
+}
@@ -0,0 +1,123 @@
+package controllers_test
+
+import (
+	"api/controllers"
+	apiModels "api/models"
+	"mocks"
+	"net/http"
+	"net/http/httptest"
+	"queue"
+	"queue/models"
+	"strings"
+	"testing"
+	"time"
+	"utils"
+
+	"github.com/labstack/echo"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestInitAdminControllers(t *testing.T) {
+	c := controllers.InitAdminControllers(&mocks.MessageQueue{}, queue.InitDeadLetterStore(utils.InitClock()), nil)
+
+	t.Run("initialize admin controller", func(t *testing.T) {
+		assert.NotNil(t, c)
+	})
+}
+
+func TestAcontroller_HandleDeadLetters(t *testing.T) {
+	dl := queue.InitDeadLetterStore(utils.InitClock())
+	c := controllers.InitAdminControllers(&mocks.MessageQueue{}, dl, nil)
+
+	t.Run("renders all dead letters", func(t *testing.T) {
+		dl.Add("reason", models.InitQueueMessage("body", utils.Plain, apiModels.InitMessage(), "", 1))
+
+		cm := new(mocks.EchoContextMock)
+		cm.On("JSON", http.StatusOK, dl.List()).Return(nil)
+
+		assert.Nil(t, c.HandleDeadLetters(cm))
+		cm.AssertCalled(t, "JSON", http.StatusOK, dl.List())
+	})
+}
+
+func TestAcontroller_HandleReplayDeadLetter(t *testing.T) {
+	qMock := &mocks.MessageQueue{}
+	c := controllers.InitAdminControllers(qMock, queue.InitDeadLetterStore(utils.InitClock()), nil)
+
+	qMock.On("Replay", "unknown").Return(false)
+	qMock.On("Replay", "id").Return(true)
+
+	t.Run("returns not found error for unknown dead letter", func(t *testing.T) {
+		cm := new(mocks.EchoContextMock)
+		cm.On("Param", "id").Return("unknown")
+
+		err := c.HandleReplayDeadLetter(cm)
+		assert.Equal(t, http.StatusNotFound, err.(*echo.HTTPError).Code)
+	})
+
+	t.Run("replays dead letter", func(t *testing.T) {
+		cm := new(mocks.EchoContextMock)
+		cm.On("Param", "id").Return("id")
+		cm.On("NoContent", http.StatusAccepted).Return(nil)
+
+		assert.Nil(t, c.HandleReplayDeadLetter(cm))
+		qMock.AssertCalled(t, "Replay", "id")
+	})
+}
+
+func TestAcontroller_Originators(t *testing.T) {
+	reg, _ := utils.InitOriginatorRegistry("")
+	c := controllers.InitAdminControllers(&mocks.MessageQueue{}, queue.InitDeadLetterStore(utils.InitClock()), reg)
+
+	e := echo.New()
+	e.Validator = utils.InitValidator(utils.InitEncoder(9, utils.Reference8Bit), time.Hour, reg, 50, utils.InitClock())
+
+	serve := func(h echo.HandlerFunc, method string, body string, originator string) (*httptest.ResponseRecorder, error) {
+		req := httptest.NewRequest(method, "/admin/originators", strings.NewReader(body))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		rec := httptest.NewRecorder()
+
+		ctx := e.NewContext(req, rec)
+		ctx.SetParamNames("originator")
+		ctx.SetParamValues(originator)
+
+		return rec, h(ctx)
+	}
+
+	t.Run("approves originator", func(t *testing.T) {
+		rec, err := serve(c.HandleApproveOriginator, echo.POST, `{"originator": "Shop", "clients": ["shop"]}`, "")
+
+		assert.Nil(t, err)
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.True(t, reg.IsApproved("Shop", "shop"))
+	})
+
+	t.Run("rejects invalid originator", func(t *testing.T) {
+		rec, err := serve(c.HandleApproveOriginator, echo.POST, `{"originator": "Too long originator"}`, "")
+
+		assert.Nil(t, err)
+		assert.Equal(t, http.StatusUnprocessableEntity, rec.Code)
+		assert.JSONEq(t, `{"originator": "use valid MSISDN or alphanumeric value (max. 11 symbols long)"}`, rec.Body.String())
+	})
+
+	t.Run("renders approved originators", func(t *testing.T) {
+		rec, err := serve(c.HandleOriginators, echo.GET, "", "")
+
+		assert.Nil(t, err)
+		assert.JSONEq(t, `[{"originator": "Shop", "clients": ["shop"]}]`, rec.Body.String())
+	})
+
+	t.Run("revokes originator", func(t *testing.T) {
+		rec, err := serve(c.HandleRevokeOriginator, echo.DELETE, "", "Shop")
+
+		assert.Nil(t, err)
+		assert.Equal(t, http.StatusNoContent, rec.Code)
+		assert.False(t, reg.IsApproved("Shop", "shop"))
+	})
+
+	t.Run("returns not found error for unknown originator", func(t *testing.T) {
+		_, err := serve(c.HandleRevokeOriginator, echo.DELETE, "", "Shop")
+
+		assert.Equal(t, http.StatusNotFound, err.(*echo.HTTPError).Code)
+	})
+}
@@ -1,8 +1,15 @@
 package controllers
 
 import (
+	"api/auth"
 	"api/models"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
 	"hash/fnv"
+	"io/ioutil"
 	"net/http"
 	"queue"
 	qModels "queue/models"
@@ -11,19 +18,163 @@ import (
 	"github.com/labstack/echo"
 )
 
+// HeaderIdempotencyKey is the header of the message request that makes its retries return the original response
+const HeaderIdempotencyKey = "Idempotency-Key"
+
+// HeaderIdempotentReplayed is the response header that marks the original response returned for the retried request
+const HeaderIdempotentReplayed = "Idempotent-Replayed"
+
 // MessageControllers interface consists all the message endpoints handlers
 type MessageControllers interface {
 	HandleMessage(c echo.Context) error
-	SendMessageToQueue(m models.Message)
+	HandleStatus(c echo.Context) error
+	HandlePreview(c echo.Context) error
+	SendMessageToQueue(m models.Message, mes *utils.Encoded)
 }
 
 type mcontroller struct {
-	Queue queue.MessageQueue
-	Udh   utils.UDHEncoder
+	Queue       queue.MessageQueue
+	Udh         utils.UDHEncoder
+	Refs        utils.ReferenceAllocator
+	Tracker     queue.StatusTracker
+	Metrics     utils.Metrics
+	Logger      utils.Logger
+	Quota       auth.Quota
+	Idempotency utils.IdempotencyStore
 }
 
 // HandleMessage controller
 func (mc *mcontroller) HandleMessage(c echo.Context) error {
+	key, hash, err := idempotencyKey(c)
+
+	if err != nil {
+		return err
+	}
+
+	m, cl, err := mc.bindMessage(c, mc.Metrics.RequestRejected)
+
+	// response is already rendered
+	if m == nil {
+		return err
+	}
+
+	authenticated := cl != nil
+
+	// retried request gets the original response and nothing is queued again
+	if key != "" {
+		if r, ok := mc.Idempotency.Get(key); ok {
+			return mc.replay(c, r, hash)
+		}
+	}
+
+	// split the message
+	mes := mc.Udh.SplitTextMessage(m.GetBody(), m.GetMaxParts(), mc.Refs.Reference(m.GetRecipients()))
+
+	// every part is sent to every recipient
+	parts := len(mes.Messages) * len(m.GetRecipients())
+
+	if authenticated && !mc.Quota.Take(cl, parts) {
+		mc.Metrics.RequestRejected("quota")
+		t := fmt.Sprintf("daily quota of %d parts is exceeded", cl.DailyQuota)
+		return c.JSON(http.StatusTooManyRequests, map[string]string{"quota": t})
+	}
+
+	// identifier is always generated by us, even if it was submitted
+	m.SetID(utils.GenerateID())
+	m.SetRequestID(c.Response().Header().Get(echo.HeaderXRequestID))
+
+	if key != "" {
+		r, err := mc.keep(key, hash, m)
+
+		// the same request was accepted meanwhile, so nothing is counted for this one
+		if err == nil && r.MessageID != m.GetID() {
+			if authenticated {
+				mc.Quota.Refund(cl, parts)
+			}
+
+			return mc.replay(c, r, hash)
+		}
+
+		if err != nil {
+			mc.Logger.Error("unable to keep idempotency key", utils.Fields{"request_id": m.GetRequestID(), "error": err})
+		}
+	}
+
+	mc.Metrics.RequestAccepted()
+	mc.Tracker.Accept(m.GetID(), m.GetClient())
+
+	// message is persisted by the queue before it's accepted, so it's not lost on the shutdown
+	mc.SendMessageToQueue(m, mes)
+
+	return c.JSON(http.StatusOK, m)
+}
+
+// idempotencyKey returns the idempotency key of the request scoped by the client (empty if it wasn't provided)
+// together with the hash of the request body
+func idempotencyKey(c echo.Context) (string, string, error) {
+	req := c.Request()
+	k := req.Header.Get(HeaderIdempotencyKey)
+
+	if k == "" {
+		return "", "", nil
+	}
+
+	if cl, ok := auth.ClientFrom(c); ok {
+		k = cl.Name + "\x00" + k
+	}
+
+	b, err := ioutil.ReadAll(req.Body)
+
+	if err != nil {
+		return "", "", err
+	}
+
+	// let the message be bound from the body
+	req.Body = ioutil.NopCloser(bytes.NewReader(b))
+	h := sha256.Sum256(b)
+
+	return k, hex.EncodeToString(h[:]), nil
+}
+
+// keep stores the response of the accepted message by the idempotency key. The response of the message accepted
+// earlier with the same key is returned if there is one
+func (mc *mcontroller) keep(key string, hash string, m models.Message) (*utils.IdempotentResponse, error) {
+	b, err := json.Marshal(m)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return mc.Idempotency.Add(&utils.IdempotentResponse{Key: key, RequestHash: hash, Status: http.StatusOK, Body: b, MessageID: m.GetID()})
+}
+
+// replay renders the original response of the request with the same idempotency key. The key can't be reused for
+// the request with a different body
+func (mc *mcontroller) replay(c echo.Context, r *utils.IdempotentResponse, hash string) error {
+	// responses kept before the body was hashed are returned for any body
+	if r.RequestHash != "" && r.RequestHash != hash {
+		mc.Metrics.RequestRejected("idempotency_key")
+		return c.JSON(http.StatusUnprocessableEntity, map[string]string{"idempotency_key": "is already used for the request with a different body"})
+	}
+
+	c.Response().Header().Set(HeaderIdempotentReplayed, "true")
+	return c.JSONBlob(r.Status, r.Body)
+}
+
+// HandlePreview controller renders how the message would be encoded and split. Nothing is queued or counted
+func (mc *mcontroller) HandlePreview(c echo.Context) error {
+	m, _, err := mc.bindMessage(c, func(...string) {})
+
+	if m == nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, mc.Udh.Preview(m.GetBody(), m.GetMaxParts(), mc.Refs.Reference(m.GetRecipients())))
+}
+
+// bindMessage binds and validates the submitted message. If message is rejected, the response is rendered, rejection is
+// reported with the tags and nil message is returned. Client is nil if request wasn't authenticated
+func (mc *mcontroller) bindMessage(c echo.Context, reject func(tags ...string)) (models.Message, *auth.Client, error) {
 	var err error
 
 	// create new message instance
@@ -31,47 +182,87 @@ func (mc *mcontroller) HandleMessage(c echo.Context) error {
 
 	// bind request data into message
 	if err = c.Bind(m); err != nil {
-		return err
+		reject("malformed")
+		return nil, nil, err
+	}
+
+	cl, authenticated := auth.ClientFrom(c)
+
+	// originators could be bound to the client
+	if authenticated {
+		m.SetClient(cl.Name)
 	}
 
 	// validate data
 	if err = c.Validate(m); err != nil {
+		reject(utils.ValidationErrorTags(err)...)
 		t := utils.HumaniseValidationErrors(err)
-		return c.JSON(http.StatusUnprocessableEntity, t)
+		return nil, nil, c.JSON(http.StatusUnprocessableEntity, t)
 	}
 
-	// send message to the subroutine for processing
-	go mc.SendMessageToQueue(m)
+	if authenticated && !cl.AllowsOriginator(m.GetOriginator()) {
+		reject("forbidden")
+		return nil, nil, c.JSON(http.StatusForbidden, map[string]string{"originator": "is not allowed for the API key"})
+	}
 
-	return c.JSON(http.StatusOK, m)
+	return m, cl, nil
 }
 
-// SendMessageToQueue splits the submitted message, generated UHD and pushes it to the queue. In fact is not a controller method but rather a helper function
-func (mc *mcontroller) SendMessageToQueue(m models.Message) {
-	body := m.GetBody()
+// HandleStatus controller renders the states of all the parts of the submitted message. Message of another client
+// is not found
+func (mc *mcontroller) HandleStatus(c echo.Context) error {
+	var client string
 
-	// split the message
-	mes := mc.Udh.SplitTextMessage(body)
+	if cl, ok := auth.ClientFrom(c); ok {
+		client = cl.Name
+	}
+
+	s, ok := mc.Tracker.Get(c.Param("id"))
+
+	if !ok || s.Client != client {
+		return echo.NewHTTPError(http.StatusNotFound, "message not found")
+	}
 
+	return c.JSON(http.StatusOK, s)
+}
+
+// SendMessageToQueue generates UHD for the parts of the split message and pushes them to the queue together. In fact is not a controller method but rather a helper function
+func (mc *mcontroller) SendMessageToQueue(m models.Message, mes *utils.Encoded) {
+	body := m.GetBody()
 	parts := len(mes.Messages)
 
+	mc.Tracker.Track(m.GetID(), parts)
+	mc.Metrics.PartsSplit(mes.Encoding, parts)
+
+	mc.Logger.Info("message split", utils.Fields{
+		"request_id": m.GetRequestID(),
+		"message_id": m.GetID(),
+		"encoding":   mes.Encoding,
+		"parts":      parts,
+	})
+
 	var udh string
+	var reference uint16
 
-	// unique hash based on message body
-	hash := mc.generateMessageHash(body)
+	if parts > 1 {
+		// all the parts share the reference number that is free for every recipient
+		reference = mc.Refs.Allocate(m.GetRecipients(), mc.generateMessageHash(body), mes.Reference)
+	}
+
+	qms := make([]qModels.QueueMessage, 0, parts)
 
 	for p, encoded := range mes.Messages {
 		if parts > 1 {
 			// generates udh for provided message part if needed
-			udh = mc.Udh.GenerateUDH(uint8(p+1), uint8(parts), hash)
+			udh = mc.Udh.GenerateUDH(uint8(p+1), uint8(parts), reference, mes.Reference)
 		}
 
 		// create QueueMessage instance based on the message part
-		qm := qModels.InitQueueMessage(encoded, mes.Encoding, m, udh)
-
-		// push it to the queue
-		mc.Queue.Push(qm)
+		qms = append(qms, qModels.InitQueueMessage(encoded, mes.Encoding, m, udh, p+1))
 	}
+
+	// all the parts are pushed at once, so the queue sends them together
+	mc.Queue.Push(qms...)
 }
 
 func (mc *mcontroller) generateMessageHash(s ...string) uint32 {
@@ -84,7 +275,8 @@ func (mc *mcontroller) generateMessageHash(s ...string) uint32 {
 	return h.Sum32()
 }
 
-// InitMessageControllers creates the message controller instance
-func InitMessageControllers(q queue.MessageQueue, udh utils.UDHEncoder) MessageControllers {
-	return &mcontroller{q, udh}
+// InitMessageControllers creates the message controller instance. Responses of the requests with the idempotency
+// key are kept in the provided store
+func InitMessageControllers(q queue.MessageQueue, udh utils.UDHEncoder, refs utils.ReferenceAllocator, st queue.StatusTracker, mt utils.Metrics, lg utils.Logger, qt auth.Quota, is utils.IdempotencyStore) MessageControllers {
+	return &mcontroller{q, udh, refs, st, mt, lg, qt, is}
 }
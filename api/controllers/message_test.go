@@ -1,31 +1,42 @@
 package controllers_test
 
 import (
+	"api/auth"
 	"api/controllers"
 	"testing"
 
 	"errors"
+	"io/ioutil"
 
 	"mocks"
 
 	"net/http"
+	"net/http/httptest"
+	"reflect"
 
 	"utils"
 
 	"time"
 
 	apiModels "api/models"
+	"queue"
 	"queue/models"
 
 	"github.com/go-playground/validator"
+	"github.com/labstack/echo"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
 )
 
+// logger drops all the entries
+func logger() utils.Logger {
+	return utils.InitLogger(ioutil.Discard, utils.InitClock(), utils.ErrorLevel)
+}
+
 func TestInitMessageControllers(t *testing.T) {
 	qMock := &mocks.MessageQueue{}
 	udhMock := &mocks.UDHEncoderMock{}
-	c := controllers.InitMessageControllers(qMock, udhMock)
+	c := controllers.InitMessageControllers(qMock, udhMock, utils.InitReferenceAllocator(utils.Reference8Bit, time.Hour, utils.InitClock()), queue.InitStatusTracker(time.Hour, utils.InitClock()), utils.InitMetrics(), logger(), auth.InitQuota(utils.InitClock()), utils.InitIdempotencyStore(time.Hour, utils.InitClock()))
 
 	t.Run("initialize message controller", func(t *testing.T) {
 		assert.NotNil(t, c)
@@ -35,11 +46,13 @@ func TestInitMessageControllers(t *testing.T) {
 func TestMcontroller_HandleMessage(t *testing.T) {
 	qMock := &mocks.MessageQueue{}
 	udhMock := &mocks.UDHEncoderMock{}
-	c := controllers.InitMessageControllers(qMock, udhMock)
+	mt := utils.InitMetrics()
+	c := controllers.InitMessageControllers(qMock, udhMock, utils.InitReferenceAllocator(utils.Reference8Bit, time.Hour, utils.InitClock()), queue.InitStatusTracker(time.Hour, utils.InitClock()), mt, logger(), auth.InitQuota(utils.InitClock()), utils.InitIdempotencyStore(time.Hour, utils.InitClock()))
 
 	t.Run("returns error if didn't manage to bind the request", func(t *testing.T) {
 		cm := new(mocks.EchoContextMock)
 		e := errors.New("Couldn't bind")
+		cm.On("Request").Return(httptest.NewRequest(echo.POST, "/message", nil))
 		cm.On("Bind", mock.Anything).Return(e)
 
 		err := c.HandleMessage(cm)
@@ -51,29 +64,55 @@ func TestMcontroller_HandleMessage(t *testing.T) {
 
 		et := &mocks.FieldErrorMock{}
 		et.On("Field").Return("test")
+		et.On("Tag").Return("required")
 		et.On("Error").Return("test")
 		et.On("Translate", mock.Anything).Return("Test")
 		e := validator.ValidationErrors{et}
 
 		err := map[string]string{"test": "Test"}
 
+		cm.On("Request").Return(httptest.NewRequest(echo.POST, "/message", nil))
 		cm.On("Bind", mock.Anything).Return(nil)
+		cm.On("Get", "client").Return(nil)
 		cm.On("Validate", mock.Anything).Return(e)
 		cm.On("JSON", http.StatusUnprocessableEntity, err).Return(nil)
 
 		returnedError := c.HandleMessage(cm)
 		assert.Nil(t, returnedError)
 		cm.AssertCalled(t, "JSON", http.StatusUnprocessableEntity, err)
+
+		rec := httptest.NewRecorder()
+		mt.Handler().ServeHTTP(rec, httptest.NewRequest(echo.GET, "/metrics", nil))
+
+		assert.Contains(t, rec.Body.String(), `birdfeeder_requests_total{result="rejected"} 2`)
+		assert.Contains(t, rec.Body.String(), `birdfeeder_validation_errors_total{tag="malformed"} 1`)
+		assert.Contains(t, rec.Body.String(), `birdfeeder_validation_errors_total{tag="required"} 1`)
 	})
 
 	t.Run("sends message to queue and renders passed message object", func(t *testing.T) {
+		qMock := &mocks.MessageQueue{}
+		udhMock := &mocks.UDHEncoderMock{}
+		st := queue.InitStatusTracker(time.Hour, utils.InitClock())
+		c := controllers.InitMessageControllers(qMock, udhMock, utils.InitReferenceAllocator(utils.Reference8Bit, time.Hour, utils.InitClock()), st, utils.InitMetrics(), logger(), auth.InitQuota(utils.InitClock()), utils.InitIdempotencyStore(time.Hour, utils.InitClock()))
+
+		res := echo.NewResponse(httptest.NewRecorder(), echo.New())
+		res.Header().Set(echo.HeaderXRequestID, "rid")
+
 		cm := new(mocks.EchoContextMock)
 		cm.On("Bind", mock.Anything).Return(nil)
 		cm.On("Validate", mock.Anything).Return(nil)
+		cm.On("Request").Return(httptest.NewRequest(echo.POST, "/message", nil))
+		cm.On("Response").Return(res)
+		cm.On("Get", "client").Return(nil)
+
+		var id string
 
-		chanWait := make(chan time.Time)
+		cm.On("JSON", http.StatusOK, mock.Anything).Return(nil).Run(func(args mock.Arguments) {
+			id = args.Get(1).(apiModels.Message).GetID()
 
-		cm.On("JSON", http.StatusOK, mock.Anything).Return(nil).WaitFor = chanWait
+			// message is responded only after it's in the queue
+			qMock.AssertNumberOfCalls(t, "Push", 1)
+		})
 
 		mes := []string{"a", "b"}
 		enc := &utils.Encoded{
@@ -81,25 +120,204 @@ func TestMcontroller_HandleMessage(t *testing.T) {
 			Messages: mes,
 		}
 
-		udhMock.On("SplitTextMessage", mock.Anything).Return(enc)
-		udhMock.On("GenerateUDH", mock.Anything, mock.Anything, mock.Anything).Return("")
+		udhMock.On("SplitTextMessage", mock.Anything, 0, utils.Reference8Bit).Return(enc)
+		udhMock.On("GenerateUDH", mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return("")
 
-		qMock.On("Push", mock.Anything).Return(nil).RunFn = func(arguments mock.Arguments) {
-			m := arguments.Get(0).(models.QueueMessage)
+		qMock.On("Push", mock.Anything, mock.Anything).Return(nil)
 
-			if m.GetMessage() == mes[len(mes)-1] {
-				chanWait <- time.Now()
-			}
-		}
+		returnedError := c.HandleMessage(cm)
+		assert.Nil(t, returnedError)
 
 		om := apiModels.InitMessage()
-		m1 := models.InitQueueMessage("a", "plain", om, "")
-		m2 := models.InitQueueMessage("b", "plain", om, "")
+		om.SetID(id)
+		om.SetRequestID("rid")
+		m1 := models.InitQueueMessage("a", "plain", om, "", 1)
+		m2 := models.InitQueueMessage("b", "plain", om, "", 2)
 
-		returnedError := c.HandleMessage(cm)
-		assert.Nil(t, returnedError)
-		qMock.AssertCalled(t, "Push", m1)
-		qMock.AssertCalled(t, "Push", m2)
-		qMock.AssertNumberOfCalls(t, "Push", 2)
+		// parts are pushed together in order
+		qMock.AssertCalled(t, "Push", m1, m2)
+		qMock.AssertNumberOfCalls(t, "Push", 1)
+
+		t.Run("generated message id is tracked", func(t *testing.T) {
+			assert.NotEmpty(t, id)
+
+			s, ok := st.Get(id)
+			assert.True(t, ok)
+			assert.Len(t, s.Parts, 2)
+		})
+	})
+
+	t.Run("authenticated client", func(t *testing.T) {
+		// initContext binds the message of the request from the originator to two recipients
+		initContext := func(cl *auth.Client, req *http.Request) *mocks.EchoContextMock {
+			cm := new(mocks.EchoContextMock)
+			cm.On("Bind", mock.Anything).Return(nil).Run(func(args mock.Arguments) {
+				m := reflect.ValueOf(args.Get(0)).Elem()
+				m.FieldByName("Originator").SetString("Shop")
+				m.FieldByName("Recipients").Set(reflect.ValueOf([]int64{31612345678, 31612345679}))
+			})
+			cm.On("Validate", mock.Anything).Return(nil)
+			cm.On("Request").Return(req)
+			cm.On("Get", "client").Return(cl)
+			cm.On("JSON", mock.Anything, mock.Anything).Return(nil)
+
+			return cm
+		}
+
+		udhMock := &mocks.UDHEncoderMock{}
+		udhMock.On("SplitTextMessage", mock.Anything, 0, utils.Reference8Bit).Return(&utils.Encoded{Encoding: utils.Plain, Messages: []string{"a", "b"}})
+
+		t.Run("is not allowed to send from the originator that isn't listed", func(t *testing.T) {
+			qMock := &mocks.MessageQueue{}
+			c := controllers.InitMessageControllers(qMock, udhMock, utils.InitReferenceAllocator(utils.Reference8Bit, time.Hour, utils.InitClock()), queue.InitStatusTracker(time.Hour, utils.InitClock()), utils.InitMetrics(), logger(), auth.InitQuota(utils.InitClock()), utils.InitIdempotencyStore(time.Hour, utils.InitClock()))
+			cm := initContext(&auth.Client{Name: "bank", Originators: []string{"Bank"}}, httptest.NewRequest(echo.POST, "/message", nil))
+
+			assert.Nil(t, c.HandleMessage(cm))
+			cm.AssertCalled(t, "JSON", http.StatusForbidden, map[string]string{"originator": "is not allowed for the API key"})
+			qMock.AssertNotCalled(t, "Push", mock.Anything)
+		})
+
+		t.Run("is not allowed to exceed daily quota of parts sent to every recipient", func(t *testing.T) {
+			qMock := &mocks.MessageQueue{}
+			c := controllers.InitMessageControllers(qMock, udhMock, utils.InitReferenceAllocator(utils.Reference8Bit, time.Hour, utils.InitClock()), queue.InitStatusTracker(time.Hour, utils.InitClock()), utils.InitMetrics(), logger(), auth.InitQuota(utils.InitClock()), utils.InitIdempotencyStore(time.Hour, utils.InitClock()))
+			cm := initContext(&auth.Client{Name: "shop", DailyQuota: 3}, httptest.NewRequest(echo.POST, "/message", nil))
+
+			assert.Nil(t, c.HandleMessage(cm))
+			cm.AssertCalled(t, "JSON", http.StatusTooManyRequests, map[string]string{"quota": "daily quota of 3 parts is exceeded"})
+			qMock.AssertNotCalled(t, "Push", mock.Anything)
+		})
+
+		t.Run("is not counted for the request with the idempotency key accepted meanwhile", func(t *testing.T) {
+			qMock := &mocks.MessageQueue{}
+			qt := auth.InitQuota(utils.InitClock())
+			c := controllers.InitMessageControllers(qMock, udhMock, utils.InitReferenceAllocator(utils.Reference8Bit, time.Hour, utils.InitClock()), queue.InitStatusTracker(time.Hour, utils.InitClock()), utils.InitMetrics(), logger(), qt, &acceptedMeanwhile{})
+			cl := &auth.Client{Name: "shop", DailyQuota: 4}
+
+			req := httptest.NewRequest(echo.POST, "/message", nil)
+			req.Header.Set(controllers.HeaderIdempotencyKey, "key")
+
+			cm := initContext(cl, req)
+			cm.On("Response").Return(echo.NewResponse(httptest.NewRecorder(), echo.New()))
+			cm.On("JSONBlob", http.StatusOK, []byte(`{"id":"other"}`)).Return(nil)
+
+			assert.Nil(t, c.HandleMessage(cm))
+			cm.AssertCalled(t, "JSONBlob", http.StatusOK, []byte(`{"id":"other"}`))
+			qMock.AssertNotCalled(t, "Push", mock.Anything)
+
+			// all the 2 parts for 2 recipients are still available
+			assert.True(t, qt.Take(cl, 4))
+		})
+	})
+}
+
+func TestMcontroller_HandleStatus(t *testing.T) {
+	qMock := &mocks.MessageQueue{}
+	udhMock := &mocks.UDHEncoderMock{}
+	st := queue.InitStatusTracker(time.Hour, utils.InitClock())
+	c := controllers.InitMessageControllers(qMock, udhMock, utils.InitReferenceAllocator(utils.Reference8Bit, time.Hour, utils.InitClock()), st, utils.InitMetrics(), logger(), auth.InitQuota(utils.InitClock()), utils.InitIdempotencyStore(time.Hour, utils.InitClock()))
+
+	t.Run("returns not found error for unknown message", func(t *testing.T) {
+		cm := new(mocks.EchoContextMock)
+		cm.On("Get", "client").Return(nil)
+		cm.On("Param", "id").Return("unknown")
+
+		err := c.HandleStatus(cm)
+		assert.Equal(t, http.StatusNotFound, err.(*echo.HTTPError).Code)
+	})
+
+	t.Run("renders status of the tracked message", func(t *testing.T) {
+		st.Accept("id", "")
+		st.Track("id", 1)
+		st.SetState(models.PartRef{MessageID: "id", Part: 1}, nil, models.Sent)
+
+		expected, _ := st.Get("id")
+
+		cm := new(mocks.EchoContextMock)
+		cm.On("Get", "client").Return(nil)
+		cm.On("Param", "id").Return("id")
+		cm.On("JSON", http.StatusOK, expected).Return(nil)
+
+		assert.Nil(t, c.HandleStatus(cm))
+		cm.AssertCalled(t, "JSON", http.StatusOK, expected)
+	})
+
+	t.Run("renders status of the message to the client that submitted it only", func(t *testing.T) {
+		st.Accept("shop-id", "shop")
+		st.Track("shop-id", 1)
+
+		expected, _ := st.Get("shop-id")
+
+		cm := new(mocks.EchoContextMock)
+		cm.On("Get", "client").Return(&auth.Client{Name: "shop"})
+		cm.On("Param", "id").Return("shop-id")
+		cm.On("JSON", http.StatusOK, expected).Return(nil)
+
+		assert.Nil(t, c.HandleStatus(cm))
+		cm.AssertCalled(t, "JSON", http.StatusOK, expected)
+
+		cm = new(mocks.EchoContextMock)
+		cm.On("Get", "client").Return(&auth.Client{Name: "bank"})
+		cm.On("Param", "id").Return("shop-id")
+
+		err := c.HandleStatus(cm)
+		assert.Equal(t, http.StatusNotFound, err.(*echo.HTTPError).Code)
+		cm.AssertNotCalled(t, "JSON", mock.Anything, mock.Anything)
+	})
+}
+
+func TestMcontroller_HandlePreview(t *testing.T) {
+	qMock := &mocks.MessageQueue{}
+	udhMock := &mocks.UDHEncoderMock{}
+	mt := utils.InitMetrics()
+	c := controllers.InitMessageControllers(qMock, udhMock, utils.InitReferenceAllocator(utils.Reference8Bit, time.Hour, utils.InitClock()), queue.InitStatusTracker(time.Hour, utils.InitClock()), mt, logger(), auth.InitQuota(utils.InitClock()), utils.InitIdempotencyStore(time.Hour, utils.InitClock()))
+
+	t.Run("renders preview of the message without queueing it", func(t *testing.T) {
+		p := &utils.Preview{Encoding: utils.Plain, Parts: 1, Messages: []*utils.PreviewPart{{Text: "hi", Hex: "6869"}}, Remaining: 158}
+		udhMock.On("Preview", "hi", 0, utils.Reference8Bit).Return(p)
+
+		cm := new(mocks.EchoContextMock)
+		cm.On("Bind", mock.Anything).Return(nil).Run(func(args mock.Arguments) {
+			reflect.ValueOf(args.Get(0)).Elem().FieldByName("Body").SetString("hi")
+		})
+		cm.On("Get", "client").Return(nil)
+		cm.On("Validate", mock.Anything).Return(nil)
+		cm.On("JSON", http.StatusOK, p).Return(nil)
+
+		assert.Nil(t, c.HandlePreview(cm))
+		cm.AssertCalled(t, "JSON", http.StatusOK, p)
+		qMock.AssertNotCalled(t, "Push", mock.Anything)
 	})
+
+	t.Run("renders validation errors without counting the rejection", func(t *testing.T) {
+		et := &mocks.FieldErrorMock{}
+		et.On("Field").Return("test")
+		et.On("Tag").Return("required")
+		et.On("Error").Return("test")
+		et.On("Translate", mock.Anything).Return("Test")
+
+		cm := new(mocks.EchoContextMock)
+		cm.On("Bind", mock.Anything).Return(nil)
+		cm.On("Get", "client").Return(nil)
+		cm.On("Validate", mock.Anything).Return(validator.ValidationErrors{et})
+		cm.On("JSON", http.StatusUnprocessableEntity, map[string]string{"test": "Test"}).Return(nil)
+
+		assert.Nil(t, c.HandlePreview(cm))
+		cm.AssertCalled(t, "JSON", http.StatusUnprocessableEntity, map[string]string{"test": "Test"})
+
+		rec := httptest.NewRecorder()
+		mt.Handler().ServeHTTP(rec, httptest.NewRequest(echo.GET, "/metrics", nil))
+		assert.NotContains(t, rec.Body.String(), `result="rejected"`)
+	})
+}
+
+// acceptedMeanwhile is the idempotency store that gets the response of another request with the same key right
+// before the response is added
+type acceptedMeanwhile struct{}
+
+func (s *acceptedMeanwhile) Get(key string) (*utils.IdempotentResponse, bool) {
+	return nil, false
+}
+
+func (s *acceptedMeanwhile) Add(r *utils.IdempotentResponse) (*utils.IdempotentResponse, error) {
+	return &utils.IdempotentResponse{Key: r.Key, RequestHash: r.RequestHash, Status: http.StatusOK, Body: []byte(`{"id":"other"}`), MessageID: "other"}, nil
 }
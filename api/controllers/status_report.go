@@ -0,0 +1,74 @@
+package controllers
+
+import (
+	"api/models"
+	"bytes"
+	"external"
+	"io/ioutil"
+	"net/http"
+	"queue"
+	qModels "queue/models"
+	"utils"
+
+	"github.com/labstack/echo"
+)
+
+// StatusReportControllers interface consists all the MessageBird webhooks handlers
+type StatusReportControllers interface {
+	HandleStatusReport(c echo.Context) error
+}
+
+type srcontroller struct {
+	Tracker queue.StatusTracker
+	Key     string
+	Clock   utils.Clock
+}
+
+// HandleStatusReport controller saves the delivery report of the sent message part
+func (sc *srcontroller) HandleStatusReport(c echo.Context) error {
+	req := c.Request()
+	body, err := ioutil.ReadAll(req.Body)
+
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	// body is read again while binding
+	req.Body = ioutil.NopCloser(bytes.NewReader(body))
+
+	s := req.Header.Get("MessageBird-Signature")
+	ts := req.Header.Get("MessageBird-Request-Timestamp")
+
+	if !external.VerifyMessageBirdSignature(sc.Key, s, ts, req.URL.Query(), body, sc.Clock.Now()) {
+		return echo.NewHTTPError(http.StatusUnauthorized, "invalid signature")
+	}
+
+	r := models.InitStatusReport()
+
+	if err = c.Bind(r); err != nil {
+		return err
+	}
+
+	if err = c.Validate(r); err != nil {
+		return c.JSON(http.StatusUnprocessableEntity, utils.HumaniseValidationErrors(err))
+	}
+
+	ok := sc.Tracker.Report(&qModels.DeliveryReport{
+		MessageBirdID:  r.GetID(),
+		Recipient:      r.GetRecipient(),
+		Status:         r.GetStatus(),
+		StatusDatetime: r.GetStatusDatetime(),
+	})
+
+	if !ok {
+		return echo.NewHTTPError(http.StatusNotFound, "message not found")
+	}
+
+	return c.NoContent(http.StatusOK)
+}
+
+// InitStatusReportControllers creates the MessageBird webhooks controller instance. Requests are verified with
+// the provided signing key and have to be signed within few minutes of the clock time
+func InitStatusReportControllers(st queue.StatusTracker, key string, c utils.Clock) StatusReportControllers {
+	return &srcontroller{st, key, c}
+}
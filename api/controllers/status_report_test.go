@@ -0,0 +1,134 @@
+package controllers_test
+
+import (
+	"api/controllers"
+	"bytes"
+	"io/ioutil"
+	"mocks"
+	"net/http"
+	"net/http/httptest"
+	"queue"
+	"queue/models"
+	"testing"
+	"time"
+	"utils"
+
+	"github.com/labstack/echo"
+	"github.com/stretchr/testify/assert"
+)
+
+// signing key and signatures of the recorded MessageBird status reports from testdata
+const (
+	srKey       = "PlLrKaqvZNRR5zAjm42ZT6q1SQxgbbGd"
+	srTimestamp = "1504254005"
+	srDelivered = "7gC9/WeuU9FazMJnvkDECfLBrFERTb6Kw8DxbRTgWjk="
+	srFailed    = "oLluYKqpJ2w5O/l+s3OuQw+dOa6bNVOGV7Fsx9wk0mo="
+)
+
+// srClock is the clock shortly after the recorded status reports were signed
+func srClock() utils.Clock {
+	return mocks.NewClockMock(time.Unix(1504254005, 0).Add(time.Minute))
+}
+
+func TestInitStatusReportControllers(t *testing.T) {
+	c := controllers.InitStatusReportControllers(queue.InitStatusTracker(time.Hour, utils.InitClock()), srKey, srClock())
+
+	t.Run("initialize status report controller", func(t *testing.T) {
+		assert.NotNil(t, c)
+	})
+}
+
+func TestSrcontroller_HandleStatusReport(t *testing.T) {
+	// request replays the recorded status report
+	request := func(file string, contentType string, signature string) (echo.Context, *httptest.ResponseRecorder) {
+		body, err := ioutil.ReadFile("testdata/" + file)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		e := echo.New()
+		e.Validator = utils.InitValidator(utils.InitEncoder(9, utils.Reference8Bit), time.Hour, nil, 50, utils.InitClock())
+
+		req := httptest.NewRequest(echo.POST, "/status-reports", bytes.NewReader(body))
+		req.Header.Set(echo.HeaderContentType, contentType)
+		req.Header.Set("MessageBird-Signature", signature)
+		req.Header.Set("MessageBird-Request-Timestamp", srTimestamp)
+
+		rec := httptest.NewRecorder()
+
+		return e.NewContext(req, rec), rec
+	}
+
+	initTracker := func() queue.StatusTracker {
+		st := queue.InitStatusTracker(time.Hour, utils.InitClock())
+		st.Track("id", 1)
+		st.AddMessageBirdID(models.PartRef{MessageID: "id", Part: 1}, "efa6405d518d4c0c88cce11f7db775fb", []string{"31612345678"})
+
+		return st
+	}
+
+	t.Run("saves form encoded report", func(t *testing.T) {
+		st := initTracker()
+		c, rec := request("status_report_delivered.form", echo.MIMEApplicationForm, srDelivered)
+
+		assert.Nil(t, controllers.InitStatusReportControllers(st, srKey, srClock()).HandleStatusReport(c))
+		assert.Equal(t, http.StatusOK, rec.Code)
+
+		s, _ := st.Get("id")
+		assert.Equal(t, []*models.DeliveryReport{{
+			MessageBirdID:  "efa6405d518d4c0c88cce11f7db775fb",
+			Recipient:      "31612345678",
+			Status:         "delivered",
+			StatusDatetime: "2017-09-01T10:00:05+00:00",
+		}}, s.Parts[0].Reports)
+	})
+
+	t.Run("saves JSON report", func(t *testing.T) {
+		st := initTracker()
+		c, rec := request("status_report_delivery_failed.json", echo.MIMEApplicationJSON, srFailed)
+
+		assert.Nil(t, controllers.InitStatusReportControllers(st, srKey, srClock()).HandleStatusReport(c))
+		assert.Equal(t, http.StatusOK, rec.Code)
+
+		s, _ := st.Get("id")
+		assert.Equal(t, "delivery_failed", s.Parts[0].Reports[0].Status)
+	})
+
+	t.Run("rejects report with invalid signature", func(t *testing.T) {
+		st := initTracker()
+		c, _ := request("status_report_delivered.form", echo.MIMEApplicationForm, srFailed)
+
+		err := controllers.InitStatusReportControllers(st, srKey, srClock()).HandleStatusReport(c)
+		assert.Equal(t, http.StatusUnauthorized, err.(*echo.HTTPError).Code)
+
+		s, _ := st.Get("id")
+		assert.Empty(t, s.Parts[0].Reports)
+	})
+
+	t.Run("rejects report signed with other key", func(t *testing.T) {
+		c, _ := request("status_report_delivered.form", echo.MIMEApplicationForm, srDelivered)
+
+		err := controllers.InitStatusReportControllers(initTracker(), "other", srClock()).HandleStatusReport(c)
+		assert.Equal(t, http.StatusUnauthorized, err.(*echo.HTTPError).Code)
+	})
+
+	t.Run("rejects report signed too long ago", func(t *testing.T) {
+		st := initTracker()
+		c, _ := request("status_report_delivered.form", echo.MIMEApplicationForm, srDelivered)
+
+		late := mocks.NewClockMock(time.Unix(1504254005, 0).Add(time.Hour))
+		err := controllers.InitStatusReportControllers(st, srKey, late).HandleStatusReport(c)
+		assert.Equal(t, http.StatusUnauthorized, err.(*echo.HTTPError).Code)
+
+		s, _ := st.Get("id")
+		assert.Empty(t, s.Parts[0].Reports)
+	})
+
+	t.Run("returns not found error for unknown message", func(t *testing.T) {
+		c, _ := request("status_report_delivered.form", echo.MIMEApplicationForm, srDelivered)
+
+		err := controllers.InitStatusReportControllers(queue.InitStatusTracker(time.Hour, utils.InitClock()), srKey, srClock()).HandleStatusReport(c)
+		assert.Equal(t, http.StatusNotFound, err.(*echo.HTTPError).Code)
+	})
+}
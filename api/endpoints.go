@@ -1,15 +1,46 @@
 package api
 
 import (
+	"api/auth"
 	"api/controllers"
 	"github.com/labstack/echo"
-	"queue"
-	"utils"
 )
 
-// RegisterEndpoints for API server
-func RegisterEndpoints(e *echo.Echo, udh utils.UDHEncoder, q queue.MessageQueue) {
-	mControllers := controllers.InitMessageControllers(q, udh)
+// RegisterEndpoints for API server. Message endpoints require API key if the key store is provided. Admin endpoints
+// are registered only with the key store, so they are never open to anyone. Approved originators are managed only if
+// the registry is provided
+func RegisterEndpoints(e *echo.Echo, cfg Config) {
+	mControllers := controllers.InitMessageControllers(cfg.Queue, cfg.Encoder, cfg.References, cfg.Tracker, cfg.Metrics,
+		cfg.Logger, cfg.Quota, cfg.Idempotency)
+	aControllers := controllers.InitAdminControllers(cfg.Queue, cfg.Dead, cfg.Originators)
+	srControllers := controllers.InitStatusReportControllers(cfg.Tracker, cfg.SigningKey, cfg.Clock)
 
-	e.POST("/message", mControllers.HandleMessage)
+	var client []echo.MiddlewareFunc
+
+	if cfg.Keys != nil {
+		client = []echo.MiddlewareFunc{auth.Authenticate(cfg.Keys, cfg.Clock)}
+	}
+
+	e.POST("/message", mControllers.HandleMessage, client...)
+	e.POST("/message/preview", mControllers.HandlePreview, client...)
+	e.GET("/message/:id", mControllers.HandleStatus, client...)
+
+	e.POST("/status-reports", srControllers.HandleStatusReport)
+
+	e.GET("/metrics", echo.WrapHandler(cfg.Metrics.Handler()))
+
+	if cfg.Keys == nil {
+		return
+	}
+
+	admin := append(client, auth.RequireAdmin())
+
+	e.GET("/admin/dead-letters", aControllers.HandleDeadLetters, admin...)
+	e.POST("/admin/dead-letters/:id/replay", aControllers.HandleReplayDeadLetter, admin...)
+
+	if cfg.Originators != nil {
+		e.GET("/admin/originators", aControllers.HandleOriginators, admin...)
+		e.POST("/admin/originators", aControllers.HandleApproveOriginator, admin...)
+		e.DELETE("/admin/originators/:originator", aControllers.HandleRevokeOriginator, admin...)
+	}
 }
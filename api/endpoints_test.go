@@ -2,18 +2,30 @@ package api_test
 
 import (
 	"api"
+	"api/auth"
+	"api/controllers"
+	"context"
+	"encoding/json"
+	"external"
 	"mocks"
+	"net/http"
+	"net/http/httptest"
+	"queue"
+	"strings"
 	"testing"
+	"time"
+	"utils"
 
 	"github.com/labstack/echo"
+	"github.com/messagebird/go-rest-api"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
 )
 
 func TestRegisterEndpoints(t *testing.T) {
 	t.Run("registered POST /message", func(t *testing.T) {
 		e := echo.New()
-		udh := &mocks.UDHEncoderMock{}
-		q := &mocks.MessageQueue{}
-		api.RegisterEndpoints(e, udh, q)
+		api.RegisterEndpoints(e, config())
 
 		for _, r := range e.Routes() {
 			if r.Path == "/message" && r.Method == "POST" {
@@ -23,4 +35,217 @@ func TestRegisterEndpoints(t *testing.T) {
 
 		t.Fail()
 	})
+
+	t.Run("registered GET /message/:id", func(t *testing.T) {
+		e := echo.New()
+		api.RegisterEndpoints(e, config())
+
+		for _, r := range e.Routes() {
+			if r.Path == "/message/:id" && r.Method == "GET" {
+				return
+			}
+		}
+
+		t.Fail()
+	})
+
+	t.Run("registered POST /message/preview", func(t *testing.T) {
+		e := echo.New()
+		api.RegisterEndpoints(e, config())
+
+		for _, r := range e.Routes() {
+			if r.Path == "/message/preview" && r.Method == "POST" {
+				return
+			}
+		}
+
+		t.Fail()
+	})
+
+	t.Run("registered admin dead letters endpoints", func(t *testing.T) {
+		e := echo.New()
+		ks, _ := auth.InitKeyStore([]*auth.Client{{Name: "ops", Key: "ops-key", Admin: true}})
+		cfg := config()
+		cfg.Keys = ks
+		api.RegisterEndpoints(e, cfg)
+
+		routes := map[string]bool{}
+
+		for _, r := range e.Routes() {
+			routes[r.Method+" "+r.Path] = true
+		}
+
+		assert.True(t, routes["GET /admin/dead-letters"])
+		assert.True(t, routes["POST /admin/dead-letters/:id/replay"])
+	})
+
+	t.Run("admin endpoints are not registered without key store", func(t *testing.T) {
+		e := echo.New()
+		reg, _ := utils.InitOriginatorRegistry("")
+		reg.Approve(&utils.ApprovedOriginator{Originator: "Shop"})
+		cfg := config()
+		cfg.Originators = reg
+		api.RegisterEndpoints(e, cfg)
+
+		serve := func(method string, path string) int {
+			rec := httptest.NewRecorder()
+			e.ServeHTTP(rec, httptest.NewRequest(method, path, strings.NewReader(`{"originator":"Other"}`)))
+
+			return rec.Code
+		}
+
+		assert.Equal(t, http.StatusNotFound, serve(echo.GET, "/admin/dead-letters"))
+		assert.Equal(t, http.StatusNotFound, serve(echo.POST, "/admin/dead-letters/id/replay"))
+		assert.Equal(t, http.StatusNotFound, serve(echo.GET, "/admin/originators"))
+		assert.Equal(t, http.StatusNotFound, serve(echo.POST, "/admin/originators"))
+		assert.Equal(t, http.StatusNotFound, serve(echo.DELETE, "/admin/originators/Shop"))
+		assert.True(t, reg.IsApproved("Shop", ""))
+		assert.False(t, reg.IsApproved("Other", ""))
+	})
+
+	t.Run("registered POST /status-reports", func(t *testing.T) {
+		e := echo.New()
+		api.RegisterEndpoints(e, config())
+
+		for _, r := range e.Routes() {
+			if r.Path == "/status-reports" && r.Method == "POST" {
+				return
+			}
+		}
+
+		t.Fail()
+	})
+
+	t.Run("message and admin endpoints require API key if key store is provided", func(t *testing.T) {
+		e := echo.New()
+		ks, _ := auth.InitKeyStore([]*auth.Client{{Name: "shop", Key: "shop-key"}})
+		cfg := config()
+		cfg.Keys = ks
+		api.RegisterEndpoints(e, cfg)
+
+		serve := func(method string, path string, key string) int {
+			req := httptest.NewRequest(method, path, nil)
+			req.Header.Set(auth.HeaderAPIKey, key)
+			rec := httptest.NewRecorder()
+			e.ServeHTTP(rec, req)
+
+			return rec.Code
+		}
+
+		assert.Equal(t, http.StatusUnauthorized, serve(echo.POST, "/message", ""))
+		assert.Equal(t, http.StatusUnauthorized, serve(echo.GET, "/message/id", "unknown"))
+		assert.Equal(t, http.StatusNotFound, serve(echo.GET, "/message/id", "shop-key"))
+		assert.Equal(t, http.StatusForbidden, serve(echo.GET, "/admin/dead-letters", "shop-key"))
+		assert.Equal(t, http.StatusOK, serve(echo.GET, "/metrics", ""))
+	})
+
+	t.Run("retried POST /message with the same idempotency key returns the original response", func(t *testing.T) {
+		e := echo.New()
+		udh := utils.InitEncoder(9, utils.Reference8Bit)
+		e.Validator = utils.InitValidator(udh, time.Hour, nil, 50, utils.InitClock())
+
+		pushed := make(chan bool, 10)
+		q := &mocks.MessageQueue{}
+		q.On("Push", mock.Anything).Return().Run(func(mock.Arguments) {
+			pushed <- true
+		})
+
+		cfg := config()
+		cfg.Encoder = udh
+		cfg.Queue = q
+		api.RegisterEndpoints(e, cfg)
+
+		serve := func(key string, body string) *httptest.ResponseRecorder {
+			req := httptest.NewRequest(echo.POST, "/message", strings.NewReader(body))
+			req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+			req.Header.Set(controllers.HeaderIdempotencyKey, key)
+			rec := httptest.NewRecorder()
+			e.ServeHTTP(rec, req)
+
+			return rec
+		}
+
+		id := func(rec *httptest.ResponseRecorder) string {
+			m := map[string]interface{}{}
+			json.Unmarshal(rec.Body.Bytes(), &m)
+
+			return m["id"].(string)
+		}
+
+		body := `{"recipient":31612345678,"originator":"MessageBird","message":"hi"}`
+
+		first := serve("retry", body)
+		assert.Equal(t, http.StatusOK, first.Code)
+		<-pushed
+
+		retried := serve("retry", body)
+		assert.Equal(t, http.StatusOK, retried.Code)
+		assert.Equal(t, id(first), id(retried))
+		assert.Equal(t, "true", retried.Header().Get(controllers.HeaderIdempotentReplayed))
+
+		other := serve("other", body)
+		assert.NotEqual(t, id(first), id(other))
+		<-pushed
+
+		// the key can't be reused for another message
+		reused := serve("retry", `{"recipient":31612345678,"originator":"MessageBird","message":"bye"}`)
+		assert.Equal(t, http.StatusUnprocessableEntity, reused.Code)
+		assert.JSONEq(t, `{"idempotency_key":"is already used for the request with a different body"}`, reused.Body.String())
+
+		q.AssertNumberOfCalls(t, "Push", 2)
+	})
+
+	t.Run("message of the national language is sent to MessageBird as unicode", func(t *testing.T) {
+		e := echo.New()
+		udh := utils.InitEncoder(9, utils.Reference8Bit)
+		e.Validator = utils.InitValidator(udh, time.Hour, nil, 50, utils.InitClock())
+
+		sent := make(chan mock.Arguments, 1)
+		mb := &mocks.ExternalMessageBirdClientMock{}
+		mb.On("NewMessage", mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return(&messagebird.Message{}, nil).Run(func(args mock.Arguments) {
+			sent <- args
+		})
+
+		st := queue.InitStatusTracker(time.Hour, utils.InitClock())
+		q := queue.InitQueue(queue.Config{
+			Gateway:  external.InitMessageBirdGateway(mb),
+			Tracker:  st,
+			Storage:  queue.InitMemoryStorage(),
+			Retry:    queue.InitRetryPolicy(3, 0, 0),
+			Dead:     queue.InitDeadLetterStore(utils.InitClock()),
+			Limiter:  queue.InitRateLimiter(utils.InitClock(), queue.Limit{}, nil),
+			Priority: queue.InitPriorityPolicy(0),
+			Merge:    queue.InitMergePolicy(0),
+			Clock:    utils.InitClock(),
+			Tick:     10 * time.Millisecond,
+			Metrics:  utils.InitMetrics(),
+			Logger:   logger(),
+		})
+		defer q.Shutdown(context.Background())
+
+		cfg := config()
+		cfg.Encoder = udh
+		cfg.Queue = q
+		cfg.Tracker = st
+		api.RegisterEndpoints(e, cfg)
+
+		req := httptest.NewRequest(echo.POST, "/message", strings.NewReader(`{"recipient":31612345678,"originator":"MessageBird","message":"Ağaç"}`))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+
+		assert.Equal(t, http.StatusOK, rec.Code)
+
+		select {
+		case args := <-sent:
+			params := args.Get(3).(*messagebird.MessageParams)
+
+			// ğ is missing in the default GSM alphabet and the national language tables are not supported
+			assert.Equal(t, "Ağaç", args.String(2))
+			assert.Equal(t, "unicode", params.DataCoding)
+			assert.Equal(t, messagebird.TypeDetails{}, params.TypeDetails)
+		case <-time.After(time.Second):
+			t.Fatal("message wasn't sent")
+		}
+	})
 }
@@ -1,6 +1,8 @@
 package api
 
 import (
+	"api/auth"
+	"context"
 	"queue"
 	"utils"
 
@@ -11,6 +13,7 @@ import (
 // Server interface
 type Server interface {
 	Start() error
+	Shutdown(ctx context.Context) error
 }
 
 type server struct {
@@ -19,24 +22,52 @@ type server struct {
 	Queue    queue.MessageQueue
 }
 
-// InitServer initialize base API server
-func InitServer(address string, v echo.Validator, udh utils.UDHEncoder, q queue.MessageQueue) Server {
+// Config holds the dependencies of the API endpoints
+type Config struct {
+	Encoder     utils.UDHEncoder
+	References  utils.ReferenceAllocator
+	Queue       queue.MessageQueue
+	Tracker     queue.StatusTracker
+	Dead        queue.DeadLetterStore
+	SigningKey  string // MessageBird status reports are verified with it
+	Metrics     utils.Metrics
+	Logger      utils.Logger
+	Keys        auth.KeyStore // API keys are not required if nil
+	Quota       auth.Quota
+	Originators utils.OriginatorRegistry // approved originators are not managed if nil
+	Idempotency utils.IdempotencyStore   // responses of the messages submitted with the idempotency key
+	Clock       utils.Clock
+}
+
+// InitServer initialize base API server. Every request gets an identifier (X-Request-ID header) which is logged
+// together with the messages it submitted
+func InitServer(address string, v echo.Validator, cfg Config) Server {
 	e := echo.New()
+	e.HideBanner = true
 
-	e.Use(middleware.Logger())
+	e.Use(middleware.RequestIDWithConfig(middleware.RequestIDConfig{Generator: utils.GenerateID}))
+	e.Use(RequestLogger(cfg.Logger))
 	e.Use(middleware.Recover())
 
 	// assign custom validator
 	e.Validator = v
 
-	RegisterEndpoints(e, udh, q)
+	RegisterEndpoints(e, cfg)
 
-	return &server{e, address, q}
+	return &server{e, address, cfg.Queue}
 }
 
 // Start the server
 func (s *server) Start() error {
-	e := s.Instance.Start(s.Address)
-	s.Instance.Logger.Error(e)
-	return e
+	return s.Instance.Start(s.Address)
+}
+
+// Shutdown stops accepting new requests, waits for the active ones and then drains the queue.
+// Both have to be done before the context is done
+func (s *server) Shutdown(ctx context.Context) error {
+	if err := s.Instance.Shutdown(ctx); err != nil {
+		return err
+	}
+
+	return s.Queue.Shutdown(ctx)
 }
@@ -2,22 +2,50 @@ package api_test
 
 import (
 	"api"
+	"api/auth"
+	"context"
+	"io/ioutil"
 	"mocks"
 	"queue"
 	"reflect"
 	"testing"
+	"time"
 	"utils"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
 )
 
+// logger drops all the entries
+func logger() utils.Logger {
+	return utils.InitLogger(ioutil.Discard, utils.InitClock(), utils.ErrorLevel)
+}
+
+// config with the real encoder and in-memory stores, the queue is the mock
+func config() api.Config {
+	c := utils.InitClock()
+
+	return api.Config{
+		Encoder:     utils.InitEncoder(9, utils.Reference8Bit),
+		References:  utils.InitReferenceAllocator(utils.Reference8Bit, time.Hour, c),
+		Queue:       &mocks.MessageQueue{},
+		Tracker:     queue.InitStatusTracker(time.Hour, c),
+		Dead:        queue.InitDeadLetterStore(c),
+		SigningKey:  "key",
+		Metrics:     utils.InitMetrics(),
+		Logger:      logger(),
+		Quota:       auth.InitQuota(c),
+		Idempotency: utils.InitIdempotencyStore(time.Hour, c),
+		Clock:       c,
+	}
+}
+
 func TestInitServer(t *testing.T) {
 	address := "address"
-	v := utils.InitValidator()
-	udh := utils.InitEncoder()
-	mb := &mocks.ExternalMessageBirdClientMock{}
-	q := queue.InitQueue(mb)
-	s := api.InitServer(address, v, udh, q)
+	v := utils.InitValidator(utils.InitEncoder(9, utils.Reference8Bit), time.Hour, nil, 50, utils.InitClock())
+	cfg := config()
+	q := cfg.Queue
+	s := api.InitServer(address, v, cfg)
 
 	e := reflect.ValueOf(s).Elem()
 
@@ -36,13 +64,24 @@ func TestInitServer(t *testing.T) {
 
 func TestServer_Start(t *testing.T) {
 	address := "address"
-	v := utils.InitValidator()
-	udh := utils.InitEncoder()
-	mb := &mocks.ExternalMessageBirdClientMock{}
-	q := queue.InitQueue(mb)
-	s := api.InitServer(address, v, udh, q)
+	v := utils.InitValidator(utils.InitEncoder(9, utils.Reference8Bit), time.Hour, nil, 50, utils.InitClock())
+	s := api.InitServer(address, v, config())
 
 	t.Run("returns echo error if invalid address provided", func(t *testing.T) {
 		assert.Equal(t, "listen tcp: address address: missing port in address", s.Start().Error())
 	})
 }
+
+func TestServer_Shutdown(t *testing.T) {
+	q := &mocks.MessageQueue{}
+	q.On("Shutdown", mock.Anything).Return(nil)
+
+	cfg := config()
+	cfg.Queue = q
+	s := api.InitServer("address", utils.InitValidator(utils.InitEncoder(9, utils.Reference8Bit), time.Hour, nil, 50, utils.InitClock()), cfg)
+
+	t.Run("drains the queue", func(t *testing.T) {
+		assert.Nil(t, s.Shutdown(context.Background()))
+		q.AssertCalled(t, "Shutdown", mock.Anything)
+	})
+}
@@ -0,0 +1,44 @@
+package api
+
+import (
+	"time"
+	"utils"
+
+	"github.com/labstack/echo"
+)
+
+// RequestLogger writes every handled request to the log together with its request identifier
+func RequestLogger(lg utils.Logger) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			start := time.Now()
+
+			err := next(c)
+
+			// let echo render the error first so the final status is logged
+			if err != nil {
+				c.Error(err)
+			}
+
+			req := c.Request()
+			res := c.Response()
+
+			f := utils.Fields{
+				"request_id": res.Header().Get(echo.HeaderXRequestID),
+				"method":     req.Method,
+				"uri":        req.RequestURI,
+				"remote_ip":  c.RealIP(),
+				"status":     res.Status,
+				"latency_ms": time.Since(start).Seconds() * 1000,
+			}
+
+			if err != nil {
+				f["error"] = err
+			}
+
+			lg.Info("request handled", f)
+
+			return nil
+		}
+	}
+}
@@ -0,0 +1,43 @@
+package api_test
+
+import (
+	"api"
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"utils"
+
+	"github.com/labstack/echo"
+	"github.com/labstack/echo/middleware"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRequestLogger(t *testing.T) {
+	buf := &bytes.Buffer{}
+
+	e := echo.New()
+	e.Use(middleware.RequestID())
+	e.Use(api.RequestLogger(utils.InitLogger(buf, utils.InitClock(), utils.InfoLevel)))
+
+	e.GET("/missing", func(c echo.Context) error {
+		return echo.NewHTTPError(http.StatusNotFound, "message not found")
+	})
+
+	t.Run("logs request with its identifier and final status", func(t *testing.T) {
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, httptest.NewRequest(echo.GET, "/missing", nil))
+
+		entry := map[string]interface{}{}
+		assert.Nil(t, json.Unmarshal(buf.Bytes(), &entry))
+
+		assert.Equal(t, http.StatusNotFound, rec.Code)
+		assert.NotEmpty(t, rec.Header().Get(echo.HeaderXRequestID))
+		assert.Equal(t, rec.Header().Get(echo.HeaderXRequestID), entry["request_id"])
+		assert.Equal(t, "GET", entry["method"])
+		assert.Equal(t, "/missing", entry["uri"])
+		assert.Equal(t, float64(http.StatusNotFound), entry["status"])
+		assert.Equal(t, "code=404, message=message not found", entry["error"])
+	})
+}
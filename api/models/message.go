@@ -1,16 +1,68 @@
 package models
 
+import "time"
+
 // Message interface
 type Message interface {
+	GetID() string
+	SetID(id string)
 	GetBody() string
 	GetRecipient() int64
+	GetRecipients() []int64
 	GetOriginator() string
+	GetScheduledAt() time.Time
+	GetRequestID() string
+	SetRequestID(id string)
+	GetMaxParts() int
+	GetClient() string
+	SetClient(name string)
+	GetPriority() Priority
+}
+
+// Priority is the class of the message that decides which messages are sent first
+type Priority string
+
+const (
+	// PriorityOTP is for one-time passwords and other codes the recipient is waiting for right now
+	PriorityOTP Priority = "otp"
+
+	// PriorityTransactional is for notifications triggered by the recipient (default)
+	PriorityTransactional Priority = "transactional"
+
+	// PriorityBulk is for marketing and other mass messages
+	PriorityBulk Priority = "bulk"
+)
+
+// Rank returns the order of the priority class, the bigger one is sent first. Unknown class is the transactional one
+func (p Priority) Rank() int {
+	switch p {
+	case PriorityOTP:
+		return 2
+	case PriorityBulk:
+		return 0
+	default:
+		return 1
+	}
 }
 
 type mes struct {
-	Recipient  int64  `json:"recipient" validate:"required,msisdn"`
-	Originator string `json:"originator" validate:"required,textoriginator|msisdn"`
-	Body       string `json:"message" validate:"required,max=1377"`
+	ID         string  `json:"id"`
+	Recipient  int64   `json:"recipient,omitempty" validate:"requiredwithout=Recipients,omitempty,msisdn"`
+	Recipients []int64 `json:"recipients,omitempty" validate:"requiredwithout=Recipient,omitempty,maxrecipients,dive,msisdn"`
+	Originator string  `json:"originator" validate:"required,textoriginator|msisdn,approvedoriginator=Client"`
+	Body       string  `json:"message" validate:"required,maxparts=MaxParts AllowTruncate"`
+	// ScheduledAt is an optional RFC3339 time when the message should be delivered
+	ScheduledAt *time.Time `json:"scheduled_at,omitempty" validate:"omitempty,scheduled"`
+	// MaxParts lowers the max amount of parts the body could be split into for this message only
+	MaxParts int `json:"max_parts,omitempty" validate:"omitempty,partslimit"`
+	// AllowTruncate lets the body that needs more parts than allowed be cut instead of rejecting the message
+	AllowTruncate bool `json:"allow_truncate,omitempty"`
+	// Priority is the class of the message: otp, transactional (default) or bulk
+	Priority Priority `json:"priority,omitempty" validate:"omitempty,oneof=otp transactional bulk"`
+	// RequestID of the HTTP request the message was submitted with. It's never bound from the request body
+	RequestID string `json:"-"`
+	// Client is the name of the API client that submitted the message. It's never bound from the request body
+	Client string `json:"-"`
 }
 
 // InitMessage is a Message factory method
@@ -18,6 +70,16 @@ func InitMessage() Message {
 	return &mes{}
 }
 
+// GetID returns message identifier
+func (m *mes) GetID() string {
+	return m.ID
+}
+
+// SetID sets message identifier
+func (m *mes) SetID(id string) {
+	m.ID = id
+}
+
 // GetBody returns message body
 func (m *mes) GetBody() string {
 	return m.Body
@@ -28,7 +90,67 @@ func (m *mes) GetRecipient() int64 {
 	return m.Recipient
 }
 
+// GetRecipients returns all the unique message recipients (both legacy single recipient and the list of recipients)
+func (m *mes) GetRecipients() []int64 {
+	result := make([]int64, 0, len(m.Recipients)+1)
+	added := map[int64]bool{}
+
+	for _, r := range append([]int64{m.Recipient}, m.Recipients...) {
+		if r == 0 || added[r] {
+			continue
+		}
+
+		added[r] = true
+		result = append(result, r)
+	}
+
+	return result
+}
+
+// GetMaxParts returns the requested max amount of parts (zero if the default one should be used)
+func (m *mes) GetMaxParts() int {
+	return m.MaxParts
+}
+
 // GetOriginator returns message originator
 func (m *mes) GetOriginator() string {
 	return m.Originator
 }
+
+// GetScheduledAt returns the time when the message should be delivered (zero time if it should be delivered right away)
+func (m *mes) GetScheduledAt() time.Time {
+	if m.ScheduledAt == nil {
+		return time.Time{}
+	}
+
+	return *m.ScheduledAt
+}
+
+// GetRequestID returns identifier of the HTTP request the message was submitted with
+func (m *mes) GetRequestID() string {
+	return m.RequestID
+}
+
+// SetRequestID sets identifier of the HTTP request the message was submitted with
+func (m *mes) SetRequestID(id string) {
+	m.RequestID = id
+}
+
+// GetClient returns name of the API client that submitted the message
+func (m *mes) GetClient() string {
+	return m.Client
+}
+
+// SetClient sets name of the API client that submitted the message
+func (m *mes) SetClient(name string) {
+	m.Client = name
+}
+
+// GetPriority returns the priority class of the message (transactional if it's not set)
+func (m *mes) GetPriority() Priority {
+	if m.Priority == "" {
+		return PriorityTransactional
+	}
+
+	return m.Priority
+}
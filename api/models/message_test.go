@@ -2,7 +2,12 @@ package models_test
 
 import (
 	"api/models"
+	"encoding/json"
+	"mocks"
+	"strings"
 	"testing"
+	"time"
+	"utils"
 
 	"reflect"
 
@@ -16,6 +21,26 @@ func TestInitMessage(t *testing.T) {
 	})
 }
 
+func TestMes_GetID(t *testing.T) {
+	t.Run("returns message identifier value", func(t *testing.T) {
+		id := "id"
+
+		m := models.InitMessage()
+		reflect.ValueOf(m).Elem().FieldByName("ID").SetString(id)
+		assert.Equal(t, id, m.GetID())
+	})
+}
+
+func TestMes_SetID(t *testing.T) {
+	t.Run("sets message identifier value", func(t *testing.T) {
+		id := "id"
+
+		m := models.InitMessage()
+		m.SetID(id)
+		assert.Equal(t, id, reflect.ValueOf(m).Elem().FieldByName("ID").String())
+	})
+}
+
 func TestMes_GetBody(t *testing.T) {
 	t.Run("returns message body value", func(t *testing.T) {
 		body := "Body"
@@ -45,3 +70,186 @@ func TestMes_GetRecipient(t *testing.T) {
 		assert.Equal(t, rec, m.GetRecipient())
 	})
 }
+
+func TestMes_GetRecipients(t *testing.T) {
+	t.Run("returns empty list if there are no recipients", func(t *testing.T) {
+		m := models.InitMessage()
+		assert.Equal(t, []int64{}, m.GetRecipients())
+	})
+
+	t.Run("returns legacy recipient together with the list of recipients", func(t *testing.T) {
+		m := models.InitMessage()
+		reflect.ValueOf(m).Elem().FieldByName("Recipient").SetInt(1)
+		reflect.ValueOf(m).Elem().FieldByName("Recipients").Set(reflect.ValueOf([]int64{2, 3}))
+		assert.Equal(t, []int64{1, 2, 3}, m.GetRecipients())
+	})
+
+	t.Run("returns every recipient only once", func(t *testing.T) {
+		m := models.InitMessage()
+		reflect.ValueOf(m).Elem().FieldByName("Recipient").SetInt(1)
+		reflect.ValueOf(m).Elem().FieldByName("Recipients").Set(reflect.ValueOf([]int64{2, 1, 2}))
+		assert.Equal(t, []int64{1, 2}, m.GetRecipients())
+	})
+}
+
+const horizon = 24 * time.Hour
+const maxRecipients = 3
+
+func TestMes_Validation(t *testing.T) {
+	now := time.Date(2017, 1, 1, 0, 0, 0, 0, time.UTC)
+	v := utils.InitValidator(utils.InitEncoder(9, utils.Reference8Bit), horizon, nil, maxRecipients, mocks.NewClockMock(now))
+
+	initMessage := func(recipient int64, recipients []int64) models.Message {
+		m := models.InitMessage()
+		reflect.ValueOf(m).Elem().FieldByName("Originator").SetString("MessageBird")
+		reflect.ValueOf(m).Elem().FieldByName("Body").SetString("Body")
+		reflect.ValueOf(m).Elem().FieldByName("Recipient").SetInt(recipient)
+		reflect.ValueOf(m).Elem().FieldByName("Recipients").Set(reflect.ValueOf(recipients))
+
+		return m
+	}
+
+	t.Run("valid with legacy recipient only", func(t *testing.T) {
+		assert.Nil(t, v.Validate(initMessage(31612345678, nil)))
+	})
+
+	t.Run("valid with list of recipients only", func(t *testing.T) {
+		assert.Nil(t, v.Validate(initMessage(0, []int64{31612345678, 31612345679})))
+	})
+
+	t.Run("not valid without any recipient", func(t *testing.T) {
+		err := utils.HumaniseValidationErrors(v.Validate(initMessage(0, []int64{})))
+
+		assert.Contains(t, err, "recipient")
+		assert.Contains(t, err, "recipients")
+	})
+
+	t.Run("reports every invalid recipient", func(t *testing.T) {
+		err := utils.HumaniseValidationErrors(v.Validate(initMessage(0, []int64{31612345678, 12, 0})))
+
+		assert.Equal(t, map[string]string{
+			"recipients[1]": "should be a valid MSISDN",
+			"recipients[2]": "should be a valid MSISDN",
+		}, err)
+	})
+
+	t.Run("valid with the max amount of recipients", func(t *testing.T) {
+		assert.Nil(t, v.Validate(initMessage(0, []int64{31612345678, 31612345679, 31612345680})))
+	})
+
+	t.Run("not valid with more recipients than allowed", func(t *testing.T) {
+		err := utils.HumaniseValidationErrors(v.Validate(initMessage(0, []int64{31612345678, 31612345679, 31612345680, 31612345681})))
+
+		assert.Equal(t, map[string]string{"recipients": "should have at most 3 recipients"}, err)
+	})
+	t.Run("not valid if body needs more parts than allowed", func(t *testing.T) {
+		m := initMessage(31612345678, nil)
+		reflect.ValueOf(m).Elem().FieldByName("Body").SetString(strings.Repeat("ы", 70*9))
+
+		assert.Equal(t, map[string]string{"body": "needs 10 parts which is more than allowed"}, utils.HumaniseValidationErrors(v.Validate(m)))
+
+		t.Run("or more parts than requested", func(t *testing.T) {
+			reflect.ValueOf(m).Elem().FieldByName("Body").SetString(strings.Repeat("ы", 67*2+1))
+			reflect.ValueOf(m).Elem().FieldByName("MaxParts").SetInt(2)
+			assert.Equal(t, map[string]string{"body": "needs 3 parts which is more than allowed"}, utils.HumaniseValidationErrors(v.Validate(m)))
+		})
+
+		t.Run("requested max amount of parts is limited by the encoder", func(t *testing.T) {
+			reflect.ValueOf(m).Elem().FieldByName("MaxParts").SetInt(10)
+			assert.Equal(t, map[string]string{"maxparts": "should be between 1 and 9"}, utils.HumaniseValidationErrors(v.Validate(m)))
+		})
+
+		t.Run("unless truncation is allowed", func(t *testing.T) {
+			reflect.ValueOf(m).Elem().FieldByName("MaxParts").SetInt(0)
+			reflect.ValueOf(m).Elem().FieldByName("AllowTruncate").SetBool(true)
+			assert.Nil(t, v.Validate(m))
+		})
+	})
+
+	t.Run("priority", func(t *testing.T) {
+		m := initMessage(31612345678, nil)
+
+		t.Run("valid class", func(t *testing.T) {
+			reflect.ValueOf(m).Elem().FieldByName("Priority").SetString("otp")
+			assert.Nil(t, v.Validate(m))
+		})
+
+		t.Run("not valid unknown class", func(t *testing.T) {
+			reflect.ValueOf(m).Elem().FieldByName("Priority").SetString("urgent")
+			assert.Equal(t, map[string]string{"priority": "should be one of otp, transactional, bulk"}, utils.HumaniseValidationErrors(v.Validate(m)))
+		})
+	})
+
+	t.Run("scheduled time", func(t *testing.T) {
+		schedule := func(at time.Time) models.Message {
+			m := initMessage(31612345678, nil)
+			reflect.ValueOf(m).Elem().FieldByName("ScheduledAt").Set(reflect.ValueOf(&at))
+
+			return m
+		}
+
+		t.Run("valid in the future", func(t *testing.T) {
+			assert.Nil(t, v.Validate(schedule(now.Add(time.Hour))))
+		})
+
+		t.Run("not valid in the past", func(t *testing.T) {
+			err := utils.HumaniseValidationErrors(v.Validate(schedule(now.Add(-time.Hour))))
+
+			assert.Equal(t, map[string]string{"scheduledat": "should be a future time within the scheduling horizon"}, err)
+		})
+
+		t.Run("not valid beyond the scheduling horizon", func(t *testing.T) {
+			assert.NotNil(t, v.Validate(schedule(now.Add(horizon+time.Hour))))
+		})
+	})
+}
+
+func TestMes_GetScheduledAt(t *testing.T) {
+	t.Run("zero time if not scheduled", func(t *testing.T) {
+		assert.True(t, models.InitMessage().GetScheduledAt().IsZero())
+	})
+
+	t.Run("scheduled time from RFC3339 value", func(t *testing.T) {
+		m := models.InitMessage()
+		json.Unmarshal([]byte(`{"scheduled_at": "2017-01-01T10:00:00+01:00"}`), m)
+
+		assert.True(t, time.Date(2017, 1, 1, 9, 0, 0, 0, time.UTC).Equal(m.GetScheduledAt()))
+	})
+}
+
+func TestMes_SetRequestID(t *testing.T) {
+	t.Run("sets request identifier value", func(t *testing.T) {
+		m := models.InitMessage()
+		m.SetRequestID("rid")
+		assert.Equal(t, "rid", m.GetRequestID())
+	})
+
+	t.Run("request identifier is never bound or rendered", func(t *testing.T) {
+		m := models.InitMessage()
+		json.Unmarshal([]byte(`{"RequestID": "rid"}`), m)
+		assert.Empty(t, m.GetRequestID())
+
+		m.SetRequestID("rid")
+		b, _ := json.Marshal(m)
+		assert.NotContains(t, string(b), "rid")
+	})
+}
+
+func TestMes_GetPriority(t *testing.T) {
+	t.Run("transactional if not set", func(t *testing.T) {
+		assert.Equal(t, models.PriorityTransactional, models.InitMessage().GetPriority())
+	})
+
+	t.Run("bound from the request", func(t *testing.T) {
+		m := models.InitMessage()
+		json.Unmarshal([]byte(`{"priority": "otp"}`), m)
+
+		assert.Equal(t, models.PriorityOTP, m.GetPriority())
+	})
+}
+
+func TestPriority_Rank(t *testing.T) {
+	assert.True(t, models.PriorityOTP.Rank() > models.PriorityTransactional.Rank())
+	assert.True(t, models.PriorityTransactional.Rank() > models.PriorityBulk.Rank())
+	assert.Equal(t, models.PriorityTransactional.Rank(), models.Priority("").Rank())
+}
@@ -0,0 +1,42 @@
+package models
+
+// StatusReport is the delivery report MessageBird sends for every recipient of the message
+type StatusReport interface {
+	GetID() string
+	GetRecipient() string
+	GetStatus() string
+	GetStatusDatetime() string
+}
+
+type sReport struct {
+	ID             string `json:"id" form:"id" validate:"required"`
+	Reference      string `json:"reference" form:"reference"`
+	Recipient      string `json:"recipient" form:"recipient" validate:"required"`
+	Status         string `json:"status" form:"status" validate:"required"`
+	StatusDatetime string `json:"statusDatetime" form:"statusDatetime"`
+}
+
+// InitStatusReport is a StatusReport factory method
+func InitStatusReport() StatusReport {
+	return &sReport{}
+}
+
+// GetID returns MessageBird message identifier
+func (r *sReport) GetID() string {
+	return r.ID
+}
+
+// GetRecipient returns the recipient the report is about
+func (r *sReport) GetRecipient() string {
+	return r.Recipient
+}
+
+// GetStatus returns delivery status (e.g. sent, delivered, delivery_failed)
+func (r *sReport) GetStatus() string {
+	return r.Status
+}
+
+// GetStatusDatetime returns RFC3339 time of the status change
+func (r *sReport) GetStatusDatetime() string {
+	return r.StatusDatetime
+}
@@ -0,0 +1,29 @@
+package models_test
+
+import (
+	"api/models"
+	"encoding/json"
+	"testing"
+	"time"
+	"utils"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStatusReport(t *testing.T) {
+	r := models.InitStatusReport()
+	json.Unmarshal([]byte(`{"id":"mb","recipient":"31612345678","status":"delivered","statusDatetime":"2017-09-01T10:00:05+00:00"}`), r)
+
+	t.Run("returns reported values", func(t *testing.T) {
+		assert.Equal(t, "mb", r.GetID())
+		assert.Equal(t, "31612345678", r.GetRecipient())
+		assert.Equal(t, "delivered", r.GetStatus())
+		assert.Equal(t, "2017-09-01T10:00:05+00:00", r.GetStatusDatetime())
+	})
+
+	t.Run("id, recipient and status are required", func(t *testing.T) {
+		err := utils.HumaniseValidationErrors(utils.InitValidator(utils.InitEncoder(9, utils.Reference8Bit), time.Hour, nil, 50, utils.InitClock()).Validate(models.InitStatusReport()))
+
+		assert.Equal(t, map[string]string{"id": "must have a value", "recipient": "must have a value", "status": "must have a value"}, err)
+	})
+}
@@ -0,0 +1,424 @@
+package config
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v2"
+)
+
+// EnvPrefix is the prefix of the environment variables the settings are read from (e.g. BIRDFEEDER_SERVER_ADDRESS)
+const EnvPrefix = "BIRDFEEDER_"
+
+// MessageBirdMaxRecipients is the max amount of recipients MessageBird API accepts within one message
+const MessageBirdMaxRecipients = 50
+
+// redacted replaces the values of the secret settings when the configuration is printed
+const redacted = "REDACTED"
+
+// Config of the service. Every setting could be provided within the YAML or JSON config file (by its key),
+// environment variable (EnvPrefix + upper-cased key) or command-line flag (key with dashes instead of underscores).
+// Flags take precedence over the environment variables and environment variables take precedence over the file
+type Config struct {
+	SMSProvider              string             `key:"sms_provider" desc:"provider the messages are sent to: messagebird or simulator (nothing is sent for real)"`
+	SimulatorAddress         string             `key:"simulator_address" desc:"address the simulator exposes received messages on"`
+	SimulatorLatency         time.Duration      `key:"simulator_latency" desc:"time it takes for the simulator to respond"`
+	SimulatorFailureRate     float64            `key:"simulator_failure_rate" desc:"probability (0..1) of the temporary failure injected by the simulator"`
+	SimulatorMaxRecipients   int                `key:"simulator_max_recipients" desc:"max recipients of one message sent to the simulator, bigger messages are rejected (not limited if zero)"`
+	MessageBirdKey           string             `key:"messagebird_key" secret:"true" desc:"MessageBird REST API key"`
+	MessageBirdMaxRecipients int                `key:"messagebird_max_recipients" desc:"max recipients of one message sent to MessageBird (up to 50)"`
+	StatusReportSigningKey   string             `key:"status_report_signing_key" secret:"true" desc:"MessageBird signing key status reports are verified with"`
+	ServerAddress            string             `key:"server_address" desc:"address of the REST API"`
+	APIKeysPath              string             `key:"api_keys_path" desc:"YAML or JSON file with the API clients (API keys are not required if empty)"`
+	OriginatorsPath          string             `key:"originators_path" desc:"YAML or JSON file with the approved originators (any valid originator is accepted if empty)"`
+	QueueStoragePath         string             `key:"queue_storage_path" desc:"file pending messages are kept in (in-memory storage is used if empty)"`
+	DeadLetterStoragePath    string             `key:"dead_letter_storage_path" desc:"file the dead letters are kept in (in-memory store is used if empty)"`
+	IdempotencyStoragePath   string             `key:"idempotency_storage_path" desc:"file the idempotency keys are kept in (in-memory store is used if empty)"`
+	IdempotencyTTL           time.Duration      `key:"idempotency_ttl" desc:"time the response is returned again for the request with the same Idempotency-Key header"`
+	StatusTTL                time.Duration      `key:"status_ttl" desc:"time the status of the message is kept for after it's sent or failed"`
+	QueueTick                time.Duration      `key:"queue_tick" desc:"how often the queue checks for the new messages"`
+	PriorityAging            time.Duration      `key:"priority_aging" desc:"time the waiting message needs to be raised by one priority class (no aging if zero)"`
+	RetryMaxAttempts         int                `key:"retry_max_attempts" desc:"attempts to send the message before it's moved to the dead-letter store"`
+	RetryBaseDelay           time.Duration      `key:"retry_base_delay" desc:"delay before the first retry, every next retry waits twice longer"`
+	RetryMaxDelay            time.Duration      `key:"retry_max_delay" desc:"max delay between the retries"`
+	RateLimit                float64            `key:"rate_limit" desc:"max messages per second sent to MessageBird (not limited if zero)"`
+	RateBurst                int                `key:"rate_burst" desc:"max messages sent to MessageBird at once"`
+	OriginatorRateLimits     map[string]float64 `key:"originator_rate_limits" desc:"per-originator limits (messages per second) on top of rate_limit, e.g. originator=0.5,other=2"`
+	OriginatorRateBurst      int                `key:"originator_rate_burst" desc:"max messages from the limited originator sent at once"`
+	MaxParts                 int                `key:"max_parts" desc:"max parts the message is split into, longer messages are rejected unless truncation is allowed"`
+	MaxRecipients            int                `key:"max_recipients" desc:"max recipients of one submitted message, messages with more recipients are rejected"`
+	UDHReference             string             `key:"udh_reference" desc:"size of the reference number of the split messages: 8bit, 16bit or auto (16bit while 8bit one would wrap within udh_reassembly_window)"`
+	UDHReassemblyWindow      time.Duration      `key:"udh_reassembly_window" desc:"time the handset is expected to wait for the rest of the split message parts (reference number isn't reused for the recipient within it)"`
+	ScheduleHorizon          time.Duration      `key:"schedule_horizon" desc:"how far in the future the message could be scheduled"`
+	ShutdownTimeout          time.Duration      `key:"shutdown_timeout" desc:"time given to finish active requests and to send pending messages before the exit"`
+	LogLevel                 string             `key:"log_level" desc:"lowest level of the written log entries: debug, info or error"`
+}
+
+// Default returns the configuration that is used if the settings are not provided
+func Default() *Config {
+	return &Config{
+		SMSProvider:              "messagebird",
+		SimulatorAddress:         ":8082",
+		SimulatorLatency:         100 * time.Millisecond,
+		SimulatorMaxRecipients:   MessageBirdMaxRecipients,
+		MessageBirdMaxRecipients: MessageBirdMaxRecipients,
+		ServerAddress:            ":8081",
+		QueueStoragePath:         "./queue.log",
+		DeadLetterStoragePath:    "./dead_letters.log",
+		QueueTick:                time.Second,
+		IdempotencyTTL:           24 * time.Hour,
+		StatusTTL:                24 * time.Hour,
+		PriorityAging:            30 * time.Second,
+		RetryMaxAttempts:         5,
+		RetryBaseDelay:           2 * time.Second,
+		RetryMaxDelay:            5 * time.Minute,
+		RateLimit:                1,
+		RateBurst:                1,
+		OriginatorRateLimits:     map[string]float64{},
+		OriginatorRateBurst:      1,
+		MaxParts:                 9,
+		MaxRecipients:            1000,
+		UDHReference:             "auto",
+		UDHReassemblyWindow:      24 * time.Hour,
+		ScheduleHorizon:          30 * 24 * time.Hour,
+		ShutdownTimeout:          30 * time.Second,
+		LogLevel:                 "info",
+	}
+}
+
+// InvalidError describes the setting that couldn't be read or has invalid value
+type InvalidError struct {
+	Key    string
+	Reason string
+}
+
+// Error returns the key of the setting together with the reason
+func (e *InvalidError) Error() string {
+	return e.Key + ": " + e.Reason
+}
+
+// InvalidErrors are all the invalid settings of the configuration
+type InvalidErrors []*InvalidError
+
+// Error returns all the invalid settings
+func (e InvalidErrors) Error() string {
+	s := make([]string, len(e))
+
+	for i, err := range e {
+		s[i] = err.Error()
+	}
+
+	return strings.Join(s, "; ")
+}
+
+// Load reads the configuration from the file, environment variables and command-line arguments (without the program name).
+// The file is set with --config flag or CONFIG environment variable. It also returns if --print-config flag was set,
+// then the configuration isn't validated, so even the invalid one could be printed
+func Load(args []string, env func(string) (string, bool)) (*Config, bool, error) {
+	fs := flag.NewFlagSet("birdfeeder", flag.ContinueOnError)
+	path := fs.String("config", "", "path to the YAML or JSON config file ("+EnvPrefix+"CONFIG)")
+	printConfig := fs.Bool("print-config", false, "print the configuration with redacted secrets and exit")
+
+	c := Default()
+
+	for _, f := range c.fields() {
+		fs.String(flagName(f.Key), "", f.Desc+" ("+envName(f.Key)+")")
+	}
+
+	if err := fs.Parse(args); err != nil {
+		return nil, false, err
+	}
+
+	if *path == "" {
+		*path, _ = env(EnvPrefix + "CONFIG")
+	}
+
+	if *path != "" {
+		if err := c.loadFile(*path); err != nil {
+			return nil, false, err
+		}
+	}
+
+	var errs InvalidErrors
+
+	for _, f := range c.fields() {
+		if v, ok := env(envName(f.Key)); ok {
+			errs = appendInvalid(errs, f.set(v))
+		}
+	}
+
+	fs.Visit(func(fl *flag.Flag) {
+		if f, ok := c.field(strings.Replace(fl.Name, "-", "_", -1)); ok {
+			errs = appendInvalid(errs, f.set(fl.Value.String()))
+		}
+	})
+
+	if len(errs) > 0 {
+		return nil, false, errs
+	}
+
+	if *printConfig {
+		return c, true, nil
+	}
+
+	if err := c.Validate(); err != nil {
+		return nil, false, err
+	}
+
+	return c, *printConfig, nil
+}
+
+// loadFile reads the settings from YAML or JSON file (JSON is a subset of YAML)
+func (c *Config) loadFile(path string) error {
+	b, err := ioutil.ReadFile(path)
+
+	if err != nil {
+		return err
+	}
+
+	values := map[string]interface{}{}
+
+	if err := yaml.Unmarshal(b, &values); err != nil {
+		return fmt.Errorf("%s: %v", path, err)
+	}
+
+	var errs InvalidErrors
+
+	for k, v := range values {
+		f, ok := c.field(k)
+
+		if !ok {
+			errs = append(errs, &InvalidError{k, "unknown setting"})
+			continue
+		}
+
+		errs = appendInvalid(errs, f.set(fileValue(v)))
+	}
+
+	if len(errs) > 0 {
+		return errs
+	}
+
+	return nil
+}
+
+// fileValue converts the value from the file to the same form as the value of the environment variable
+func fileValue(v interface{}) string {
+	switch t := v.(type) {
+	case nil:
+		return ""
+	case map[interface{}]interface{}:
+		pairs := make([]string, 0, len(t))
+
+		for k, i := range t {
+			pairs = append(pairs, fmt.Sprintf("%v=%v", k, i))
+		}
+
+		sort.Strings(pairs)
+
+		return strings.Join(pairs, ",")
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+// Validate checks that all the settings have acceptable values
+func (c *Config) Validate() error {
+	var errs InvalidErrors
+
+	check := func(ok bool, key string, reason string) {
+		if !ok {
+			errs = append(errs, &InvalidError{key, reason})
+		}
+	}
+
+	check(c.SMSProvider == "messagebird" || c.SMSProvider == "simulator", "sms_provider", "should be messagebird or simulator")
+	check(c.SMSProvider != "messagebird" || c.MessageBirdKey != "", "messagebird_key", "must have a value for messagebird provider")
+	check(c.SimulatorFailureRate >= 0 && c.SimulatorFailureRate <= 1, "simulator_failure_rate", "should be between 0 and 1")
+	check(c.SimulatorLatency >= 0, "simulator_latency", "should not be negative")
+	check(c.SimulatorMaxRecipients >= 0, "simulator_max_recipients", "should not be negative")
+	check(c.MessageBirdMaxRecipients >= 1 && c.MessageBirdMaxRecipients <= MessageBirdMaxRecipients, "messagebird_max_recipients", fmt.Sprintf("should be between 1 and %d", MessageBirdMaxRecipients))
+	check(c.ServerAddress != "", "server_address", "must have a value")
+	check(c.QueueTick > 0, "queue_tick", "should be positive")
+	check(c.IdempotencyTTL > 0, "idempotency_ttl", "should be positive")
+	check(c.StatusTTL > 0, "status_ttl", "should be positive")
+	check(c.PriorityAging >= 0, "priority_aging", "should not be negative")
+	check(c.RetryMaxAttempts >= 1, "retry_max_attempts", "should be at least 1")
+	check(c.RetryBaseDelay >= 0, "retry_base_delay", "should not be negative")
+	check(c.RetryMaxDelay >= c.RetryBaseDelay, "retry_max_delay", "should not be shorter than retry_base_delay")
+	check(c.RateLimit >= 0, "rate_limit", "should not be negative")
+	check(c.RateBurst >= 1, "rate_burst", "should be at least 1")
+	check(c.OriginatorRateBurst >= 1, "originator_rate_burst", "should be at least 1")
+	check(c.MaxParts >= 1 && c.MaxParts <= 255, "max_parts", "should be between 1 and 255")
+	check(c.MaxRecipients >= 1, "max_recipients", "should be at least 1")
+	check(c.UDHReference == "8bit" || c.UDHReference == "16bit" || c.UDHReference == "auto", "udh_reference", "should be 8bit, 16bit or auto")
+	check(c.UDHReassemblyWindow > 0, "udh_reassembly_window", "should be positive")
+	check(c.ScheduleHorizon > 0, "schedule_horizon", "should be positive")
+	check(c.ShutdownTimeout > 0, "shutdown_timeout", "should be positive")
+	check(c.LogLevel == "debug" || c.LogLevel == "info" || c.LogLevel == "error", "log_level", "should be debug, info or error")
+
+	for o, r := range c.OriginatorRateLimits {
+		check(r > 0, "originator_rate_limits", fmt.Sprintf("limit of %q should be positive", o))
+	}
+
+	if len(errs) > 0 {
+		return errs
+	}
+
+	return nil
+}
+
+// Print writes the configuration as YAML (so it could be used as the config file). Values of the secrets are redacted
+func (c *Config) Print(w io.Writer) error {
+	values := map[string]interface{}{}
+
+	for _, f := range c.fields() {
+		v := f.Value.Interface()
+
+		if d, ok := v.(time.Duration); ok {
+			v = d.String()
+		}
+
+		if f.Secret && f.Value.String() != "" {
+			v = redacted
+		}
+
+		values[f.Key] = v
+	}
+
+	b, err := yaml.Marshal(values)
+
+	if err != nil {
+		return err
+	}
+
+	_, err = w.Write(b)
+
+	return err
+}
+
+// field is a setting of the configuration
+type field struct {
+	Key    string
+	Desc   string
+	Secret bool
+	Value  reflect.Value
+}
+
+func (c *Config) fields() []*field {
+	v := reflect.ValueOf(c).Elem()
+	t := v.Type()
+	fs := make([]*field, t.NumField())
+
+	for i := range fs {
+		tag := t.Field(i).Tag
+		fs[i] = &field{tag.Get("key"), tag.Get("desc"), tag.Get("secret") == "true", v.Field(i)}
+	}
+
+	return fs
+}
+
+func (c *Config) field(key string) (*field, bool) {
+	for _, f := range c.fields() {
+		if f.Key == key {
+			return f, true
+		}
+	}
+
+	return nil, false
+}
+
+var durationType = reflect.TypeOf(time.Duration(0))
+
+// set parses the value according to the type of the setting
+func (f *field) set(s string) *InvalidError {
+	s = strings.TrimSpace(s)
+
+	switch {
+	case f.Value.Type() == durationType:
+		d, err := time.ParseDuration(s)
+
+		if err != nil {
+			return &InvalidError{f.Key, "should be a duration (e.g. 1s, 500ms)"}
+		}
+
+		f.Value.SetInt(int64(d))
+	case f.Value.Kind() == reflect.String:
+		f.Value.SetString(s)
+	case f.Value.Kind() == reflect.Int:
+		i, err := strconv.Atoi(s)
+
+		if err != nil {
+			return &InvalidError{f.Key, "should be an integer"}
+		}
+
+		f.Value.SetInt(int64(i))
+	case f.Value.Kind() == reflect.Float64:
+		n, err := strconv.ParseFloat(s, 64)
+
+		if err != nil {
+			return &InvalidError{f.Key, "should be a number"}
+		}
+
+		f.Value.SetFloat(n)
+	case f.Value.Kind() == reflect.Map:
+		m, err := parseLimits(s)
+
+		if err != nil {
+			return &InvalidError{f.Key, "should be a list of key=number pairs separated by comma"}
+		}
+
+		f.Value.Set(reflect.ValueOf(m))
+	}
+
+	return nil
+}
+
+func parseLimits(s string) (map[string]float64, error) {
+	m := map[string]float64{}
+
+	if s == "" {
+		return m, nil
+	}
+
+	for _, pair := range strings.Split(s, ",") {
+		kv := strings.SplitN(pair, "=", 2)
+
+		if len(kv) != 2 {
+			return nil, fmt.Errorf("invalid pair %q", pair)
+		}
+
+		n, err := strconv.ParseFloat(strings.TrimSpace(kv[1]), 64)
+
+		if err != nil {
+			return nil, err
+		}
+
+		m[strings.TrimSpace(kv[0])] = n
+	}
+
+	return m, nil
+}
+
+func appendInvalid(errs InvalidErrors, err *InvalidError) InvalidErrors {
+	if err == nil {
+		return errs
+	}
+
+	return append(errs, err)
+}
+
+func envName(key string) string {
+	return EnvPrefix + strings.ToUpper(key)
+}
+
+func flagName(key string) string {
+	return strings.Replace(key, "_", "-", -1)
+}
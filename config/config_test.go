@@ -0,0 +1,206 @@
+package config_test
+
+import (
+	"bytes"
+	"config"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// env returns lookup function for the provided environment variables
+func env(vars map[string]string) func(string) (string, bool) {
+	return func(k string) (string, bool) {
+		v, ok := vars[k]
+		return v, ok
+	}
+}
+
+// file writes config file into temporary directory and returns its path
+func file(t *testing.T, name string, content string) string {
+	dir, err := ioutil.TempDir("", "config")
+	assert.Nil(t, err)
+
+	p := filepath.Join(dir, name)
+	assert.Nil(t, ioutil.WriteFile(p, []byte(content), 0600))
+
+	return p
+}
+
+func TestLoad(t *testing.T) {
+	t.Run("defaults are used if nothing is provided", func(t *testing.T) {
+		c, printConfig, err := config.Load(nil, env(map[string]string{"BIRDFEEDER_MESSAGEBIRD_KEY": "key"}))
+
+		expected := config.Default()
+		expected.MessageBirdKey = "key"
+
+		assert.Nil(t, err)
+		assert.False(t, printConfig)
+		assert.Equal(t, expected, c)
+	})
+
+	t.Run("flags take precedence over environment variables and environment variables over file", func(t *testing.T) {
+		p := file(t, "config.yaml", `
+server_address: ":9000"
+queue_tick: 2s
+max_parts: 3
+messagebird_key: file
+originator_rate_limits:
+  slow: 0.5
+`)
+		defer os.RemoveAll(filepath.Dir(p))
+
+		c, _, err := config.Load([]string{"--config", p, "--max-parts", "5"}, env(map[string]string{
+			"BIRDFEEDER_QUEUE_TICK": "500ms",
+			"BIRDFEEDER_MAX_PARTS":  "4",
+		}))
+
+		assert.Nil(t, err)
+		assert.Equal(t, ":9000", c.ServerAddress)
+		assert.Equal(t, "file", c.MessageBirdKey)
+		assert.Equal(t, 500*time.Millisecond, c.QueueTick)
+		assert.Equal(t, 5, c.MaxParts)
+		assert.Equal(t, map[string]float64{"slow": 0.5}, c.OriginatorRateLimits)
+	})
+
+	t.Run("reads JSON file set by environment variable", func(t *testing.T) {
+		p := file(t, "config.json", `{"sms_provider": "simulator", "simulator_failure_rate": 0.25}`)
+		defer os.RemoveAll(filepath.Dir(p))
+
+		c, _, err := config.Load(nil, env(map[string]string{"BIRDFEEDER_CONFIG": p}))
+
+		assert.Nil(t, err)
+		assert.Equal(t, "simulator", c.SMSProvider)
+		assert.Equal(t, 0.25, c.SimulatorFailureRate)
+	})
+
+	t.Run("reads originator limits from the list of pairs", func(t *testing.T) {
+		c, _, err := config.Load([]string{"--sms-provider=simulator", "--originator-rate-limits", "a=1, b=0.5"}, env(nil))
+
+		assert.Nil(t, err)
+		assert.Equal(t, map[string]float64{"a": 1, "b": 0.5}, c.OriginatorRateLimits)
+	})
+
+	t.Run("returns print-config flag", func(t *testing.T) {
+		_, printConfig, err := config.Load([]string{"--print-config", "--sms-provider", "simulator"}, env(nil))
+
+		assert.Nil(t, err)
+		assert.True(t, printConfig)
+	})
+
+	t.Run("invalid configuration is returned to be printed", func(t *testing.T) {
+		c, printConfig, err := config.Load([]string{"--print-config", "--queue-tick", "0s"}, env(nil))
+
+		assert.Nil(t, err)
+		assert.True(t, printConfig)
+		assert.Equal(t, time.Duration(0), c.QueueTick)
+	})
+
+	t.Run("returns all the values of the wrong type", func(t *testing.T) {
+		_, _, err := config.Load([]string{"--queue-tick", "often", "--rate-burst", "1.5"}, env(map[string]string{"BIRDFEEDER_RATE_LIMIT": "fast"}))
+
+		assert.Equal(t, config.InvalidErrors{
+			{Key: "rate_limit", Reason: "should be a number"},
+			{Key: "queue_tick", Reason: "should be a duration (e.g. 1s, 500ms)"},
+			{Key: "rate_burst", Reason: "should be an integer"},
+		}, err)
+	})
+
+	t.Run("returns error for unknown setting within the file", func(t *testing.T) {
+		p := file(t, "config.yaml", "messagebird_key: key\nunknown: 1\n")
+		defer os.RemoveAll(filepath.Dir(p))
+
+		_, _, err := config.Load([]string{"--config", p}, env(nil))
+
+		assert.Equal(t, config.InvalidErrors{{Key: "unknown", Reason: "unknown setting"}}, err)
+	})
+
+	t.Run("returns error for missing file", func(t *testing.T) {
+		_, _, err := config.Load([]string{"--config", "/missing/config.yaml"}, env(nil))
+
+		assert.NotNil(t, err)
+	})
+
+	t.Run("returns error for unknown flag", func(t *testing.T) {
+		_, _, err := config.Load([]string{"--unknown"}, env(nil))
+
+		assert.NotNil(t, err)
+	})
+}
+
+func TestConfig_Validate(t *testing.T) {
+	t.Run("default configuration requires MessageBird key", func(t *testing.T) {
+		assert.Equal(t, config.InvalidErrors{{Key: "messagebird_key", Reason: "must have a value for messagebird provider"}}, config.Default().Validate())
+	})
+
+	t.Run("returns all the invalid settings", func(t *testing.T) {
+		c := config.Default()
+		c.SMSProvider = "simulator"
+		c.QueueTick = 0
+		c.IdempotencyTTL = 0
+		c.StatusTTL = -time.Second
+		c.SimulatorMaxRecipients = -1
+		c.MessageBirdMaxRecipients = 51
+		c.PriorityAging = -time.Second
+		c.MaxParts = 256
+		c.MaxRecipients = 0
+		c.UDHReference = "32bit"
+		c.RetryMaxDelay = time.Second
+		c.LogLevel = "verbose"
+		c.OriginatorRateLimits = map[string]float64{"o": 0}
+
+		assert.Equal(t, config.InvalidErrors{
+			{Key: "simulator_max_recipients", Reason: "should not be negative"},
+			{Key: "messagebird_max_recipients", Reason: "should be between 1 and 50"},
+			{Key: "queue_tick", Reason: "should be positive"},
+			{Key: "idempotency_ttl", Reason: "should be positive"},
+			{Key: "status_ttl", Reason: "should be positive"},
+			{Key: "priority_aging", Reason: "should not be negative"},
+			{Key: "retry_max_delay", Reason: "should not be shorter than retry_base_delay"},
+			{Key: "max_parts", Reason: "should be between 1 and 255"},
+			{Key: "max_recipients", Reason: "should be at least 1"},
+			{Key: "udh_reference", Reason: "should be 8bit, 16bit or auto"},
+			{Key: "log_level", Reason: "should be debug, info or error"},
+			{Key: "originator_rate_limits", Reason: `limit of "o" should be positive`},
+		}, c.Validate())
+	})
+
+	t.Run("error contains all the invalid settings", func(t *testing.T) {
+		err := config.InvalidErrors{{Key: "a", Reason: "is wrong"}, {Key: "b", Reason: "is wrong too"}}
+
+		assert.Equal(t, "a: is wrong; b: is wrong too", err.Error())
+	})
+}
+
+func TestConfig_Print(t *testing.T) {
+	c := config.Default()
+	c.MessageBirdKey = "secret"
+
+	buf := &bytes.Buffer{}
+	assert.Nil(t, c.Print(buf))
+
+	t.Run("secrets are redacted", func(t *testing.T) {
+		assert.NotContains(t, buf.String(), "secret")
+		assert.Contains(t, buf.String(), "messagebird_key: REDACTED\n")
+	})
+
+	t.Run("empty secrets are shown as empty", func(t *testing.T) {
+		assert.Contains(t, buf.String(), `status_report_signing_key: ""`)
+	})
+
+	t.Run("printed configuration could be read back", func(t *testing.T) {
+		p := file(t, "config.yaml", buf.String())
+		defer os.RemoveAll(filepath.Dir(p))
+
+		restored, _, err := config.Load([]string{"--config", p}, env(nil))
+
+		c.MessageBirdKey = "REDACTED"
+
+		assert.Nil(t, err)
+		assert.Equal(t, c, restored)
+	})
+}
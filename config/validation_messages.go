@@ -3,8 +3,14 @@ package config
 // ValidationMessages vocabulary
 var ValidationMessages = map[string]string{
 	"required":              "must have a value",
+	"requiredwithout":       "either recipient or recipients must have a value",
+	"scheduled":             "should be a future time within the scheduling horizon",
 	"msisdn":                "should be a valid MSISDN",
 	"textoriginator|msisdn": "use valid MSISDN or alphanumeric value (max. 11 symbols long)",
 	"textoriginator":        "use alphanumeric value (max. 11 symbols long)",
-	"max":                   "outreached limit for characters amount (max. 1377 for plain and 603 for unicode)",
+	"maxparts":              "needs {0} parts which is more than allowed",
+	"partslimit":            "should be between 1 and {0}",
+	"maxrecipients":         "should have at most {0} recipients",
+	"oneof":                 "should be one of {0}",
+	"approvedoriginator":    "should be an originator approved for the API key",
 }
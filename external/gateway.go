@@ -0,0 +1,45 @@
+package external
+
+import (
+	"time"
+	"utils"
+)
+
+// SMS is the provider-neutral message part that is sent to all the recipients at once
+type SMS struct {
+	Originator  string           `json:"originator"`
+	Recipients  []string         `json:"recipients"`
+	Body        string           `json:"body"` // already encoded message part
+	UDH         string           `json:"udh"`
+	DataCoding  utils.Datacoding `json:"datacoding"`
+	ScheduledAt time.Time        `json:"scheduled_at"` // zero time means the message is delivered right away
+}
+
+// SendResult is the response of the SMS provider on the accepted message
+type SendResult struct {
+	ID string // identifier the provider assigned to the message
+}
+
+// SMSGateway sends messages to the SMS provider
+type SMSGateway interface {
+	Send(s *SMS) (*SendResult, error)
+}
+
+// SendError is returned by SMSGateway if the provider didn't accept the message
+type SendError struct {
+	Reason    string
+	Permanent bool // provider rejected the message, so there is no reason to send it again
+}
+
+// Error returns the reason of the failure
+func (e *SendError) Error() string {
+	return e.Reason
+}
+
+// IsPermanentError checks if the provider rejected the message so there is no reason to send it again.
+// All the errors that are not SendError (e.g. network errors) are considered to be temporary
+func IsPermanentError(err error) bool {
+	e, ok := err.(*SendError)
+
+	return ok && e.Permanent
+}
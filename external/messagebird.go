@@ -1,6 +1,7 @@
 package external
 
 import (
+	"fmt"
 	"time"
 	"utils"
 
@@ -18,8 +19,9 @@ func InitMessageBirdClient(key string) MessageBirdClient {
 	return mb.New(key)
 }
 
-// InitMessageBirdParams is a factory method for MessageBird MessageParams
-func InitMessageBirdParams(dc utils.Datacoding, udh string) *mb.MessageParams {
+// InitMessageBirdParams is a factory method for MessageBird MessageParams. Message is delivered right away
+// if scheduled time is zero
+func InitMessageBirdParams(dc utils.Datacoding, udh string, scheduledAt time.Time) *mb.MessageParams {
 	td := mb.TypeDetails{}
 
 	if udh != "" {
@@ -33,6 +35,82 @@ func InitMessageBirdParams(dc utils.Datacoding, udh string) *mb.MessageParams {
 		Gateway:           0,
 		TypeDetails:       td,
 		DataCoding:        string(dc),
-		ScheduledDatetime: time.Time{},
+		ScheduledDatetime: scheduledAt,
 	}
 }
+
+// permanentErrorCodes are MessageBird API error codes that won't disappear if the same request is sent again
+var permanentErrorCodes = map[int]bool{
+	2:  true, // request not allowed
+	9:  true, // missing params
+	10: true, // invalid params
+	20: true, // not found
+	21: true, // bad request
+	98: true, // not found
+}
+
+type messageBirdGateway struct {
+	Client MessageBirdClient
+}
+
+// InitMessageBirdGateway is SMSGateway factory method that sends the messages with the provided MessageBird client
+func InitMessageBirdGateway(c MessageBirdClient) SMSGateway {
+	return &messageBirdGateway{c}
+}
+
+// Send submits message to the MessageBird API. MessageBird errors are returned as SendError
+func (g *messageBirdGateway) Send(s *SMS) (*SendResult, error) {
+	params := InitMessageBirdParams(s.DataCoding, s.UDH, s.ScheduledAt)
+	m, err := g.Client.NewMessage(s.Originator, s.Recipients, s.Body, params)
+
+	if err != nil {
+		return nil, &SendError{messageBirdFailureReason(m, err), isPermanentMessageBirdError(err, m)}
+	}
+
+	r := &SendResult{}
+
+	if m != nil {
+		r.ID = m.Id
+	}
+
+	return r, nil
+}
+
+// isPermanentMessageBirdError checks if MessageBird API rejected the message so there is no reason to send it again.
+// Network errors and server errors (5xx) are considered to be temporary
+func isPermanentMessageBirdError(err error, m *mb.Message) bool {
+	if err != mb.ErrResponse {
+		return false
+	}
+
+	if m == nil {
+		return true
+	}
+
+	for _, e := range m.Errors {
+		if !permanentErrorCodes[e.Code] {
+			return false
+		}
+	}
+
+	return true
+}
+
+// messageBirdFailureReason describes the error including the errors returned by MessageBird API
+func messageBirdFailureReason(m *mb.Message, err error) string {
+	reason := err.Error()
+
+	if m == nil {
+		return reason
+	}
+
+	for _, e := range m.Errors {
+		reason += fmt.Sprintf("; %d: %s", e.Code, e.Description)
+
+		if e.Parameter != "" {
+			reason += fmt.Sprintf(" (%s)", e.Parameter)
+		}
+	}
+
+	return reason
+}
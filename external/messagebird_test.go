@@ -1,7 +1,9 @@
 package external_test
 
 import (
+	"errors"
 	"external"
+	"mocks"
 	"reflect"
 	"testing"
 
@@ -25,7 +27,7 @@ func TestInitMessageBirdParams(t *testing.T) {
 	t.Run("returns struct with empty udh if udh is empty string", func(t *testing.T) {
 		dc := "plain"
 
-		params := external.InitMessageBirdParams(utils.Datacoding(dc), "")
+		params := external.InitMessageBirdParams(utils.Datacoding(dc), "", time.Time{})
 		expected := &mb.MessageParams{
 			Type:              "binary",
 			Reference:         "",
@@ -43,7 +45,7 @@ func TestInitMessageBirdParams(t *testing.T) {
 		dc := "plain"
 		udh := "udh"
 
-		params := external.InitMessageBirdParams(utils.Datacoding(dc), udh)
+		params := external.InitMessageBirdParams(utils.Datacoding(dc), udh, time.Time{})
 		expected := &mb.MessageParams{
 			Type:              "binary",
 			Reference:         "",
@@ -56,4 +58,65 @@ func TestInitMessageBirdParams(t *testing.T) {
 
 		assert.Equal(t, expected, params)
 	})
+
+	t.Run("returns struct with scheduled time", func(t *testing.T) {
+		at := time.Date(2017, 1, 1, 10, 0, 0, 0, time.UTC)
+
+		params := external.InitMessageBirdParams(utils.Plain, "", at)
+
+		assert.Equal(t, at, params.ScheduledDatetime)
+	})
+}
+
+func TestMessageBirdGateway_Send(t *testing.T) {
+	sms := &external.SMS{
+		Originator:  "MessageBird",
+		Recipients:  []string{"31612345678"},
+		Body:        "626f6479",
+		UDH:         "050003010201",
+		DataCoding:  utils.Plain,
+		ScheduledAt: time.Date(2017, 1, 1, 10, 0, 0, 0, time.UTC),
+	}
+
+	send := func(m *mb.Message, err error) (*external.SendResult, error) {
+		c := &mocks.ExternalMessageBirdClientMock{}
+		c.On("NewMessage", sms.Originator, sms.Recipients, sms.Body, external.InitMessageBirdParams(sms.DataCoding, sms.UDH, sms.ScheduledAt)).Return(m, err)
+
+		return external.InitMessageBirdGateway(c).Send(sms)
+	}
+
+	t.Run("returns messagebird message id", func(t *testing.T) {
+		r, err := send(&mb.Message{Id: "mb"}, nil)
+
+		assert.Nil(t, err)
+		assert.Equal(t, "mb", r.ID)
+	})
+
+	t.Run("network error is temporary", func(t *testing.T) {
+		_, err := send(&mb.Message{}, errors.New("connection refused"))
+
+		assert.False(t, external.IsPermanentError(err))
+		assert.Equal(t, "connection refused", err.Error())
+	})
+
+	t.Run("server error is temporary", func(t *testing.T) {
+		_, err := send(&mb.Message{}, mb.ErrUnexpectedResponse)
+
+		assert.False(t, external.IsPermanentError(err))
+	})
+
+	t.Run("invalid params error is permanent", func(t *testing.T) {
+		m := &mb.Message{Errors: []mb.Error{{Code: 10, Description: "no (correct) recipients found", Parameter: "recipient"}}}
+		_, err := send(m, mb.ErrResponse)
+
+		assert.True(t, external.IsPermanentError(err))
+		assert.Equal(t, "The MessageBird API returned an error; 10: no (correct) recipients found (recipient)", err.Error())
+	})
+
+	t.Run("not enough balance error is temporary", func(t *testing.T) {
+		m := &mb.Message{Errors: []mb.Error{{Code: 25, Description: "not enough balance"}}}
+		_, err := send(m, mb.ErrResponse)
+
+		assert.False(t, external.IsPermanentError(err))
+	})
 }
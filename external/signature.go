@@ -0,0 +1,43 @@
+package external
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// signatureTolerance is how old (or how far in the future) the signed webhook request could be
+const signatureTolerance = 5 * time.Minute
+
+// MessageBirdSignature calculates the signature MessageBird sends within MessageBird-Signature header of the webhook.
+// It's HMAC-SHA256 of the request timestamp, sorted query parameters and SHA256 of the request body
+func MessageBirdSignature(key string, timestamp string, query url.Values, body []byte) string {
+	b := sha256.Sum256(body)
+
+	h := hmac.New(sha256.New, []byte(key))
+	h.Write([]byte(timestamp + "\n" + query.Encode() + "\n"))
+	h.Write(b[:])
+
+	return base64.StdEncoding.EncodeToString(h.Sum(nil))
+}
+
+// VerifyMessageBirdSignature checks if the webhook request was signed by MessageBird with the shared signing key
+// close enough to the provided time, so the recorded request can't be replayed later
+func VerifyMessageBirdSignature(key string, signature string, timestamp string, query url.Values, body []byte, now time.Time) bool {
+	sec, err := strconv.ParseInt(timestamp, 10, 64)
+
+	if key == "" || signature == "" || err != nil {
+		return false
+	}
+
+	d := now.Sub(time.Unix(sec, 0))
+
+	if d > signatureTolerance || d < -signatureTolerance {
+		return false
+	}
+
+	return hmac.Equal([]byte(signature), []byte(MessageBirdSignature(key, timestamp, query, body)))
+}
@@ -0,0 +1,50 @@
+package external_test
+
+import (
+	"external"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestVerifyMessageBirdSignature(t *testing.T) {
+	key := "key"
+	ts := "1504254005"
+	q := url.Values{"b": {"2"}, "a": {"1"}}
+	body := []byte("body")
+	now := time.Unix(1504254005, 0)
+
+	s := external.MessageBirdSignature(key, ts, q, body)
+
+	t.Run("valid signature", func(t *testing.T) {
+		assert.True(t, external.VerifyMessageBirdSignature(key, s, ts, q, body, now))
+	})
+
+	t.Run("query parameters order doesn't matter", func(t *testing.T) {
+		assert.Equal(t, s, external.MessageBirdSignature(key, ts, url.Values{"a": {"1"}, "b": {"2"}}, body))
+	})
+
+	t.Run("not valid if anything was changed", func(t *testing.T) {
+		assert.False(t, external.VerifyMessageBirdSignature("other", s, ts, q, body, now))
+		assert.False(t, external.VerifyMessageBirdSignature(key, s, "1504254006", q, body, now))
+		assert.False(t, external.VerifyMessageBirdSignature(key, s, ts, url.Values{"a": {"2"}}, body, now))
+		assert.False(t, external.VerifyMessageBirdSignature(key, s, ts, q, []byte("other"), now))
+	})
+
+	t.Run("valid within the tolerance only", func(t *testing.T) {
+		assert.True(t, external.VerifyMessageBirdSignature(key, s, ts, q, body, now.Add(5*time.Minute)))
+		assert.True(t, external.VerifyMessageBirdSignature(key, s, ts, q, body, now.Add(-5*time.Minute)))
+		assert.False(t, external.VerifyMessageBirdSignature(key, s, ts, q, body, now.Add(5*time.Minute+time.Second)))
+		assert.False(t, external.VerifyMessageBirdSignature(key, s, ts, q, body, now.Add(-5*time.Minute-time.Second)))
+	})
+
+	t.Run("not valid without timestamp", func(t *testing.T) {
+		assert.False(t, external.VerifyMessageBirdSignature(key, external.MessageBirdSignature(key, "", q, body), "", q, body, now))
+	})
+
+	t.Run("not valid without signing key", func(t *testing.T) {
+		assert.False(t, external.VerifyMessageBirdSignature("", external.MessageBirdSignature("", ts, q, body), ts, q, body, now))
+	})
+}
@@ -0,0 +1,131 @@
+package external
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"sync"
+	"time"
+	"utils"
+)
+
+// Simulator is SMSGateway that doesn't send anything but records all the received messages.
+// Received messages are exposed over HTTP, so it could be used for the integration tests
+type Simulator interface {
+	SMSGateway
+	http.Handler
+	Received() []*SimulatedSMS
+	Reset()
+}
+
+// SimulatorConfig defines the behaviour of the simulated provider
+type SimulatorConfig struct {
+	Latency            time.Duration   // time it takes to respond
+	FailureRate        float64         // probability (0..1) of the temporary failure
+	RejectedRecipients map[string]bool // messages to these recipients are always rejected permanently
+	MaxRecipients      int             // messages to more recipients are rejected permanently (not limited if zero)
+	RandomSource       rand.Source     // source for the failures injection (seeded with the current time if nil)
+}
+
+// SimulatedSMS is the message received by the simulator
+type SimulatedSMS struct {
+	*SMS
+	ID         string    `json:"id"`
+	ReceivedAt time.Time `json:"received_at"`
+	Error      string    `json:"error,omitempty"`
+}
+
+type simulator struct {
+	Mutex    *sync.Mutex
+	Clock    utils.Clock
+	Config   SimulatorConfig
+	Random   *rand.Rand
+	Messages []*SimulatedSMS
+}
+
+// InitSimulator is Simulator factory method
+func InitSimulator(c utils.Clock, cfg SimulatorConfig) Simulator {
+	src := cfg.RandomSource
+
+	if src == nil {
+		src = rand.NewSource(time.Now().UnixNano())
+	}
+
+	return &simulator{&sync.Mutex{}, c, cfg, rand.New(src), []*SimulatedSMS{}}
+}
+
+// Send records the message after the configured latency. Failures are injected accordingly to the config
+func (s *simulator) Send(sms *SMS) (*SendResult, error) {
+	if s.Config.Latency > 0 {
+		<-s.Clock.After(s.Config.Latency)
+	}
+
+	s.Mutex.Lock()
+	defer s.Mutex.Unlock()
+
+	// copy the message so later changes of the sent one don't affect the record
+	c := *sms
+	c.Recipients = append([]string{}, sms.Recipients...)
+
+	m := &SimulatedSMS{&c, utils.GenerateID(), s.Clock.Now(), ""}
+	s.Messages = append(s.Messages, m)
+
+	if err := s.failure(sms); err != nil {
+		m.Error = err.Error()
+		return nil, err
+	}
+
+	return &SendResult{m.ID}, nil
+}
+
+func (s *simulator) failure(sms *SMS) error {
+	if s.Config.MaxRecipients > 0 && len(sms.Recipients) > s.Config.MaxRecipients {
+		return &SendError{fmt.Sprintf("simulated rejection of %d recipients", len(sms.Recipients)), true}
+	}
+
+	for _, r := range sms.Recipients {
+		if s.Config.RejectedRecipients[r] {
+			return &SendError{"simulated rejection of the recipient " + r, true}
+		}
+	}
+
+	if s.Config.FailureRate > 0 && s.Random.Float64() < s.Config.FailureRate {
+		return &SendError{"simulated temporary failure", false}
+	}
+
+	return nil
+}
+
+// Received returns all the messages received by the simulator (including failed ones) starting from the oldest
+func (s *simulator) Received() []*SimulatedSMS {
+	s.Mutex.Lock()
+	defer s.Mutex.Unlock()
+
+	r := make([]*SimulatedSMS, len(s.Messages))
+	copy(r, s.Messages)
+
+	return r
+}
+
+// Reset forgets all the received messages
+func (s *simulator) Reset() {
+	s.Mutex.Lock()
+	defer s.Mutex.Unlock()
+
+	s.Messages = []*SimulatedSMS{}
+}
+
+// ServeHTTP renders received messages on GET and forgets them on DELETE
+func (s *simulator) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(s.Received())
+	case http.MethodDelete:
+		s.Reset()
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
@@ -0,0 +1,110 @@
+package external_test
+
+import (
+	"encoding/json"
+	"external"
+	"math/rand"
+	"mocks"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+	"utils"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSimulator_Send(t *testing.T) {
+	now := time.Date(2017, 1, 1, 10, 0, 0, 0, time.UTC)
+	sms := &external.SMS{Originator: "MessageBird", Recipients: []string{"31612345678"}, Body: "body", DataCoding: utils.Plain}
+
+	t.Run("records sent messages", func(t *testing.T) {
+		s := external.InitSimulator(mocks.NewClockMock(now), external.SimulatorConfig{})
+
+		r, err := s.Send(sms)
+
+		assert.Nil(t, err)
+		assert.Len(t, s.Received(), 1)
+		assert.Equal(t, r.ID, s.Received()[0].ID)
+		assert.Equal(t, sms, s.Received()[0].SMS)
+		assert.Equal(t, now, s.Received()[0].ReceivedAt)
+	})
+
+	t.Run("responds after the latency", func(t *testing.T) {
+		c := mocks.NewClockMock(now)
+		s := external.InitSimulator(c, external.SimulatorConfig{Latency: time.Second})
+		done := make(chan bool)
+
+		go func() {
+			s.Send(sms)
+			done <- true
+		}()
+
+		c.BlockUntil(1)
+		assert.Empty(t, s.Received())
+
+		c.Advance(time.Second)
+		<-done
+
+		assert.Equal(t, now.Add(time.Second), s.Received()[0].ReceivedAt)
+	})
+
+	t.Run("rejects configured recipients permanently", func(t *testing.T) {
+		s := external.InitSimulator(mocks.NewClockMock(now), external.SimulatorConfig{RejectedRecipients: map[string]bool{"31612345678": true}})
+
+		_, err := s.Send(sms)
+
+		assert.True(t, external.IsPermanentError(err))
+		assert.Equal(t, err.Error(), s.Received()[0].Error)
+	})
+
+	t.Run("rejects messages to too many recipients permanently", func(t *testing.T) {
+		s := external.InitSimulator(mocks.NewClockMock(now), external.SimulatorConfig{MaxRecipients: 1})
+
+		_, err := s.Send(sms)
+		assert.Nil(t, err)
+
+		_, err = s.Send(&external.SMS{Originator: "MessageBird", Recipients: []string{"31612345678", "31612345679"}, Body: "body"})
+		assert.True(t, external.IsPermanentError(err))
+	})
+
+	t.Run("injects temporary failures with configured rate", func(t *testing.T) {
+		s := external.InitSimulator(mocks.NewClockMock(now), external.SimulatorConfig{FailureRate: 0.5, RandomSource: rand.NewSource(1)})
+		failed := 0
+
+		for i := 0; i < 1000; i++ {
+			if _, err := s.Send(sms); err != nil {
+				assert.False(t, external.IsPermanentError(err))
+				failed++
+			}
+		}
+
+		assert.InDelta(t, 500, failed, 50)
+	})
+}
+
+func TestSimulator_ServeHTTP(t *testing.T) {
+	s := external.InitSimulator(mocks.NewClockMock(time.Now()), external.SimulatorConfig{})
+	s.Send(&external.SMS{Originator: "MessageBird", Recipients: []string{"31612345678"}, Body: "body"})
+
+	t.Run("renders received messages", func(t *testing.T) {
+		rec := httptest.NewRecorder()
+		s.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+
+		var r []map[string]interface{}
+		json.NewDecoder(rec.Body).Decode(&r)
+
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Len(t, r, 1)
+		assert.Equal(t, "body", r[0]["body"])
+		assert.Equal(t, []interface{}{"31612345678"}, r[0]["recipients"])
+	})
+
+	t.Run("forgets received messages", func(t *testing.T) {
+		rec := httptest.NewRecorder()
+		s.ServeHTTP(rec, httptest.NewRequest(http.MethodDelete, "/", nil))
+
+		assert.Equal(t, http.StatusNoContent, rec.Code)
+		assert.Empty(t, s.Received())
+	})
+}
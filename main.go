@@ -2,18 +2,188 @@ package main
 
 import (
 	"api"
+	"api/auth"
 	"config"
+	"context"
 	"external"
+	"flag"
 	"fmt"
+	"net/http"
+	"os"
+	"os/signal"
 	"queue"
+	"syscall"
 	"utils"
 )
 
 func main() {
-	mb := external.InitMessageBirdClient(config.MessageBirdKey)
-	q := queue.InitQueue(mb)
-	udh := utils.InitEncoder()
-	v := utils.InitValidator()
-	err := api.InitServer(config.ServerAddress, v, udh, q).Start()
-	fmt.Println(err)
+	cfg, printConfig, err := config.Load(os.Args[1:], os.LookupEnv)
+
+	if err == flag.ErrHelp {
+		return
+	}
+
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+
+	if printConfig {
+		if err := cfg.Print(os.Stdout); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+
+		return
+	}
+
+	c := utils.InitClock()
+	lvl, _ := utils.ParseLevel(cfg.LogLevel) // log level is already validated
+	lg := utils.InitLogger(os.Stdout, c, lvl)
+
+	var g external.SMSGateway
+
+	// max recipients of one message the provider accepts
+	var mr int
+
+	switch cfg.SMSProvider {
+	case "messagebird":
+		g = external.InitMessageBirdGateway(external.InitMessageBirdClient(cfg.MessageBirdKey))
+		mr = cfg.MessageBirdMaxRecipients
+	case "simulator":
+		sim := external.InitSimulator(c, external.SimulatorConfig{Latency: cfg.SimulatorLatency, FailureRate: cfg.SimulatorFailureRate, MaxRecipients: cfg.SimulatorMaxRecipients})
+		g = sim
+		mr = cfg.SimulatorMaxRecipients
+
+		// received messages are exposed for the integration tests
+		go func() {
+			lg.Error("simulator stopped", utils.Fields{"error": http.ListenAndServe(cfg.SimulatorAddress, sim)})
+		}()
+	default:
+		lg.Error("unknown SMS provider", utils.Fields{"provider": cfg.SMSProvider})
+		os.Exit(1)
+	}
+
+	var ks auth.KeyStore
+
+	if cfg.APIKeysPath != "" {
+		if ks, err = auth.LoadKeyStore(cfg.APIKeysPath); err != nil {
+			lg.Error("unable to load API keys", utils.Fields{"error": err})
+			os.Exit(1)
+		}
+	} else {
+		lg.Info("API keys are not required, the API is open to anyone and admin endpoints are disabled", nil)
+	}
+
+	var reg utils.OriginatorRegistry
+
+	if cfg.OriginatorsPath != "" {
+		if reg, err = utils.InitOriginatorRegistry(cfg.OriginatorsPath); err != nil {
+			lg.Error("unable to load approved originators", utils.Fields{"error": err})
+			os.Exit(1)
+		}
+	}
+
+	st := queue.InitStatusTracker(cfg.StatusTTL, c)
+	s := queue.InitMemoryStorage()
+
+	if cfg.QueueStoragePath != "" {
+		if s, err = queue.InitFileStorage(cfg.QueueStoragePath); err != nil {
+			lg.Error("unable to open queue storage", utils.Fields{"error": err})
+			os.Exit(1)
+		}
+	}
+
+	is := utils.InitIdempotencyStore(cfg.IdempotencyTTL, c)
+
+	if cfg.IdempotencyStoragePath != "" {
+		if is, err = utils.InitFileIdempotencyStore(cfg.IdempotencyStoragePath, cfg.IdempotencyTTL, c); err != nil {
+			lg.Error("unable to open idempotency storage", utils.Fields{"error": err})
+			os.Exit(1)
+		}
+	}
+
+	mt := utils.InitMetrics()
+	dl := queue.InitDeadLetterStore(c)
+
+	if cfg.DeadLetterStoragePath != "" {
+		if dl, err = queue.InitFileDeadLetterStore(cfg.DeadLetterStoragePath, c); err != nil {
+			lg.Error("unable to open dead-letter storage", utils.Fields{"error": err})
+			os.Exit(1)
+		}
+	}
+
+	ol := map[string]queue.Limit{}
+
+	for o, r := range cfg.OriginatorRateLimits {
+		ol[o] = queue.Limit{Rate: r, Burst: cfg.OriginatorRateBurst}
+	}
+
+	l := queue.InitRateLimiter(c, queue.Limit{Rate: cfg.RateLimit, Burst: cfg.RateBurst}, ol)
+	q := queue.InitQueue(queue.Config{
+		Gateway:  g,
+		Tracker:  st,
+		Storage:  s,
+		Retry:    queue.InitRetryPolicy(cfg.RetryMaxAttempts, cfg.RetryBaseDelay, cfg.RetryMaxDelay),
+		Dead:     dl,
+		Limiter:  l,
+		Priority: queue.InitPriorityPolicy(cfg.PriorityAging),
+		Merge:    queue.InitMergePolicy(mr),
+		Clock:    c,
+		Tick:     cfg.QueueTick,
+		Metrics:  mt,
+		Logger:   lg,
+	})
+	udh := utils.InitEncoder(cfg.MaxParts, utils.UDHReference(cfg.UDHReference))
+	refs := utils.InitReferenceAllocator(utils.UDHReference(cfg.UDHReference), cfg.UDHReassemblyWindow, c)
+	v := utils.InitValidator(udh, cfg.ScheduleHorizon, reg, cfg.MaxRecipients, c)
+
+	srv := api.InitServer(cfg.ServerAddress, v, api.Config{
+		Encoder:     udh,
+		References:  refs,
+		Queue:       q,
+		Tracker:     st,
+		Dead:        dl,
+		SigningKey:  cfg.StatusReportSigningKey,
+		Metrics:     mt,
+		Logger:      lg,
+		Keys:        ks,
+		Quota:       auth.InitQuota(c),
+		Originators: reg,
+		Idempotency: is,
+		Clock:       c,
+	})
+
+	errs := make(chan error, 1)
+
+	go func() {
+		errs <- srv.Start()
+	}()
+
+	// stop on SIGINT/SIGTERM so the messages from the queue are not lost
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, syscall.SIGINT, syscall.SIGTERM)
+
+	// server that failed to start (e.g. the address is in use) stops the service with the error code
+	code := 0
+
+	select {
+	case err := <-errs:
+		if err != http.ErrServerClosed {
+			lg.Error("server stopped", utils.Fields{"error": err})
+			code = 1
+		}
+	case received := <-sig:
+		lg.Info("shutting down", utils.Fields{"signal": received.String()})
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.ShutdownTimeout)
+	err = srv.Shutdown(ctx)
+	cancel()
+
+	if err != nil {
+		lg.Error("shutdown not finished", utils.Fields{"error": err})
+	}
+
+	os.Exit(code)
 }
@@ -1,6 +1,7 @@
 // Code generated by mockery v1.0.0
 package mocks
 
+import context "context"
 import mock "github.com/stretchr/testify/mock"
 import models "queue/models"
 
@@ -19,3 +20,31 @@ func (_m *MessageQueue) Push(m ...models.QueueMessage) {
 	_ca = append(_ca, _va...)
 	_m.Called(_ca...)
 }
+
+// Replay provides a mock function with given fields: id
+func (_m *MessageQueue) Replay(id string) bool {
+	ret := _m.Called(id)
+
+	var r0 bool
+	if rf, ok := ret.Get(0).(func(string) bool); ok {
+		r0 = rf(id)
+	} else {
+		r0 = ret.Get(0).(bool)
+	}
+
+	return r0
+}
+
+// Shutdown provides a mock function with given fields: ctx
+func (_m *MessageQueue) Shutdown(ctx context.Context) error {
+	ret := _m.Called(ctx)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context) error); ok {
+		r0 = rf(ctx)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
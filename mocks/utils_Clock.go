@@ -0,0 +1,93 @@
+package mocks
+
+import (
+	"sync"
+	"time"
+)
+
+// ClockMock is utils.Clock mock. Time changes only when it's advanced manually
+type ClockMock struct {
+	mutex   sync.Mutex
+	now     time.Time
+	waiters []*clockWaiter
+	changed chan struct{}
+}
+
+type clockWaiter struct {
+	until time.Time
+	c     chan time.Time
+}
+
+// NewClockMock creates the clock stopped at the provided time
+func NewClockMock(now time.Time) *ClockMock {
+	return &ClockMock{now: now, changed: make(chan struct{}, 1)}
+}
+
+// Now mock
+func (c *ClockMock) Now() time.Time {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	return c.now
+}
+
+// After mock
+func (c *ClockMock) After(d time.Duration) <-chan time.Time {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	w := &clockWaiter{c.now.Add(d), make(chan time.Time, 1)}
+
+	if d <= 0 {
+		w.c <- c.now
+		return w.c
+	}
+
+	c.waiters = append(c.waiters, w)
+
+	select {
+	case c.changed <- struct{}{}:
+	default:
+	}
+
+	return w.c
+}
+
+// Advance moves the time forward and fires all the waiters that are due
+func (c *ClockMock) Advance(d time.Duration) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.now = c.now.Add(d)
+
+	var rest []*clockWaiter
+
+	for _, w := range c.waiters {
+		if w.until.After(c.now) {
+			rest = append(rest, w)
+			continue
+		}
+
+		w.c <- c.now
+	}
+
+	c.waiters = rest
+}
+
+// BlockUntil blocks until the provided amount of goroutines are waiting for the clock
+func (c *ClockMock) BlockUntil(n int) {
+	for {
+		c.mutex.Lock()
+		l := len(c.waiters)
+		c.mutex.Unlock()
+
+		if l >= n {
+			return
+		}
+
+		select {
+		case <-c.changed:
+		case <-time.After(time.Millisecond):
+		}
+	}
+}
@@ -18,13 +18,31 @@ func (um *UDHEncoderMock) Encode(m string) *utils.Encoded {
 }
 
 // GenerateUDH mock
-func (um *UDHEncoderMock) GenerateUDH(p uint8, parts uint8, mesHash uint32) string {
-	args := um.Called(p, parts, mesHash)
+func (um *UDHEncoderMock) GenerateUDH(p uint8, parts uint8, reference uint16, ref utils.UDHReference) string {
+	args := um.Called(p, parts, reference, ref)
 	return args.String(0)
 }
 
 // SplitTextMessage mock
-func (um *UDHEncoderMock) SplitTextMessage(m string) *utils.Encoded {
-	args := um.Called(m)
+func (um *UDHEncoderMock) SplitTextMessage(m string, maxParts int, ref utils.UDHReference) *utils.Encoded {
+	args := um.Called(m, maxParts, ref)
 	return args.Get(0).(*utils.Encoded)
 }
+
+// Preview mock
+func (um *UDHEncoderMock) Preview(m string, maxParts int, ref utils.UDHReference) *utils.Preview {
+	args := um.Called(m, maxParts, ref)
+	return args.Get(0).(*utils.Preview)
+}
+
+// Parts mock
+func (um *UDHEncoderMock) Parts(m string) int {
+	args := um.Called(m)
+	return args.Int(0)
+}
+
+// MaxParts mock
+func (um *UDHEncoderMock) MaxParts() int {
+	args := um.Called()
+	return args.Int(0)
+}
@@ -0,0 +1,172 @@
+package queue
+
+import (
+	qModels "queue/models"
+	"sort"
+	"sync"
+	"utils"
+)
+
+// DeadLetterStore keeps the messages that failed permanently or ran out of attempts
+type DeadLetterStore interface {
+	Add(reason string, parts ...qModels.QueueMessage) ([]*qModels.DeadLetter, error)
+	List() []*qModels.DeadLetter
+	Remove(id string) (*qModels.DeadLetter, bool, error)
+}
+
+type deadLetterStore struct {
+	Mutex   *sync.Mutex
+	Clock   utils.Clock
+	Letters map[string]*qModels.DeadLetter
+}
+
+// InitDeadLetterStore is in-memory DeadLetterStore factory method. Dead letters are not kept after the restart
+func InitDeadLetterStore(c utils.Clock) DeadLetterStore {
+	return initDeadLetterStore(c)
+}
+
+func initDeadLetterStore(c utils.Clock) *deadLetterStore {
+	return &deadLetterStore{&sync.Mutex{}, c, map[string]*qModels.DeadLetter{}}
+}
+
+// Add puts the failed parts of the message to the store. Recipients of the merged messages are kept within the dead
+// letters of the submitted messages they belong to. Parts of the message that already failed (e.g. sent to the other
+// recipients) are added to the same dead letter
+func (s *deadLetterStore) Add(reason string, parts ...qModels.QueueMessage) ([]*qModels.DeadLetter, error) {
+	s.Mutex.Lock()
+	defer s.Mutex.Unlock()
+
+	return s.add(reason, parts), nil
+}
+
+func (s *deadLetterStore) add(reason string, parts []qModels.QueueMessage) []*qModels.DeadLetter {
+	ids, byID := byMessage(parts)
+	result := make([]*qModels.DeadLetter, len(ids))
+
+	for i, id := range ids {
+		result[i] = s.addLetter(id, reason, byID[id])
+	}
+
+	return result
+}
+
+func (s *deadLetterStore) addLetter(id string, reason string, parts []qModels.QueueMessage) *qModels.DeadLetter {
+	if id == "" {
+		id = utils.GenerateID()
+	}
+
+	l, ok := s.Letters[id]
+
+	if !ok {
+		l = &qModels.DeadLetter{ID: id}
+		s.Letters[id] = l
+	}
+
+	l.Reason = reason
+	l.Attempts = parts[0].GetAttempts()
+	l.FailedAt = s.Clock.Now()
+	l.Parts = addParts(l.Parts, parts)
+
+	return l
+}
+
+// byMessage splits the parts by the submitted messages their recipients belong to. It returns the message
+// identifiers in order they are met
+func byMessage(parts []qModels.QueueMessage) ([]string, map[string][]qModels.QueueMessage) {
+	var ids []string
+
+	result := map[string][]qModels.QueueMessage{}
+	add := func(id string, p qModels.QueueMessage) {
+		if _, ok := result[id]; !ok {
+			ids = append(ids, id)
+		}
+
+		result[id] = append(result[id], p)
+	}
+
+	for _, p := range parts {
+		if len(p.GetDeliveries()) == 0 {
+			add(p.GetRef().MessageID, p)
+			continue
+		}
+
+		seen := map[string]bool{}
+
+		for _, d := range p.GetDeliveries() {
+			if id := d.Ref.MessageID; !seen[id] {
+				seen[id] = true
+				add(id, p.ForMessage(id))
+			}
+		}
+	}
+
+	return ids, result
+}
+
+// addParts merges the recipients of the parts into the parts with the same number. Recipients that are already
+// added are kept within the separate copy of the part
+func addParts(ps []qModels.QueueMessage, add []qModels.QueueMessage) []qModels.QueueMessage {
+	for _, p := range add {
+		for _, e := range ps {
+			if p == nil {
+				break
+			}
+
+			if partRef(e).Part == partRef(p).Part {
+				p = e.Merge(p)
+			}
+		}
+
+		if p != nil {
+			ps = append(ps, p)
+		}
+	}
+
+	sort.SliceStable(ps, func(i, j int) bool {
+		return partRef(ps[i]).Part < partRef(ps[j]).Part
+	})
+
+	return ps
+}
+
+// List returns all the failed messages starting from the oldest one
+func (s *deadLetterStore) List() []*qModels.DeadLetter {
+	s.Mutex.Lock()
+	defer s.Mutex.Unlock()
+
+	return s.list()
+}
+
+func (s *deadLetterStore) list() []*qModels.DeadLetter {
+	result := make([]*qModels.DeadLetter, 0, len(s.Letters))
+
+	for _, l := range s.Letters {
+		result = append(result, l)
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].FailedAt.Before(result[j].FailedAt)
+	})
+
+	return result
+}
+
+// Remove takes failed message with all its parts out of the store
+func (s *deadLetterStore) Remove(id string) (*qModels.DeadLetter, bool, error) {
+	s.Mutex.Lock()
+	defer s.Mutex.Unlock()
+
+	l, ok := s.remove(id)
+
+	return l, ok, nil
+}
+
+func (s *deadLetterStore) remove(id string) (*qModels.DeadLetter, bool) {
+	l, ok := s.Letters[id]
+
+	if ok {
+		delete(s.Letters, id)
+	}
+
+	return l, ok
+}
@@ -0,0 +1,106 @@
+package queue_test
+
+import (
+	apiModels "api/models"
+	"mocks"
+	"queue"
+	"queue/models"
+	"reflect"
+	"strconv"
+	"testing"
+	"time"
+	"utils"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDeadLetterStore(t *testing.T) {
+	testDeadLetterStore(t, queue.InitDeadLetterStore(utils.InitClock()))
+
+	t.Run("message fails at the time of the clock", func(t *testing.T) {
+		now := time.Date(2017, 1, 1, 0, 0, 0, 0, time.UTC)
+		s := queue.InitDeadLetterStore(mocks.NewClockMock(now))
+
+		ls, err := s.Add("reason", models.InitQueueMessage("m", utils.Plain, apiModels.InitMessage(), "", 1))
+
+		assert.Nil(t, err)
+		assert.Equal(t, now, ls[0].FailedAt)
+	})
+}
+
+func testDeadLetterStore(t *testing.T, s queue.DeadLetterStore) {
+	m1 := models.InitQueueMessage("m1", utils.Plain, apiModels.InitMessage(), "", 1)
+	m2 := models.InitQueueMessage("m2", utils.Plain, apiModels.InitMessage(), "", 1)
+
+	t.Run("lists added messages starting from the oldest one", func(t *testing.T) {
+		ls1, err := s.Add("reason 1", m1)
+		assert.Nil(t, err)
+		ls2, err := s.Add("reason 2", m2)
+		assert.Nil(t, err)
+
+		l1, l2 := ls1[0], ls2[0]
+
+		assert.NotEqual(t, l1.ID, l2.ID)
+		assert.Equal(t, "reason 1", l1.Reason)
+		assert.Equal(t, []*models.DeadLetter{l1, l2}, s.List())
+	})
+
+	t.Run("removed message is not listed anymore", func(t *testing.T) {
+		l := s.List()[0]
+
+		removed, ok, err := s.Remove(l.ID)
+		assert.True(t, ok)
+		assert.Nil(t, err)
+		assert.Equal(t, l, removed)
+		assert.Len(t, s.List(), 1)
+
+		_, ok, _ = s.Remove(l.ID)
+		assert.False(t, ok)
+	})
+
+	part := func(id string, body string, part int, recipient int64) models.QueueMessage {
+		rm := apiModels.InitMessage()
+		rm.SetID(id)
+		reflect.ValueOf(rm).Elem().FieldByName("Recipient").SetInt(recipient)
+
+		return models.InitQueueMessage(body, utils.Plain, rm, "", part)
+	}
+
+	t.Run("parts of the message are kept together in order", func(t *testing.T) {
+		s.Add("reason", part("id", "p2", 2, 1), part("id", "p1", 1, 1))
+		ls, _ := s.Add("other reason", part("id", "p1", 1, 2), part("id", "p2", 2, 2))
+		assert.Len(t, ls, 1)
+
+		l := ls[0]
+
+		assert.Equal(t, "id", l.ID)
+		assert.Equal(t, "other reason", l.Reason)
+		assert.Len(t, l.Parts, 2)
+		assert.Equal(t, "p1", l.Parts[0].GetMessage())
+		assert.Equal(t, []string{"1", "2"}, l.Parts[0].GetRecipients())
+		assert.Equal(t, "p2", l.Parts[1].GetMessage())
+		assert.Equal(t, []string{"1", "2"}, l.Parts[1].GetRecipients())
+	})
+
+	t.Run("recipients of the merged messages are kept within the dead letters of their messages", func(t *testing.T) {
+		p1, p2 := part("a", "m1", 1, 1), part("a", "m2", 2, 1)
+		p1.Merge(part("b", "m1", 1, 2))
+		p2.Merge(part("b", "m2", 2, 2))
+
+		ls, err := s.Add("reason", p1, p2)
+		assert.Nil(t, err)
+		assert.Len(t, ls, 2)
+
+		for i, id := range []string{"a", "b"} {
+			l := ls[i]
+			assert.Equal(t, id, l.ID)
+			assert.Len(t, l.Parts, 2)
+
+			for _, p := range l.Parts {
+				assert.Equal(t, []string{strconv.Itoa(i + 1)}, p.GetRecipients())
+				assert.Equal(t, id, p.GetReferences()[0].MessageID)
+				assert.Len(t, p.GetReferences(), 1)
+			}
+		}
+	})
+}
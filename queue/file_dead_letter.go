@@ -0,0 +1,120 @@
+package queue
+
+import (
+	"encoding/json"
+	qModels "queue/models"
+	"utils"
+)
+
+// deadLetterFileRecord is an operation with the dead letter written to the append-only log
+type deadLetterFileRecord struct {
+	Op     string          `json:"op"`
+	ID     string          `json:"id,omitempty"`
+	Letter json.RawMessage `json:"letter,omitempty"`
+}
+
+type fileDeadLetterStore struct {
+	Memory *deadLetterStore
+	Log    utils.AppendLog
+}
+
+// InitFileDeadLetterStore is file-backed DeadLetterStore factory method. Every change is appended to the log at the
+// provided path, so dead letters are restored from the log after the restart
+func InitFileDeadLetterStore(path string, c utils.Clock) (DeadLetterStore, error) {
+	s := &fileDeadLetterStore{initDeadLetterStore(c), nil}
+	s.Log = utils.InitAppendLog(path, compactThreshold, s.snapshot)
+
+	if err := s.Log.Replay(s.apply); err != nil {
+		return nil, err
+	}
+
+	// start from the log that keeps only the dead letters that are not replayed yet
+	if err := s.Log.Compact(); err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
+// Add puts the failed parts of the message to the store and appends the whole dead letters to the log
+func (s *fileDeadLetterStore) Add(reason string, parts ...qModels.QueueMessage) ([]*qModels.DeadLetter, error) {
+	s.Memory.Mutex.Lock()
+	defer s.Memory.Mutex.Unlock()
+
+	ls := s.Memory.add(reason, parts)
+
+	for _, l := range ls {
+		b, err := json.Marshal(l)
+
+		if err == nil {
+			err = s.Log.Append(&deadLetterFileRecord{Op: opSave, Letter: b})
+		}
+
+		if err != nil {
+			return ls, err
+		}
+	}
+
+	return ls, nil
+}
+
+// List returns all the failed messages starting from the oldest one
+func (s *fileDeadLetterStore) List() []*qModels.DeadLetter {
+	return s.Memory.List()
+}
+
+// Remove takes failed message out of the store and appends its removal to the log
+func (s *fileDeadLetterStore) Remove(id string) (*qModels.DeadLetter, bool, error) {
+	s.Memory.Mutex.Lock()
+	defer s.Memory.Mutex.Unlock()
+
+	l, ok := s.Memory.remove(id)
+
+	if !ok {
+		return nil, false, nil
+	}
+
+	return l, true, s.Log.Append(&deadLetterFileRecord{Op: opRemove, ID: id})
+}
+
+// apply changes the dead letters as the record of the log says
+func (s *fileDeadLetterStore) apply(b json.RawMessage) error {
+	r := &deadLetterFileRecord{}
+
+	if err := json.Unmarshal(b, r); err != nil {
+		return err
+	}
+
+	switch r.Op {
+	case opSave:
+		l, err := qModels.UnmarshalDeadLetter(r.Letter)
+
+		if err != nil {
+			return err
+		}
+
+		// the latest record of the dead letter has all its parts
+		s.Memory.Letters[l.ID] = l
+	case opRemove:
+		s.Memory.remove(r.ID)
+	}
+
+	return nil
+}
+
+// snapshot writes the dead letters that are not replayed yet
+func (s *fileDeadLetterStore) snapshot(write func(r interface{}) error) error {
+	for _, l := range s.Memory.list() {
+		b, err := json.Marshal(l)
+
+		if err == nil {
+			err = write(&deadLetterFileRecord{Op: opSave, Letter: b})
+		}
+
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
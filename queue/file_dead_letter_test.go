@@ -0,0 +1,64 @@
+package queue_test
+
+import (
+	apiModels "api/models"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"queue"
+	"queue/models"
+	"reflect"
+	"testing"
+	"utils"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFileDeadLetterStore(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "birdfeeder")
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "dead_letters.log")
+
+	s, err := queue.InitFileDeadLetterStore(path, utils.InitClock())
+	assert.Nil(t, err)
+
+	testDeadLetterStore(t, s)
+
+	t.Run("dead letters are restored after the restart", func(t *testing.T) {
+		rm := apiModels.InitMessage()
+		rm.SetID("restored")
+		reflect.ValueOf(rm).Elem().FieldByName("Originator").SetString("originator")
+
+		ls, err := s.Add("reason", models.InitQueueMessage("p1", utils.Plain, rm, "udh1", 1), models.InitQueueMessage("p2", utils.Plain, rm, "udh2", 2))
+		assert.Nil(t, err)
+		l := ls[0]
+
+		before := s.List()
+		_, _, err = s.Remove(before[0].ID)
+		assert.Nil(t, err)
+
+		restarted, err := queue.InitFileDeadLetterStore(path, utils.InitClock())
+		assert.Nil(t, err)
+
+		after := restarted.List()
+		assert.Len(t, after, len(before)-1)
+
+		r := after[len(after)-1]
+		assert.Equal(t, l.ID, r.ID)
+		assert.Equal(t, "reason", r.Reason)
+		assert.True(t, l.FailedAt.Equal(r.FailedAt))
+		assert.Len(t, r.Parts, 2)
+		assert.Equal(t, "p1", r.Parts[0].GetMessage())
+		assert.Equal(t, "udh2", r.Parts[1].GetUDH())
+		assert.Equal(t, "originator", r.Parts[1].GetOriginator())
+	})
+
+	t.Run("returns error for corrupted log", func(t *testing.T) {
+		corrupted := filepath.Join(dir, "corrupted.log")
+		ioutil.WriteFile(corrupted, []byte(`{"op":"save","letter":{"parts":[1]}}`+"\n"), 0600)
+
+		_, err := queue.InitFileDeadLetterStore(corrupted, utils.InitClock())
+		assert.NotNil(t, err)
+	})
+}
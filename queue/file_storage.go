@@ -0,0 +1,147 @@
+package queue
+
+import (
+	"encoding/json"
+	qModels "queue/models"
+	"time"
+	"utils"
+)
+
+const (
+	opSave   = "save"
+	opRemove = "remove"
+	opRetry  = "retry"
+)
+
+// amount of log records after which the log is rewritten with the pending messages only
+const compactThreshold = 1000
+
+// fileRecord is an operation written to the append-only log
+type fileRecord struct {
+	Op         string             `json:"op"`
+	Message    json.RawMessage    `json:"message,omitempty"`
+	Deliveries []qModels.Delivery `json:"deliveries,omitempty"`
+	References []qModels.PartRef  `json:"references,omitempty"`
+	Retry      *fileRetry         `json:"retry,omitempty"`
+}
+
+// fileRetry is the failed attempts of the message parts
+type fileRetry struct {
+	Attempts int       `json:"attempts"`
+	At       time.Time `json:"at"`
+}
+
+type fileStorage struct {
+	Memory *memoryStorage
+	Log    utils.AppendLog
+}
+
+// InitFileStorage is file-backed Storage factory method. Every change is appended to the log at the provided path,
+// so pending messages are restored from the log after the restart
+func InitFileStorage(path string) (Storage, error) {
+	s := &fileStorage{initMemoryStorage(), nil}
+	s.Log = utils.InitAppendLog(path, compactThreshold, s.snapshot)
+
+	if err := s.Log.Replay(s.apply); err != nil {
+		return nil, err
+	}
+
+	// start from the log that keeps only pending messages
+	if err := s.Log.Compact(); err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
+// Save appends submitted message part to the log
+func (s *fileStorage) Save(m qModels.QueueMessage) error {
+	b, err := m.MarshalJSON()
+
+	if err != nil {
+		return err
+	}
+
+	s.Memory.Mutex.Lock()
+	defer s.Memory.Mutex.Unlock()
+
+	s.Memory.save(m)
+
+	return s.Log.Append(&fileRecord{Op: opSave, Message: b})
+}
+
+// Remove appends sent recipients of the message to the log
+func (s *fileStorage) Remove(m qModels.QueueMessage) error {
+	s.Memory.Mutex.Lock()
+	defer s.Memory.Mutex.Unlock()
+
+	ds := m.GetDeliveries()
+	refs := m.GetReferences()
+
+	s.Memory.remove(ds, refs)
+
+	return s.Log.Append(&fileRecord{Op: opRemove, Deliveries: ds, References: refs})
+}
+
+// Retry appends failed attempts of the message to the log
+func (s *fileStorage) Retry(m qModels.QueueMessage) error {
+	s.Memory.Mutex.Lock()
+	defer s.Memory.Mutex.Unlock()
+
+	refs := messageRefs(m)
+	r := &fileRetry{m.GetAttempts(), m.GetRetryAt()}
+
+	s.Memory.retry(refs, r.Attempts, r.At)
+
+	return s.Log.Append(&fileRecord{Op: opRetry, References: refs, Retry: r})
+}
+
+// Load returns all the pending messages parts in order of their submission
+func (s *fileStorage) Load() []qModels.QueueMessage {
+	return s.Memory.Load()
+}
+
+// apply changes the pending messages as the record of the log says
+func (s *fileStorage) apply(b json.RawMessage) error {
+	r := &fileRecord{}
+
+	if err := json.Unmarshal(b, r); err != nil {
+		return err
+	}
+
+	switch r.Op {
+	case opSave:
+		m, err := qModels.UnmarshalQueueMessage(r.Message)
+
+		if err != nil {
+			return err
+		}
+
+		s.Memory.save(m)
+	case opRemove:
+		s.Memory.remove(r.Deliveries, r.References)
+	case opRetry:
+		if r.Retry != nil {
+			s.Memory.retry(r.References, r.Retry.Attempts, r.Retry.At)
+		}
+	}
+
+	return nil
+}
+
+// snapshot writes the pending messages only
+func (s *fileStorage) snapshot(write func(r interface{}) error) error {
+	for _, m := range s.Memory.entries() {
+		b, err := m.MarshalJSON()
+
+		if err == nil {
+			err = write(&fileRecord{Op: opSave, Message: b})
+		}
+
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,81 @@
+package queue_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"queue"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFileStorage(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "birdfeeder")
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "queue.log")
+
+	s, err := queue.InitFileStorage(path)
+	assert.Nil(t, err)
+
+	testStorage(t, s)
+
+	t.Run("pending messages are restored after the restart", func(t *testing.T) {
+		m1 := initStoredMessage("id1", 1, 31, 32)
+		m2 := initStoredMessage("id2", 1, 33)
+
+		assert.Nil(t, s.Save(m1))
+		assert.Nil(t, s.Save(m2))
+		assert.Nil(t, s.Remove(m2))
+
+		restarted, err := queue.InitFileStorage(path)
+		assert.Nil(t, err)
+
+		l := restarted.Load()
+		assert.Len(t, l, 1)
+		assert.Equal(t, m1.GetRef(), l[0].GetRef())
+		assert.Equal(t, m1.GetRecipients(), l[0].GetRecipients())
+		assert.Equal(t, m1.GetUDH(), l[0].GetUDH())
+		assert.Equal(t, m1.GetDataCoding(), l[0].GetDataCoding())
+		assert.Equal(t, m1.GetOriginator(), l[0].GetOriginator())
+	})
+
+	t.Run("failed attempts are restored after the restart", func(t *testing.T) {
+		retried := filepath.Join(dir, "retried.log")
+		s, _ := queue.InitFileStorage(retried)
+		m := initStoredMessage("id1", 1, 31)
+		at := time.Date(2017, 1, 1, 0, 0, 0, 0, time.UTC)
+
+		assert.Nil(t, s.Save(m))
+		m.Retry(at)
+		assert.Nil(t, s.Retry(m))
+
+		restarted, err := queue.InitFileStorage(retried)
+		assert.Nil(t, err)
+
+		l := restarted.Load()
+		assert.Len(t, l, 1)
+		assert.Equal(t, 1, l[0].GetAttempts())
+		assert.True(t, at.Equal(l[0].GetRetryAt()))
+	})
+
+	t.Run("partially written last record is ignored", func(t *testing.T) {
+		f, _ := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0600)
+		f.WriteString(`{"op":"save","message":{"deli`)
+		f.Close()
+
+		restarted, err := queue.InitFileStorage(path)
+		assert.Nil(t, err)
+		assert.Len(t, restarted.Load(), 1)
+	})
+
+	t.Run("returns error for corrupted log", func(t *testing.T) {
+		corrupted := filepath.Join(dir, "corrupted.log")
+		ioutil.WriteFile(corrupted, []byte("not a log\n{}\n"), 0600)
+
+		_, err := queue.InitFileStorage(corrupted)
+		assert.NotNil(t, err)
+	})
+}
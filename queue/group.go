@@ -0,0 +1,144 @@
+package queue
+
+import (
+	qModels "queue/models"
+	"sort"
+	"time"
+)
+
+// group is the parts of the submitted message that are sent one after another in order of the parts. Message that
+// isn't split is a group of one part
+type group struct {
+	Parts []qModels.QueueMessage
+	// Sent is the amount of parts that are already sent
+	Sent int
+}
+
+// groupMessages puts the parts of the same submitted message into one group. Parts are grouped by the submitted
+// message part their recipients belong to, messages without the submitted message identifier are never grouped
+func groupMessages(ms []qModels.QueueMessage) []*group {
+	var result []*group
+
+	groups := map[string]*group{}
+
+	for _, m := range ms {
+		id := partRef(m).MessageID
+
+		if g, ok := groups[id]; ok && id != "" {
+			g.Parts = append(g.Parts, m)
+			continue
+		}
+
+		g := &group{Parts: []qModels.QueueMessage{m}}
+		groups[id] = g
+		result = append(result, g)
+	}
+
+	for _, g := range result {
+		sort.SliceStable(g.Parts, func(i, j int) bool {
+			return partRef(g.Parts[i]).Part < partRef(g.Parts[j]).Part
+		})
+	}
+
+	return result
+}
+
+// partRef returns the submitted message part the recipients of the message belong to
+func partRef(m qModels.QueueMessage) qModels.PartRef {
+	if ds := m.GetDeliveries(); len(ds) > 0 {
+		return ds[0].Ref
+	}
+
+	return m.GetRef()
+}
+
+// next returns the first part that isn't sent yet
+func (g *group) next() qModels.QueueMessage {
+	return g.Parts[g.Sent]
+}
+
+// isDue checks if it's time to send the rest of the parts
+func (g *group) isDue(now time.Time) bool {
+	return g.next().IsDue(now)
+}
+
+// isFresh checks if the group could be merged with the others: it's due and none of its parts was sent or failed yet,
+// so the merged recipients don't inherit the backoff or the attempts of the group
+func (g *group) isFresh(now time.Time) bool {
+	if g.Sent > 0 || !g.isDue(now) {
+		return false
+	}
+
+	for _, m := range g.Parts {
+		if m.GetAttempts() > 0 {
+			return false
+		}
+	}
+
+	return true
+}
+
+// pending returns the amount of the parts that are not sent yet
+func (g *group) pending() int {
+	return len(g.Parts) - g.Sent
+}
+
+// key identifies the groups which parts could be merged one by one with the provided policy
+func (g *group) key(p MergePolicy) string {
+	k := ""
+
+	for _, m := range g.Parts {
+		k += p.Key(m) + "\x00"
+	}
+
+	return k
+}
+
+// merge adds recipients of every part of the group with the same key to the parts of this group. Recipients that
+// are not merged are returned back within the rest of the other group. It reports if anything was merged
+func (g *group) merge(o *group, p MergePolicy) (*group, bool) {
+	var rest []qModels.QueueMessage
+
+	merged := false
+
+	for i, m := range g.Parts {
+		r := p.Merge(m, o.Parts[i])
+
+		if r != o.Parts[i] {
+			merged = true
+		}
+
+		if r != nil {
+			rest = append(rest, r)
+		}
+	}
+
+	if len(rest) == 0 {
+		return nil, merged
+	}
+
+	return &group{Parts: rest}, merged
+}
+
+// split divides the group which parts have more recipients than the policy allows into the groups with the same
+// parts (and UDH) for the different recipients. Parts of the same submitted message list the recipients in the same
+// order, so every recipient gets all the parts within one group. The group itself is returned if it isn't split
+func (g *group) split(p MergePolicy) []*group {
+	var result []*group
+
+	for _, m := range g.Parts {
+		for i, b := range p.Split(m) {
+			if i == len(result) {
+				result = append(result, &group{})
+			}
+
+			result[i].Parts = append(result[i].Parts, b)
+		}
+	}
+
+	if len(result) <= 1 {
+		return []*group{g}
+	}
+
+	return result
+}
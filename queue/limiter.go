@@ -0,0 +1,141 @@
+package queue
+
+import (
+	"math"
+	"sync"
+	"time"
+	"utils"
+)
+
+// Limit is the throughput limit: amount of messages per second and amount of messages that could be sent at once
+type Limit struct {
+	Rate  float64
+	Burst int
+}
+
+// RateLimiter controls the throughput of the messages sent to the third parties
+type RateLimiter interface {
+	Allow(originator string) bool
+	Delay(originator string) time.Duration
+}
+
+// tokenBucket is filled with tokens with the provided rate up to the burst size. Each sent message takes one token
+type tokenBucket struct {
+	Limit  Limit
+	Tokens float64
+	Last   time.Time
+}
+
+type rateLimiter struct {
+	Mutex            *sync.Mutex
+	Clock            utils.Clock
+	Global           *tokenBucket
+	OriginatorLimits map[string]Limit
+	Originators      map[string]*tokenBucket
+}
+
+// InitRateLimiter is RateLimiter factory method. Global limit is applied to all the messages, while originator limits
+// are optional sub-limits for the messages from the provided originators. Limit with non-positive rate is not applied
+func InitRateLimiter(c utils.Clock, global Limit, originators map[string]Limit) RateLimiter {
+	return &rateLimiter{&sync.Mutex{}, c, newTokenBucket(global, c.Now()), originators, map[string]*tokenBucket{}}
+}
+
+func newTokenBucket(l Limit, now time.Time) *tokenBucket {
+	return &tokenBucket{l, float64(l.Burst), now}
+}
+
+// Allow takes the token for the message from the provided originator if it could be sent right now
+func (l *rateLimiter) Allow(originator string) bool {
+	l.Mutex.Lock()
+	defer l.Mutex.Unlock()
+
+	now := l.Clock.Now()
+	o := l.getOriginatorBucket(originator, now)
+
+	if l.Global.delay(now) > 0 || (o != nil && o.delay(now) > 0) {
+		return false
+	}
+
+	l.Global.take()
+
+	if o != nil {
+		o.take()
+	}
+
+	return true
+}
+
+// Delay returns the time left until the message from the provided originator could be sent
+func (l *rateLimiter) Delay(originator string) time.Duration {
+	l.Mutex.Lock()
+	defer l.Mutex.Unlock()
+
+	now := l.Clock.Now()
+	d := l.Global.delay(now)
+
+	if o := l.getOriginatorBucket(originator, now); o != nil {
+		if od := o.delay(now); od > d {
+			d = od
+		}
+	}
+
+	return d
+}
+
+// getOriginatorBucket returns the bucket of the originator sub-limit or nil if the originator has no sub-limit
+func (l *rateLimiter) getOriginatorBucket(originator string, now time.Time) *tokenBucket {
+	l.evict(now)
+
+	limit, ok := l.OriginatorLimits[originator]
+
+	if !ok || limit.Rate <= 0 {
+		return nil
+	}
+
+	if b, ok := l.Originators[originator]; ok {
+		return b
+	}
+
+	b := newTokenBucket(limit, now)
+	l.Originators[originator] = b
+
+	return b
+}
+
+// evict forgets the buckets that are full again, since they limit no more than the new ones
+func (l *rateLimiter) evict(now time.Time) {
+	for o, b := range l.Originators {
+		if b.refill(now); b.Tokens >= float64(b.Limit.Burst) {
+			delete(l.Originators, o)
+		}
+	}
+}
+
+// refill adds the tokens for the time passed since the last refill
+func (b *tokenBucket) refill(now time.Time) {
+	if now.After(b.Last) {
+		b.Tokens = math.Min(float64(b.Limit.Burst), b.Tokens+now.Sub(b.Last).Seconds()*b.Limit.Rate)
+		b.Last = now
+	}
+}
+
+// delay returns the time left until the bucket has a token
+func (b *tokenBucket) delay(now time.Time) time.Duration {
+	if b.Limit.Rate <= 0 {
+		return 0
+	}
+
+	b.refill(now)
+
+	if b.Tokens >= 1 {
+		return 0
+	}
+
+	return time.Duration(math.Ceil((1 - b.Tokens) / b.Limit.Rate * float64(time.Second)))
+}
+
+func (b *tokenBucket) take() {
+	if b.Limit.Rate > 0 {
+		b.Tokens--
+	}
+}
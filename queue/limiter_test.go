@@ -0,0 +1,122 @@
+package queue_test
+
+import (
+	"mocks"
+	"queue"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRateLimiter_Allow(t *testing.T) {
+	t.Run("allows burst at once and then the provided rate", func(t *testing.T) {
+		c := mocks.NewClockMock(time.Now())
+		l := queue.InitRateLimiter(c, queue.Limit{Rate: 2, Burst: 3}, nil)
+
+		assert.True(t, l.Allow("o"))
+		assert.True(t, l.Allow("o"))
+		assert.True(t, l.Allow("o"))
+		assert.False(t, l.Allow("o"))
+
+		c.Advance(500 * time.Millisecond)
+		assert.True(t, l.Allow("o"))
+		assert.False(t, l.Allow("o"))
+
+		// bucket never keeps more tokens than burst
+		c.Advance(time.Minute)
+		assert.True(t, l.Allow("o"))
+		assert.True(t, l.Allow("o"))
+		assert.True(t, l.Allow("o"))
+		assert.False(t, l.Allow("o"))
+	})
+
+	t.Run("not positive rate is unlimited", func(t *testing.T) {
+		l := queue.InitRateLimiter(mocks.NewClockMock(time.Now()), queue.Limit{}, nil)
+
+		for i := 0; i < 1000; i++ {
+			assert.True(t, l.Allow("o"))
+		}
+	})
+
+	t.Run("originator sub-limit is applied only to its originator", func(t *testing.T) {
+		c := mocks.NewClockMock(time.Now())
+		l := queue.InitRateLimiter(c, queue.Limit{Rate: 10, Burst: 10}, map[string]queue.Limit{"slow": {Rate: 1, Burst: 1}})
+
+		assert.True(t, l.Allow("slow"))
+		assert.False(t, l.Allow("slow"))
+		assert.True(t, l.Allow("fast"))
+		assert.True(t, l.Allow("fast"))
+
+		c.Advance(time.Second)
+		assert.True(t, l.Allow("slow"))
+	})
+
+	t.Run("message denied by originator sub-limit does not take global token", func(t *testing.T) {
+		c := mocks.NewClockMock(time.Now())
+		l := queue.InitRateLimiter(c, queue.Limit{Rate: 1, Burst: 2}, map[string]queue.Limit{"slow": {Rate: 1, Burst: 1}})
+
+		assert.True(t, l.Allow("slow"))
+		assert.False(t, l.Allow("slow"))
+		assert.True(t, l.Allow("fast"))
+		assert.False(t, l.Allow("fast"))
+	})
+}
+
+func TestRateLimiter_Buckets(t *testing.T) {
+	buckets := func(l queue.RateLimiter) int {
+		return reflect.ValueOf(l).Elem().FieldByName("Originators").Len()
+	}
+
+	c := mocks.NewClockMock(time.Now())
+	l := queue.InitRateLimiter(c, queue.Limit{}, map[string]queue.Limit{"slow": {Rate: 1, Burst: 2}})
+
+	t.Run("originators without sub-limit get no bucket", func(t *testing.T) {
+		for i := 0; i < 100; i++ {
+			assert.True(t, l.Allow(string(rune('a'+i))))
+			assert.Equal(t, time.Duration(0), l.Delay(string(rune('a'+i))))
+		}
+
+		assert.Equal(t, 0, buckets(l))
+	})
+
+	t.Run("bucket is kept till it's full again", func(t *testing.T) {
+		assert.True(t, l.Allow("slow"))
+		assert.True(t, l.Allow("slow"))
+		assert.False(t, l.Allow("slow"))
+
+		c.Advance(time.Second)
+		assert.True(t, l.Allow("other"))
+		assert.Equal(t, 1, buckets(l))
+
+		c.Advance(time.Second)
+		assert.True(t, l.Allow("other"))
+		assert.Equal(t, 0, buckets(l))
+
+		// new bucket starts full
+		assert.True(t, l.Allow("slow"))
+		assert.True(t, l.Allow("slow"))
+		assert.False(t, l.Allow("slow"))
+	})
+}
+
+func TestRateLimiter_Delay(t *testing.T) {
+	c := mocks.NewClockMock(time.Now())
+	l := queue.InitRateLimiter(c, queue.Limit{Rate: 4, Burst: 1}, map[string]queue.Limit{"slow": {Rate: 1, Burst: 1}})
+
+	t.Run("no delay if there are tokens", func(t *testing.T) {
+		assert.Equal(t, time.Duration(0), l.Delay("slow"))
+	})
+
+	t.Run("delay until the next token", func(t *testing.T) {
+		l.Allow("fast")
+		assert.Equal(t, 250*time.Millisecond, l.Delay("fast"))
+	})
+
+	t.Run("the longest of global and originator delays", func(t *testing.T) {
+		c.Advance(250 * time.Millisecond)
+		l.Allow("slow")
+		assert.Equal(t, time.Second, l.Delay("slow"))
+	})
+}
@@ -1,32 +1,78 @@
 package queue
 
 import (
+	"context"
 	"external"
-	"fmt"
 	qModels "queue/models"
-	"sort"
 	"sync"
 	"time"
+	"utils"
 )
 
 // MessageQueue for sending data to the third parties
 type MessageQueue interface {
 	Push(m ...qModels.QueueMessage)
+	Replay(id string) bool
+	Shutdown(ctx context.Context) error
 }
 
 type queue struct {
-	Pipe       chan qModels.QueueMessage
+	Pipe       chan *group
 	Mutex      *sync.Mutex
-	Collection []qModels.QueueMessage // consider it to be a cart with messages putted under the pipe
-	Mb         external.MessageBirdClient
+	Collection []*group // consider it to be a cart with messages putted under the pipe
+	Gateway    external.SMSGateway
+	Tracker    StatusTracker
+	Storage    Storage
+	Retry      RetryPolicy
+	Dead       DeadLetterStore
+	Limiter    RateLimiter
+	Priority   PriorityPolicy
+	Merge      MergePolicy
+	Clock      utils.Clock
+	Tick       time.Duration // how often the collection is checked for the new messages
+	Stop       chan context.Context
+	Done       chan struct{}
+	Metrics    utils.Metrics
+	Logger     utils.Logger
+	Pending    int // amount of messages that are taken from the collection but not sent yet
 }
 
-// InitQueue for sending messages to third-parties
-func InitQueue(mb external.MessageBirdClient) MessageQueue {
-	c := []qModels.QueueMessage{}
-	q := &queue{make(chan qModels.QueueMessage), &sync.Mutex{}, c, mb}
+// Config holds the dependencies and the settings of the queue
+type Config struct {
+	Gateway  external.SMSGateway
+	Tracker  StatusTracker
+	Storage  Storage
+	Retry    RetryPolicy
+	Dead     DeadLetterStore
+	Limiter  RateLimiter
+	Priority PriorityPolicy
+	Merge    MergePolicy
+	Clock    utils.Clock
+	Tick     time.Duration // how often the collection is checked for the new messages
+	Metrics  utils.Metrics
+	Logger   utils.Logger
+}
+
+// InitQueue for sending messages to third-parties. Pending messages from the storage are replayed to the queue and
+// tracked as queued. Messages are sent as soon as the rate limiter allows it in order decided by the priority policy.
+// Parts of the split message are sent together in order of the parts. Identical messages are merged as decided by
+// the merge policy
+func InitQueue(cfg Config) MessageQueue {
+	q := &queue{make(chan *group), &sync.Mutex{}, []*group{}, cfg.Gateway, cfg.Tracker, cfg.Storage, cfg.Retry,
+		cfg.Dead, cfg.Limiter, cfg.Priority, cfg.Merge, cfg.Clock, cfg.Tick, make(chan context.Context),
+		make(chan struct{}), cfg.Metrics, cfg.Logger, 0}
+
+	q.Metrics.QueueDepth(q.depth)
+
+	ms := q.Storage.Load()
+	restoreStatuses(q.Tracker, ms)
+
+	for _, m := range ms {
+		q.setState(m, qModels.Queued)
+	}
 
 	go q.listenForChanges()
+	go q.requeue(groupMessages(ms)...)
 
 	return q
 }
@@ -44,116 +90,435 @@ func (q *queue) startCollectingChanges() {
 func (q *queue) listenForChanges() {
 	go q.startCollectingChanges()
 
+	// messages that are not allowed to be sent yet
+	var pending []*group
+
 	for {
-		time.Sleep(time.Second)
+		select {
+		case <-q.Clock.After(q.nextCheck(pending)):
+		case ctx := <-q.Stop:
+			q.drain(ctx, pending)
+			close(q.Done)
+			return
+		}
 
-		// prevent data race
-		q.Mutex.Lock()
-		l := len(q.Collection)
-		q.Mutex.Unlock()
+		c := q.swapCollection()
 
 		// do nothing if we have nothing in the queue
-		if l == 0 {
+		if len(c) == 0 && len(pending) == 0 {
 			continue
 		}
 
-		c := q.Collection             // old collection
-		n := []qModels.QueueMessage{} // new empty collection
+		pending = q.sendChanges(append(pending, c...))
 
-		// not thread-safe
 		q.Mutex.Lock()
-		// meanwhile put new empty collection here (old collection would still be accessible within goroutine)
-		q.Collection = n // swap collections (swap carts under the pipe)
+		q.Pending = countPending(pending)
 		q.Mutex.Unlock()
+	}
+}
+
+// depth returns the amount of messages waiting in the queue
+func (q *queue) depth() float64 {
+	q.Mutex.Lock()
+	defer q.Mutex.Unlock()
 
-		// send the processing to the goroutine with passing the reference to our fulled collection (cart)
-		go q.sendChanges(c)
+	return float64(countPending(q.Collection) + q.Pending)
+}
+
+// countPending returns the amount of messages of the groups that are not sent yet
+func countPending(gs []*group) int {
+	n := 0
+
+	for _, g := range gs {
+		n += g.pending()
 	}
+
+	return n
 }
 
-func (q *queue) sendChanges(c []qModels.QueueMessage) {
-	ms := q.getUniqueMessages(c)
+// swapCollection takes all the collected messages and replaces the collection with the empty one
+func (q *queue) swapCollection() []*group {
+	// prevent data race
+	q.Mutex.Lock()
+	defer q.Mutex.Unlock()
 
-	// sort by the biggest amount of recipients
-	sort.Sort(sort.Reverse(qModels.ByRecipientsAmount(ms)))
+	c := q.Collection         // old collection
+	q.Collection = []*group{} // swap collections (swap carts under the pipe)
 
-	if len(ms) == 0 {
-		return
+	return c
+}
+
+// drain keeps sending the messages that are due till there are none of them left or context is done.
+// Messages that are not sent stay in the storage and are replayed after the restart
+func (q *queue) drain(ctx context.Context, pending []*group) {
+	for {
+		pending = q.sendChanges(append(pending, q.swapCollection()...))
+
+		q.Mutex.Lock()
+		l := len(q.Collection)
+		q.Mutex.Unlock()
+
+		if l == 0 && !hasDueMessages(pending, q.Clock.Now()) {
+			return
+		}
+
+		select {
+		case <-q.Clock.After(q.nextCheck(pending)):
+		case <-ctx.Done():
+			return
+		}
 	}
+}
 
-	// send the message with the biggest amount of recipients
-	q.SendMessage(ms[0])
+func hasDueMessages(gs []*group, now time.Time) bool {
+	for _, g := range gs {
+		if g.isDue(now) {
+			return true
+		}
+	}
 
-	// put the rest of the messages back to the queue
-	q.Push(ms[1:]...)
+	return false
 }
 
-func (q *queue) getUniqueMessages(c []qModels.QueueMessage) []qModels.QueueMessage {
-	// set with unique messages bodies as the keys to cache the messages with different recipients and same udh
-	mSet := map[string]map[string]qModels.QueueMessage{}
+// Shutdown stops sending the messages after the ones that are due are sent. It returns context error if
+// the queue wasn't drained before the context is done
+func (q *queue) Shutdown(ctx context.Context) error {
+	select {
+	case q.Stop <- ctx:
+	case <-q.Done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
 
-	// iterate through the collection
-	for _, m := range c {
-		b := m.GetMessage()
-		udh := m.GetUDH()
+	select {
+	case <-q.Done:
+		return ctx.Err()
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
 
-		// check if message body is cached already
-		mapItems, ok := mSet[b]
+// nextCheck returns the time left until the next check of the collection. It's never longer than the tick,
+// but shorter if any of the pending messages could be sent earlier
+func (q *queue) nextCheck(pending []*group) time.Duration {
+	now := q.Clock.Now()
+	d := q.Tick
 
-		// if it's not in set - cache it and proceed
-		if !ok {
-			mSet[b] = map[string]qModels.QueueMessage{udh: m}
-			_ = m.AddRecipient(m.GetOriginalRecipient()) // #nosec
-			continue
+	for _, g := range pending {
+		m := g.next()
+		md := m.GetRetryAt().Sub(now)
+
+		if m.IsDue(now) {
+			md = q.Limiter.Delay(m.GetOriginator())
+		}
+
+		if md > 0 && md < d {
+			d = md
+		}
+	}
+
+	return d
+}
+
+// sendChanges sends all the messages that are due and allowed by the rate limiter. The rest of them are returned back.
+// Groups that are partly sent go first and nothing else is sent till they are done, so nothing is sent between the
+// parts of the split message
+func (q *queue) sendChanges(c []*group) []*group {
+	var started, ms, postponed []*group
+
+	now := q.Clock.Now()
+	leads := map[qModels.QueueMessage]*group{}
+
+	// messages that are waiting for the next attempt are not sent yet
+	for _, g := range q.getUniqueGroups(c, now) {
+		switch {
+		case !g.isDue(now):
+			postponed = append(postponed, g)
+		case g.Sent > 0:
+			started = append(started, g)
+		default:
+			ms = append(ms, g)
+			leads[g.next()] = g
 		}
+	}
+
+	next := make([]qModels.QueueMessage, len(ms))
 
-		// check if message with such body and udh is already in the collection
-		mItem, ok := mapItems[udh]
+	for i, g := range ms {
+		next[i] = g.next()
+	}
 
-		// if it is not - cache it and proceed
-		if !ok {
-			mapItems[udh] = m
-			_ = m.AddRecipient(m.GetOriginalRecipient()) // #nosec
+	// the most urgent messages are the first to be sent
+	q.Priority.Order(next, now)
+
+	for i, m := range next {
+		ms[i] = leads[m]
+	}
+
+	gs := append(started, ms...)
+
+	for i, g := range gs {
+		if q.sendGroup(g) {
 			continue
 		}
 
-		// if we had identical message let's try to add recipient to the list of the cached message
-		err := mItem.AddRecipient(m.GetOriginalRecipient())
+		postponed = append(postponed, g)
 
-		if err != nil {
-			// if it's duplicated identical message with the same recipient - it's intended to be sent twice. Send back to the queue
-			q.Push(m)
+		// the rest of the parts are sent first in the next pass, so nothing is sent between them
+		if g.Sent > 0 {
+			return append(postponed, gs[i+1:]...)
 		}
 	}
 
-	var result []qModels.QueueMessage
+	return postponed
+}
+
+// sendGroup sends the parts of the group that are not sent yet one after another. It returns false if the rate
+// limiter doesn't allow to send the rest of them yet
+func (q *queue) sendGroup(g *group) bool {
+	for g.Sent < len(g.Parts) {
+		m := g.next()
+
+		if !q.Limiter.Allow(m.GetOriginator()) {
+			return false
+		}
+
+		if err := q.SendMessage(m); err != nil {
+			q.handleFailure(g, err)
+			return true
+		}
+
+		g.Sent++
+	}
+
+	// all the parts are sent, the group leaves the queue
+	for _, m := range g.Parts {
+		q.remove(m)
+	}
+
+	return true
+}
+
+func (q *queue) getUniqueGroups(c []*group, now time.Time) []*group {
+	// set with the merge keys of the groups to cache the groups with different recipients and the same content
+	set := map[string][]*group{}
+
+	var result []*group
+
+	// iterate through the collection
+	for _, g := range c {
+		// recipients are never added to the group that is partly sent or waits for the next attempt
+		if !g.isFresh(now) {
+			result = append(result, g)
+			continue
+		}
+
+		k := g.key(q.Merge)
 
-	for _, mi := range mSet {
-		for _, m := range mi {
-			result = append(result, m)
+		// if we had identical groups let's try to add recipients to the lists of the cached groups
+		for _, u := range set[k] {
+			rest, merged := u.merge(g, q.Merge)
+
+			if merged {
+				q.Metrics.Merged()
+			}
+
+			if g = rest; g == nil {
+				break
+			}
+		}
+
+		if g == nil {
+			continue
+		}
+
+		// recipients that don't fit into the cached groups or are intended to receive the message twice are sent
+		// within the next groups, which don't have more recipients than the provider accepts at once
+		for _, s := range g.split(q.Merge) {
+			set[k] = append(set[k], s)
+			result = append(result, s)
 		}
 	}
 
 	return result
 }
 
-// Push sends all provided messages to the queue (pipe)
+// Push persists all provided messages and sends them to the queue (pipe). Parts of the same submitted message are
+// sent together
 func (q *queue) Push(m ...qModels.QueueMessage) {
+	now := q.Clock.Now()
+
 	for _, mes := range m {
+		mes.Enqueue(now)
+		// every recipient is tracked, so the part isn't sent till all of them are
+		q.setState(mes, qModels.Queued)
+
+		if err := q.Storage.Save(mes); err != nil {
+			q.log(mes).Error("unable to persist message", utils.Fields{"error": err})
+		}
+
+		q.log(mes).Debug("message queued", nil)
+	}
+
+	q.requeue(groupMessages(m)...)
+}
+
+// requeue sends already persisted messages back to the queue (pipe)
+func (q *queue) requeue(g ...*group) {
+	for _, mes := range g {
 		q.Pipe <- mes
 	}
 }
 
-// SendMessage sends message to the MessageBird API
-func (q *queue) SendMessage(m qModels.QueueMessage) {
-	params := external.InitMessageBirdParams(m.GetDataCoding(), m.GetUDH())
-	a, err := q.Mb.NewMessage(m.GetOriginator(), m.GetRecipients(), m.GetMessage(), params)
+// SendMessage sends message to the SMS provider. Message stays persisted till all the parts of its group are sent
+func (q *queue) SendMessage(m qModels.QueueMessage) error {
+	sms := &external.SMS{
+		Originator:  m.GetOriginator(),
+		Recipients:  m.GetRecipients(),
+		Body:        m.GetMessage(),
+		UDH:         m.GetUDH(),
+		DataCoding:  m.GetDataCoding(),
+		ScheduledAt: m.GetScheduledAt(),
+	}
+
+	start := q.Clock.Now()
+	a, err := q.Gateway.Send(sms)
+	d := q.Clock.Now().Sub(start)
+	q.Metrics.ProviderCalled(d, err)
+
+	lg := q.log(m).With(utils.Fields{"latency_ms": d.Seconds() * 1000})
 
-	fmt.Println("----------------")
-	fmt.Printf("MB Response:\n %#v;\n\nParams:\n %#v;\n\nOriginal message:\n %#v;\n\nError:\n %#v;\n\n Time:\n %v\n", a, params, m, err, time.Now())
-	fmt.Println("----------------")
+	if err != nil {
+		lg.Error("message not sent", utils.Fields{"error": err})
+		return err
+	}
+
+	if a != nil {
+		lg = lg.With(utils.Fields{"provider_id": a.ID})
+	}
+
+	lg.Info("message sent", nil)
+
+	s := qModels.Sent
+
+	if !m.GetScheduledAt().IsZero() {
+		s = qModels.Scheduled
+	}
+
+	recipients := partRecipients(m)
+
+	for _, r := range m.GetReferences() {
+		q.Tracker.SetState(r, recipients[r], s)
+
+		if a != nil && a.ID != "" {
+			q.Tracker.AddMessageBirdID(r, a.ID, recipients[r])
+		}
+	}
+
+	return nil
+}
+
+// Replay takes the message out of the dead-letter store and sends all its parts back to the queue
+func (q *queue) Replay(id string) bool {
+	l, ok, err := q.Dead.Remove(id)
 
 	if err != nil {
-		q.Push(m)
+		q.Logger.Error("unable to persist replayed dead letter", utils.Fields{"id": id, "error": err})
+	}
+
+	if !ok {
+		return false
 	}
+
+	for _, m := range l.Parts {
+		m.ResetAttempts()
+	}
+
+	q.Push(l.Parts...)
+
+	return true
+}
+
+// handleFailure postpones the next attempt to send all the parts of the group or moves them to the dead-letter store
+func (q *queue) handleFailure(g *group, err error) {
+	m := g.next()
+
+	// parts that are sent already are sent again as well
+	g.Sent = 0
+
+	if !external.IsPermanentError(err) {
+		if d, ok := q.Retry.Backoff(m.GetAttempts() + 1); ok {
+			at := q.Clock.Now().Add(d)
+
+			for _, p := range g.Parts {
+				p.Retry(at)
+				q.setState(p, qModels.Retrying)
+				q.retry(p)
+			}
+
+			q.log(m).Info("message retry scheduled", utils.Fields{"retry_at": at, "parts": len(g.Parts)})
+			q.Metrics.Retried()
+			q.requeue(g)
+			return
+		}
+	}
+
+	q.log(m).Error("message moved to dead-letter store", utils.Fields{"error": err, "parts": len(g.Parts)})
+
+	for _, p := range g.Parts {
+		// count the last failed attempt as well
+		p.Retry(time.Time{})
+		q.setState(p, qModels.Failed)
+		q.remove(p)
+	}
+
+	// parts are replayed together as well
+	if _, err := q.Dead.Add(err.Error(), g.Parts...); err != nil {
+		q.log(m).Error("unable to persist dead letter", utils.Fields{"error": err})
+	}
+}
+
+func (q *queue) setState(m qModels.QueueMessage, s qModels.State) {
+	recipients := partRecipients(m)
+
+	for _, r := range m.GetReferences() {
+		q.Tracker.SetState(r, recipients[r], s)
+	}
+}
+
+// partRecipients returns the recipients of every submitted message part delivered within the message
+func partRecipients(m qModels.QueueMessage) map[qModels.PartRef][]string {
+	result := map[qModels.PartRef][]string{}
+
+	for _, d := range m.GetDeliveries() {
+		result[d.Ref] = append(result[d.Ref], d.Recipient)
+	}
+
+	return result
+}
+
+// remove forgets about the message that left the queue
+func (q *queue) remove(m qModels.QueueMessage) {
+	if err := q.Storage.Remove(m); err != nil {
+		q.log(m).Error("unable to remove persisted message", utils.Fields{"error": err})
+	}
+}
+
+// retry persists the failed attempts of the message that stays in the queue
+func (q *queue) retry(m qModels.QueueMessage) {
+	if err := q.Storage.Retry(m); err != nil {
+		q.log(m).Error("unable to persist message retry", utils.Fields{"error": err})
+	}
+}
+
+// log returns the logger that adds the request identifiers and the parts of the message to every entry,
+// so the submitted message could be traced to the SMS provider calls
+func (q *queue) log(m qModels.QueueMessage) utils.Logger {
+	return q.Logger.With(utils.Fields{
+		"request_ids": m.GetRequestIDs(),
+		"references":  m.GetReferences(),
+		"recipients":  m.GetRecipientsAmount(),
+		"attempts":    m.GetAttempts(),
+	})
 }
@@ -1,9 +1,18 @@
 package queue_test
 
 import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"external"
+	"io/ioutil"
 	"mocks"
+	"net/http"
+	"net/http/httptest"
 	"queue"
 	"reflect"
+	"sort"
+	"strconv"
 	"testing"
 
 	"queue/models"
@@ -13,19 +22,132 @@ import (
 	"time"
 
 	"errors"
+	"utils"
 
 	"github.com/messagebird/go-rest-api"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
 )
 
+// logger drops all the entries
+func logger() utils.Logger {
+	return utils.InitLogger(ioutil.Discard, utils.InitClock(), utils.ErrorLevel)
+}
+
+// fixture is the queue with the stopped clock that sends the messages through the MessageBird mock
+type fixture struct {
+	Queue       queue.MessageQueue
+	Config      queue.Config
+	Clock       *mocks.ClockMock
+	MessageBird *mocks.ExternalMessageBirdClientMock
+	Sent        chan mock.Arguments // calls to MessageBird
+}
+
+// initFixture starts the queue without rate limits and retry delays. The config could be changed before the queue is
+// started. MessageBird accepts all the messages it's not told to respond otherwise
+func initFixture(change func(f *fixture)) *fixture {
+	c := mocks.NewClockMock(time.Date(2017, 1, 1, 0, 0, 0, 0, time.UTC))
+	f := &fixture{Clock: c, MessageBird: &mocks.ExternalMessageBirdClientMock{}, Sent: make(chan mock.Arguments, 1000)}
+	f.Config = queue.Config{
+		Gateway:  external.InitMessageBirdGateway(f.MessageBird),
+		Tracker:  queue.InitStatusTracker(time.Hour, c),
+		Storage:  queue.InitMemoryStorage(),
+		Retry:    queue.InitRetryPolicy(3, 0, 0),
+		Dead:     queue.InitDeadLetterStore(c),
+		Limiter:  queue.InitRateLimiter(c, queue.Limit{}, nil),
+		Priority: queue.InitPriorityPolicy(0),
+		Merge:    queue.InitMergePolicy(0),
+		Clock:    c,
+		Tick:     time.Second,
+		Metrics:  utils.InitMetrics(),
+		Logger:   logger(),
+	}
+
+	if change != nil {
+		change(f)
+	}
+
+	f.respond(mock.Anything, &messagebird.Message{}, nil)
+	f.Queue = queue.InitQueue(f.Config)
+
+	return f
+}
+
+// respond to the messages with the body (mock.Anything for all of them)
+func (f *fixture) respond(body interface{}, m *messagebird.Message, err error) *mock.Call {
+	return f.MessageBird.On("NewMessage", mock.Anything, mock.Anything, body, mock.Anything).Return(m, err).Run(func(args mock.Arguments) {
+		f.Sent <- args
+	})
+}
+
+// advance moves the clock forward once the queue is waiting for it and returns the calls to MessageBird made meanwhile
+func (f *fixture) advance(d time.Duration) []mock.Arguments {
+	// let the pipe deliver the messages to the collection
+	time.Sleep(50 * time.Millisecond)
+	f.Clock.BlockUntil(1)
+	f.Clock.Advance(d)
+	// queue waits for the clock again only after sending is done
+	f.Clock.BlockUntil(1)
+
+	var calls []mock.Arguments
+
+	for {
+		select {
+		case args := <-f.Sent:
+			calls = append(calls, args)
+		default:
+			return calls
+		}
+	}
+}
+
+// tick moves the clock forward by the queue tick
+func (f *fixture) tick() []mock.Arguments {
+	return f.advance(f.Config.Tick)
+}
+
+// bodies of the sent messages
+func bodies(calls []mock.Arguments) []string {
+	var result []string
+
+	for _, args := range calls {
+		result = append(result, args.String(2))
+	}
+
+	return result
+}
+
+// originators of the sent messages
+func originators(calls []mock.Arguments) []string {
+	var result []string
+
+	for _, args := range calls {
+		result = append(result, args.String(0))
+	}
+
+	return result
+}
+
+// initPart of the submitted message
+func initPart(id string, body string, part int, recipients ...int64) models.QueueMessage {
+	rm := apiModels.InitMessage()
+	rm.SetID(id)
+	reflect.ValueOf(rm).Elem().FieldByName("Recipients").Set(reflect.ValueOf(recipients))
+
+	return models.InitQueueMessage(body, "", rm, "udh"+strconv.Itoa(part), part)
+}
+
+// oneByOne lets one message per second through
+func oneByOne(f *fixture) {
+	f.Config.Limiter = queue.InitRateLimiter(f.Clock, queue.Limit{Rate: 1, Burst: 1}, nil)
+}
+
 func TestInitQueue(t *testing.T) {
-	mb := &mocks.ExternalMessageBirdClientMock{}
-	q := queue.InitQueue(mb)
+	f := initFixture(nil)
 
-	rq := reflect.ValueOf(q).Elem()
-	t.Run("inits queue with provided messagebird client", func(t *testing.T) {
-		assert.Equal(t, mb, rq.FieldByName("Mb").Interface())
+	rq := reflect.ValueOf(f.Queue).Elem()
+	t.Run("inits queue with provided sms gateway", func(t *testing.T) {
+		assert.Equal(t, external.InitMessageBirdGateway(f.MessageBird), rq.FieldByName("Gateway").Interface())
 	})
 
 	t.Run("inits queue with mutex", func(t *testing.T) {
@@ -33,81 +155,281 @@ func TestInitQueue(t *testing.T) {
 	})
 
 	t.Run("inits queue with pipe", func(t *testing.T) {
-		assert.Equal(t, "chan models.QueueMessage", rq.FieldByName("Pipe").Type().String())
+		assert.Equal(t, "chan *queue.group", rq.FieldByName("Pipe").Type().String())
+	})
+
+	t.Run("inits queue with provided status tracker", func(t *testing.T) {
+		assert.Equal(t, f.Config.Tracker, rq.FieldByName("Tracker").Interface())
 	})
 
 	t.Run("inits queue with empty working messages collection", func(t *testing.T) {
-		assert.Equal(t, "[]models.QueueMessage", rq.FieldByName("Collection").Type().String())
+		assert.Equal(t, "[]*queue.group", rq.FieldByName("Collection").Type().String())
 	})
 }
 
 func TestQueue_Push(t *testing.T) {
-	t.Run("pushed messages are sent to messagebird every second", func(t *testing.T) {
+	t.Run("pushed messages are sent to messagebird", func(t *testing.T) {
 		t.Run("two identical messages should be sent separately twice", func(t *testing.T) {
 			t.Parallel()
-			mb := &mocks.ExternalMessageBirdClientMock{}
-			q := queue.InitQueue(mb)
-
-			m1 := models.InitQueueMessage("m1", "", apiModels.InitMessage(), "")
-			m2 := models.InitQueueMessage("m2", "", apiModels.InitMessage(), "")
-
-			mbMes := &messagebird.Message{}
-			mb.On("NewMessage", mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return(mbMes, nil)
+			f := initFixture(nil)
 
-			q.Push(m1, m2)
+			m1 := models.InitQueueMessage("m1", "", apiModels.InitMessage(), "", 1)
+			m2 := models.InitQueueMessage("m2", "", apiModels.InitMessage(), "", 1)
 
-			// 1 sec per message + threshold
-			time.Sleep(2*time.Second + 100*time.Millisecond)
+			f.Queue.Push(m1, m2)
 
-			mb.AssertNumberOfCalls(t, "NewMessage", 2)
+			assert.Len(t, f.tick(), 2)
 		})
 
 		t.Run("identical messages with different recipients sent as one message", func(t *testing.T) {
 			t.Parallel()
-			mb := &mocks.ExternalMessageBirdClientMock{}
-			q := queue.InitQueue(mb)
+			f := initFixture(nil)
 
 			rm1 := apiModels.InitMessage()
 			reflect.ValueOf(rm1).Elem().FieldByName("Recipient").SetInt(123123)
 			rm2 := apiModels.InitMessage()
 			reflect.ValueOf(rm2).Elem().FieldByName("Recipient").SetInt(123)
 
-			m1 := models.InitQueueMessage("m1", "", rm1, "")
-			m2 := models.InitQueueMessage("m1", "", rm2, "")
+			m1 := models.InitQueueMessage("m1", "", rm1, "", 1)
+			m2 := models.InitQueueMessage("m1", "", rm2, "", 1)
 
-			mbMes := &messagebird.Message{}
-			mb.On("NewMessage", mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return(mbMes, nil)
+			f.Queue.Push(m1, m2)
 
-			q.Push(m1, m2)
+			assert.Len(t, f.tick(), 1)
+			assert.Empty(t, f.tick())
+		})
+
+		t.Run("identical messages from different originators are not merged", func(t *testing.T) {
+			t.Parallel()
+			f := initFixture(nil)
+
+			rm1 := apiModels.InitMessage()
+			reflect.ValueOf(rm1).Elem().FieldByName("Recipient").SetInt(123123)
+			reflect.ValueOf(rm1).Elem().FieldByName("Originator").SetString("first")
+			rm2 := apiModels.InitMessage()
+			reflect.ValueOf(rm2).Elem().FieldByName("Recipient").SetInt(123)
+			reflect.ValueOf(rm2).Elem().FieldByName("Originator").SetString("second")
 
-			// 1 sec per message + threshold
-			time.Sleep(2*time.Second + 100*time.Millisecond)
+			f.Queue.Push(models.InitQueueMessage("m1", "", rm1, "", 1), models.InitQueueMessage("m1", "", rm2, "", 1))
 
-			mb.AssertNumberOfCalls(t, "NewMessage", 1)
+			assert.Len(t, f.tick(), 2)
+			f.MessageBird.AssertCalled(t, "NewMessage", "first", []string{"123123"}, "m1", mock.Anything)
+			f.MessageBird.AssertCalled(t, "NewMessage", "second", []string{"123"}, "m1", mock.Anything)
 		})
 
 		t.Run("if there was an error - add it back to the queue", func(t *testing.T) {
 			t.Parallel()
-			mb := &mocks.ExternalMessageBirdClientMock{}
-			q := queue.InitQueue(mb)
-			m := models.InitQueueMessage("m1", "", apiModels.InitMessage(), "")
+			f := initFixture(func(f *fixture) {
+				f.respond(mock.Anything, &messagebird.Message{}, errors.New("err"))
+			})
+
+			f.Queue.Push(models.InitQueueMessage("m1", "", apiModels.InitMessage(), "", 1))
+
+			assert.Len(t, f.tick(), 1)
+			assert.Len(t, f.tick(), 1)
+		})
+
+		t.Run("all the recipients of the submitted message are sent as one message", func(t *testing.T) {
+			t.Parallel()
+			f := initFixture(nil)
+
+			rm := apiModels.InitMessage()
+			reflect.ValueOf(rm).Elem().FieldByName("Recipients").Set(reflect.ValueOf([]int64{123, 321}))
+
+			f.Queue.Push(models.InitQueueMessage("m1", "", rm, "", 1))
+
+			assert.Len(t, f.tick(), 1)
+			f.MessageBird.AssertCalled(t, "NewMessage", mock.Anything, []string{"123", "321"}, "m1", mock.Anything)
+		})
+
+		t.Run("sent message parts are tracked with messagebird ids", func(t *testing.T) {
+			t.Parallel()
+			f := initFixture(func(f *fixture) {
+				f.respond(mock.Anything, &messagebird.Message{Id: "mb"}, nil)
+			})
+
+			rm := apiModels.InitMessage()
+			rm.SetID("id")
+			reflect.ValueOf(rm).Elem().FieldByName("Recipient").SetInt(123)
+			st := f.Config.Tracker
+			st.Track("id", 1)
+
+			f.Queue.Push(models.InitQueueMessage("m1", "", rm, "", 1))
+			f.tick()
+
+			s, _ := st.Get("id")
+			assert.Equal(t, models.Sent, s.State)
+			assert.Equal(t, []string{"mb"}, s.Parts[0].MessageBirdIDs)
+			assert.True(t, st.Report(&models.DeliveryReport{MessageBirdID: "mb", Recipient: "123", Status: "delivered"}))
+		})
+
+		t.Run("message part is sent only when all its batches are sent", func(t *testing.T) {
+			t.Parallel()
+			f := initFixture(func(f *fixture) {
+				f.Config.Merge = queue.InitMergePolicy(1)
+				f.Config.Retry = queue.InitRetryPolicy(3, time.Minute, time.Minute)
+				f.MessageBird.On("NewMessage", mock.Anything, []string{"1"}, mock.Anything, mock.Anything).Return(&messagebird.Message{}, errors.New("err")).Once()
+			})
+
+			f.Config.Tracker.Track("a", 1)
+			f.Queue.Push(initPart("a", "p1", 1, 1, 2))
+
+			assert.Equal(t, []string{"p1"}, bodies(f.tick()))
+
+			s, _ := f.Config.Tracker.Get("a")
+			assert.Equal(t, models.Retrying, s.Parts[0].State)
+
+			assert.Equal(t, []string{"p1"}, bodies(f.advance(time.Minute)))
+
+			s, _ = f.Config.Tracker.Get("a")
+			assert.Equal(t, models.Sent, s.Parts[0].State)
+		})
+
+		t.Run("pending messages from the storage are replayed", func(t *testing.T) {
+			t.Parallel()
+			s := queue.InitMemoryStorage()
+
+			rm := apiModels.InitMessage()
+			reflect.ValueOf(rm).Elem().FieldByName("Recipient").SetInt(123)
+			s.Save(models.InitQueueMessage("m1", "", rm, "", 1))
+
+			f := initFixture(func(f *fixture) {
+				f.Config.Storage = s
+			})
+
+			assert.Len(t, f.tick(), 1)
+			f.MessageBird.AssertCalled(t, "NewMessage", mock.Anything, []string{"123"}, "m1", mock.Anything)
+			assert.Empty(t, s.Load())
+		})
+
+		t.Run("pending messages from the storage are tracked as queued", func(t *testing.T) {
+			t.Parallel()
+			s := queue.InitMemoryStorage()
+
+			rm := apiModels.InitMessage()
+			rm.SetID("id")
+			rm.SetClient("shop")
+			reflect.ValueOf(rm).Elem().FieldByName("Recipient").SetInt(123)
+			s.Save(models.InitQueueMessage("m1", "", rm, "udh1", 1))
+			s.Save(models.InitQueueMessage("m2", "", rm, "udh2", 2))
+
+			// the clock is never advanced, so nothing is sent
+			f := initFixture(func(f *fixture) {
+				f.Config.Storage = s
+			})
+
+			status, ok := f.Config.Tracker.Get("id")
+
+			assert.True(t, ok)
+			assert.Equal(t, models.Queued, status.State)
+			assert.Len(t, status.Parts, 2)
+			assert.Equal(t, "shop", status.Client)
+		})
+
+		t.Run("message rejected by messagebird is moved to dead letters right away", func(t *testing.T) {
+			t.Parallel()
+			mbMes := &messagebird.Message{Errors: []messagebird.Error{{Code: 10, Description: "invalid", Parameter: "recipient"}}}
+			f := initFixture(func(f *fixture) {
+				f.respond(mock.Anything, mbMes, messagebird.ErrResponse)
+			})
+
+			rm := apiModels.InitMessage()
+			rm.SetID("id")
+			reflect.ValueOf(rm).Elem().FieldByName("Recipient").SetInt(123)
+			f.Config.Tracker.Track("id", 1)
+
+			f.Queue.Push(models.InitQueueMessage("m1", "", rm, "", 1))
+
+			assert.Len(t, f.tick(), 1)
+			assert.Empty(t, f.tick())
+
+			l := f.Config.Dead.List()
+			assert.Len(t, l, 1)
+			assert.Equal(t, 1, l[0].Attempts)
+			assert.Equal(t, "The MessageBird API returned an error; 10: invalid (recipient)", l[0].Reason)
+
+			status, _ := f.Config.Tracker.Get("id")
+			assert.Equal(t, models.Failed, status.State)
+			assert.Empty(t, f.Config.Storage.Load())
+		})
+
+		t.Run("message is moved to dead letters when it runs out of attempts", func(t *testing.T) {
+			t.Parallel()
+			f := initFixture(func(f *fixture) {
+				f.Config.Retry = queue.InitRetryPolicy(2, 0, 0)
+				f.respond(mock.Anything, &messagebird.Message{}, errors.New("err"))
+			})
+
+			f.Queue.Push(models.InitQueueMessage("m1", "", apiModels.InitMessage(), "", 1))
 
-			mbMes := &messagebird.Message{}
-			err := errors.New("err")
-			mb.On("NewMessage", mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return(mbMes, err)
+			assert.Len(t, f.tick(), 1)
+			assert.Len(t, f.tick(), 1)
+			assert.Empty(t, f.tick())
+			assert.Len(t, f.Config.Dead.List(), 1)
+		})
+
+		t.Run("failed attempts are not forgotten after the restart", func(t *testing.T) {
+			t.Parallel()
+			s := queue.InitMemoryStorage()
+			f := initFixture(func(f *fixture) {
+				f.Config.Storage = s
+				f.Config.Retry = queue.InitRetryPolicy(2, 0, 0)
+				f.respond(mock.Anything, &messagebird.Message{}, errors.New("err"))
+			})
+
+			f.Queue.Push(models.InitQueueMessage("m1", "", apiModels.InitMessage(), "", 1))
+			assert.Len(t, f.tick(), 1)
+
+			// the first queue is never advanced again, the restarted one takes over the storage
+			restarted := initFixture(func(r *fixture) {
+				r.Config.Storage = s
+				r.Config.Retry = queue.InitRetryPolicy(2, 0, 0)
+				r.respond(mock.Anything, &messagebird.Message{}, errors.New("err"))
+			})
+
+			assert.Len(t, restarted.tick(), 1)
+			assert.Empty(t, restarted.tick())
+
+			l := restarted.Config.Dead.List()
+			assert.Len(t, l, 1)
+			assert.Equal(t, 2, l[0].Attempts)
+		})
+
+		t.Run("failed message is not sent before the backoff delay", func(t *testing.T) {
+			t.Parallel()
+			f := initFixture(func(f *fixture) {
+				f.Config.Retry = queue.InitRetryPolicy(3, time.Minute, time.Minute)
+				f.respond(mock.Anything, &messagebird.Message{}, errors.New("err"))
+			})
+
+			f.Queue.Push(models.InitQueueMessage("m1", "", apiModels.InitMessage(), "", 1))
+
+			assert.Len(t, f.tick(), 1)
+			assert.Empty(t, f.tick())
+			assert.Len(t, f.advance(time.Minute), 1)
+		})
+
+		t.Run("replayed dead letter is sent again", func(t *testing.T) {
+			t.Parallel()
+			f := initFixture(nil)
 
-			q.Push(m)
+			m := models.InitQueueMessage("m1", "", apiModels.InitMessage(), "", 1)
+			m.Retry(f.Clock.Now().Add(time.Hour))
+			ls, _ := f.Config.Dead.Add("reason", m)
 
-			// 1 sec per message + threshold
-			time.Sleep(2*time.Second + 100*time.Millisecond)
+			assert.False(t, f.Queue.Replay("unknown"))
+			assert.True(t, f.Queue.Replay(ls[0].ID))
 
-			mb.AssertNumberOfCalls(t, "NewMessage", 2)
+			assert.Len(t, f.tick(), 1)
+			assert.Empty(t, f.Config.Dead.List())
 		})
 
 		t.Run("message with bigger amount of recipients should be a priority", func(t *testing.T) {
 			t.Parallel()
-			mb := &mocks.ExternalMessageBirdClientMock{}
-			q := queue.InitQueue(mb)
+			f := initFixture(func(f *fixture) {
+				oneByOne(f)
+				f.respond(mock.Anything, &messagebird.Message{}, errors.New("err"))
+			})
 
 			rm2 := apiModels.InitMessage()
 			reflect.ValueOf(rm2).Elem().FieldByName("Recipient").SetInt(123)
@@ -115,21 +437,485 @@ func TestQueue_Push(t *testing.T) {
 			rm3 := apiModels.InitMessage()
 			reflect.ValueOf(rm3).Elem().FieldByName("Recipient").SetInt(123123123)
 
-			m1 := models.InitQueueMessage("m1", "", apiModels.InitMessage(), "1")
-			m2 := models.InitQueueMessage("m2", "", rm2, "2")
-			m3 := models.InitQueueMessage("m2", "", rm3, "2")
+			m1 := models.InitQueueMessage("m1", "", apiModels.InitMessage(), "1", 1)
+			m2 := models.InitQueueMessage("m2", "", rm2, "2", 1)
+			m3 := models.InitQueueMessage("m2", "", rm3, "2", 1)
 
-			mbMes := &messagebird.Message{}
-			err := errors.New("err")
-			mb.On("NewMessage", mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return(mbMes, err)
+			f.Queue.Push(m1, m2, m3)
 
-			q.Push(m1, m2, m3)
+			assert.Len(t, f.tick(), 1)
+			f.MessageBird.AssertCalled(t, "NewMessage", mock.Anything, []string{"123", "123123123"}, "m2", mock.Anything)
+		})
+	})
+
+	t.Run("messages are sent through any sms gateway", func(t *testing.T) {
+		t.Parallel()
+		sim := external.InitSimulator(utils.InitClock(), external.SimulatorConfig{RejectedRecipients: map[string]bool{"321": true}})
+		f := initFixture(func(f *fixture) {
+			f.Config.Gateway = sim
+		})
 
-			// 1 sec per message + threshold
-			time.Sleep(1*time.Second + 100*time.Millisecond)
+		rm1 := apiModels.InitMessage()
+		reflect.ValueOf(rm1).Elem().FieldByName("Recipient").SetInt(123)
+		rm2 := apiModels.InitMessage()
+		reflect.ValueOf(rm2).Elem().FieldByName("Recipient").SetInt(321)
 
-			mb.AssertNumberOfCalls(t, "NewMessage", 1)
-			mb.AssertCalled(t, "NewMessage", mock.Anything, []string{"123", "123123123"}, "m2", mock.Anything)
+		f.Queue.Push(models.InitQueueMessage("m1", "", rm1, "", 1), models.InitQueueMessage("m2", "", rm2, "", 1))
+		f.tick()
+
+		l := f.Config.Dead.List()
+		assert.Len(t, sim.Received(), 2)
+		assert.Len(t, l, 1)
+		assert.Equal(t, []string{"321"}, l[0].Parts[0].GetRecipients())
+	})
+
+	t.Run("queue activity is reported to metrics", func(t *testing.T) {
+		t.Parallel()
+		f := initFixture(func(f *fixture) {
+			f.Config.Gateway = external.InitSimulator(utils.InitClock(), external.SimulatorConfig{FailureRate: 1})
+			f.Config.Retry = queue.InitRetryPolicy(3, time.Minute, time.Minute)
 		})
+
+		rm1 := apiModels.InitMessage()
+		reflect.ValueOf(rm1).Elem().FieldByName("Recipient").SetInt(123)
+		rm2 := apiModels.InitMessage()
+		reflect.ValueOf(rm2).Elem().FieldByName("Recipient").SetInt(321)
+
+		f.Queue.Push(models.InitQueueMessage("m1", "", rm1, "", 1), models.InitQueueMessage("m1", "", rm2, "", 1))
+		f.tick()
+
+		rec := httptest.NewRecorder()
+		f.Config.Metrics.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+
+		assert.Contains(t, rec.Body.String(), "birdfeeder_queue_merges_total 1")
+		assert.Contains(t, rec.Body.String(), "birdfeeder_provider_errors_total 1")
+		assert.Contains(t, rec.Body.String(), "birdfeeder_queue_retries_total 1")
+		// merged message is waiting for the next attempt
+		assert.Contains(t, rec.Body.String(), "birdfeeder_queue_depth 1")
+	})
+
+	t.Run("scheduled messages", func(t *testing.T) {
+		initMessage := func(id string, recipient int64, at time.Time) models.QueueMessage {
+			rm := apiModels.InitMessage()
+			rm.SetID(id)
+			reflect.ValueOf(rm).Elem().FieldByName("Recipient").SetInt(recipient)
+			reflect.ValueOf(rm).Elem().FieldByName("ScheduledAt").Set(reflect.ValueOf(&at))
+
+			return models.InitQueueMessage("m1", "", rm, "", 1)
+		}
+
+		t.Run("identical messages with different schedule are not sent together", func(t *testing.T) {
+			t.Parallel()
+			f := initFixture(nil)
+
+			at := f.Clock.Now().Add(time.Hour)
+
+			f.Queue.Push(initMessage("a", 123, at), initMessage("b", 321, at.Add(time.Minute)), initMessage("c", 456, at))
+
+			assert.Len(t, f.tick(), 2)
+			f.MessageBird.AssertCalled(t, "NewMessage", mock.Anything, []string{"123", "456"}, "m1", mock.Anything)
+			f.MessageBird.AssertCalled(t, "NewMessage", mock.Anything, []string{"321"}, "m1", mock.Anything)
+		})
+
+		t.Run("scheduled time is sent to messagebird", func(t *testing.T) {
+			t.Parallel()
+			f := initFixture(nil)
+
+			at := f.Clock.Now().Add(time.Hour)
+			f.Config.Tracker.Track("a", 1)
+
+			f.Queue.Push(initMessage("a", 123, at))
+
+			calls := f.tick()
+			assert.Len(t, calls, 1)
+			assert.True(t, calls[0].Get(3).(*messagebird.MessageParams).ScheduledDatetime.Equal(at))
+
+			s, _ := f.Config.Tracker.Get("a")
+			assert.Equal(t, models.Scheduled, s.State)
+		})
+	})
+
+	t.Run("pushed messages are sent as fast as the rate limiter allows", func(t *testing.T) {
+		limit := func(global queue.Limit, originators map[string]queue.Limit) func(f *fixture) {
+			return func(f *fixture) {
+				f.Config.Limiter = queue.InitRateLimiter(f.Clock, global, originators)
+			}
+		}
+
+		initMessage := func(body string, originator string) models.QueueMessage {
+			rm := apiModels.InitMessage()
+			reflect.ValueOf(rm).Elem().FieldByName("Originator").SetString(originator)
+			return models.InitQueueMessage(body, "", rm, "", 1)
+		}
+
+		t.Run("burst is sent at once and the rest with the provided rate", func(t *testing.T) {
+			t.Parallel()
+			f := initFixture(limit(queue.Limit{Rate: 2, Burst: 2}, nil))
+
+			f.Queue.Push(initMessage("m1", "o"), initMessage("m2", "o"), initMessage("m3", "o"), initMessage("m4", "o"), initMessage("m5", "o"))
+
+			assert.Len(t, f.advance(time.Second), 2)
+			assert.Len(t, f.advance(500*time.Millisecond), 1)
+			assert.Len(t, f.advance(500*time.Millisecond), 1)
+			assert.Len(t, f.advance(500*time.Millisecond), 1)
+			assert.Len(t, f.advance(time.Second), 0)
+		})
+
+		t.Run("originator sub-limit does not hold back other originators", func(t *testing.T) {
+			t.Parallel()
+			f := initFixture(limit(queue.Limit{Rate: 10, Burst: 10}, map[string]queue.Limit{"slow": {Rate: 1, Burst: 1}}))
+
+			f.Queue.Push(initMessage("m1", "slow"), initMessage("m2", "slow"), initMessage("m3", "fast"), initMessage("m4", "fast"))
+
+			o := originators(f.tick())
+			sort.Strings(o)
+
+			assert.Equal(t, []string{"fast", "fast", "slow"}, o)
+			assert.Equal(t, []string{"slow"}, originators(f.tick()))
+		})
+	})
+
+	t.Run("pushed messages are sent by priority", func(t *testing.T) {
+		t.Parallel()
+		f := initFixture(func(f *fixture) {
+			oneByOne(f)
+			f.Config.Priority = queue.InitPriorityPolicy(2 * time.Second)
+		})
+
+		push := func(body string, p apiModels.Priority) {
+			rm := apiModels.InitMessage()
+			reflect.ValueOf(rm).Elem().FieldByName("Priority").SetString(string(p))
+			f.Queue.Push(models.InitQueueMessage(body, "", rm, "", 1))
+		}
+
+		push("bulk", apiModels.PriorityBulk)
+		push("otp1", apiModels.PriorityOTP)
+		assert.Equal(t, []string{"otp1"}, bodies(f.tick()))
+
+		push("otp2", apiModels.PriorityOTP)
+		assert.Equal(t, []string{"otp2"}, bodies(f.tick()))
+
+		push("otp3", apiModels.PriorityOTP)
+		assert.Equal(t, []string{"otp3"}, bodies(f.tick()))
+
+		// bulk message waited long enough to be raised to otp class and it's queued earlier
+		push("otp4", apiModels.PriorityOTP)
+		assert.Equal(t, []string{"bulk"}, bodies(f.tick()))
+		assert.Equal(t, []string{"otp4"}, bodies(f.tick()))
+	})
+}
+
+func TestQueue_Groups(t *testing.T) {
+	// failOnce makes every listed body fail once
+	failOnce := func(errs map[string]error) func(f *fixture) {
+		return func(f *fixture) {
+			for body, err := range errs {
+				f.respond(body, &messagebird.Message{}, err).Once()
+			}
+		}
+	}
+
+	t.Run("parts are sent in order", func(t *testing.T) {
+		t.Parallel()
+		f := initFixture(nil)
+
+		f.Queue.Push(initPart("a", "a3", 3, 1), initPart("a", "a1", 1, 1), initPart("a", "a2", 2, 1))
+
+		assert.Equal(t, []string{"a1", "a2", "a3"}, bodies(f.tick()))
+	})
+
+	t.Run("nothing is sent between the parts", func(t *testing.T) {
+		t.Parallel()
+		f := initFixture(oneByOne)
+
+		f.Queue.Push(initPart("a", "a1", 1, 1), initPart("a", "a2", 2, 1), initPart("a", "a3", 3, 1))
+		assert.Equal(t, []string{"a1"}, bodies(f.tick()))
+
+		rm := apiModels.InitMessage()
+		reflect.ValueOf(rm).Elem().FieldByName("Priority").SetString("otp")
+		f.Queue.Push(models.InitQueueMessage("otp", "", rm, "", 1))
+
+		assert.Equal(t, []string{"a2"}, bodies(f.tick()))
+		assert.Equal(t, []string{"a3"}, bodies(f.tick()))
+		assert.Equal(t, []string{"otp"}, bodies(f.tick()))
+	})
+
+	t.Run("nothing from other originators is sent between the parts", func(t *testing.T) {
+		t.Parallel()
+		f := initFixture(func(f *fixture) {
+			f.Config.Limiter = queue.InitRateLimiter(f.Clock, queue.Limit{}, map[string]queue.Limit{"limited": {Rate: 1, Burst: 1}})
+		})
+
+		from := func(originator string, m models.QueueMessage) models.QueueMessage {
+			rm := apiModels.InitMessage()
+			rm.SetID(m.GetRef().MessageID)
+			reflect.ValueOf(rm).Elem().FieldByName("Originator").SetString(originator)
+			reflect.ValueOf(rm).Elem().FieldByName("Recipient").SetInt(1)
+
+			return models.InitQueueMessage(m.GetMessage(), "", rm, m.GetUDH(), m.GetPart())
+		}
+
+		f.Queue.Push(from("limited", initPart("a", "a1", 1, 1)), from("limited", initPart("a", "a2", 2, 1)))
+		f.Queue.Push(from("other", initPart("b", "b1", 1, 1)))
+
+		assert.Equal(t, []string{"a1"}, bodies(f.tick()))
+		assert.Equal(t, []string{"a2", "b1"}, bodies(f.tick()))
+	})
+
+	t.Run("whole group is retried if any part fails", func(t *testing.T) {
+		t.Parallel()
+		f := initFixture(failOnce(map[string]error{"a2": errors.New("err")}))
+		s := f.Config.Storage
+
+		f.Queue.Push(initPart("a", "a1", 1, 1), initPart("a", "a2", 2, 1), initPart("a", "a3", 3, 1))
+
+		assert.Equal(t, []string{"a1", "a2"}, bodies(f.tick()))
+		// sent parts are kept till the whole group is sent
+		assert.Len(t, s.Load(), 3)
+
+		assert.Equal(t, []string{"a1", "a2", "a3"}, bodies(f.tick()))
+		assert.Empty(t, s.Load())
+	})
+
+	t.Run("whole group fails if any part fails permanently", func(t *testing.T) {
+		t.Parallel()
+		f := initFixture(failOnce(map[string]error{"a2": messagebird.ErrResponse}))
+		dl := f.Config.Dead
+
+		f.Queue.Push(initPart("a", "a1", 1, 1), initPart("a", "a2", 2, 1), initPart("a", "a3", 3, 1))
+
+		assert.Equal(t, []string{"a1", "a2"}, bodies(f.tick()))
+		assert.Empty(t, f.Config.Storage.Load())
+		assert.Empty(t, f.tick())
+
+		// the parts are kept and replayed together
+		l := dl.List()
+		assert.Len(t, l, 1)
+		assert.Equal(t, "a", l[0].ID)
+		assert.Len(t, l[0].Parts, 3)
+
+		assert.True(t, f.Queue.Replay("a"))
+		assert.Equal(t, []string{"a1", "a2", "a3"}, bodies(f.tick()))
+		assert.Empty(t, dl.List())
+	})
+
+	t.Run("identical groups are sent together", func(t *testing.T) {
+		t.Parallel()
+		f := initFixture(nil)
+
+		f.Queue.Push(initPart("a", "p1", 1, 1), initPart("a", "p2", 2, 1))
+		f.Queue.Push(initPart("b", "p1", 1, 2), initPart("b", "p2", 2, 2))
+
+		assert.Equal(t, []string{"p1", "p2"}, bodies(f.tick()))
+		f.MessageBird.AssertCalled(t, "NewMessage", mock.Anything, []string{"1", "2"}, "p1", mock.Anything)
+		f.MessageBird.AssertCalled(t, "NewMessage", mock.Anything, []string{"1", "2"}, "p2", mock.Anything)
+	})
+
+	t.Run("fresh group is not merged into the identical one waiting for the next attempt", func(t *testing.T) {
+		t.Parallel()
+		f := initFixture(func(f *fixture) {
+			f.Config.Retry = queue.InitRetryPolicy(3, time.Minute, time.Minute)
+			f.respond("p1", &messagebird.Message{}, errors.New("err")).Once()
+		})
+
+		f.Queue.Push(initPart("a", "p1", 1, 1), initPart("a", "p2", 2, 1))
+		assert.Equal(t, []string{"p1"}, bodies(f.tick()))
+
+		f.Queue.Push(initPart("b", "p1", 1, 2), initPart("b", "p2", 2, 2))
+
+		calls := f.tick()
+		assert.Equal(t, []string{"p1", "p2"}, bodies(calls))
+		assert.Equal(t, []string{"2"}, calls[0].Get(1))
+
+		calls = f.advance(time.Minute)
+		assert.Equal(t, []string{"p1", "p2"}, bodies(calls))
+		assert.Equal(t, []string{"1"}, calls[0].Get(1))
+		assert.Empty(t, f.Config.Dead.List())
+	})
+
+	t.Run("pending parts from the storage are replayed together", func(t *testing.T) {
+		t.Parallel()
+		s := queue.InitMemoryStorage()
+		s.Save(initPart("a", "a2", 2, 1))
+		s.Save(initPart("b", "b1", 1, 1))
+		s.Save(initPart("a", "a1", 1, 1))
+
+		f := initFixture(func(f *fixture) {
+			f.Config.Storage = s
+			oneByOne(f)
+		})
+
+		assert.Equal(t, []string{"a1"}, bodies(f.tick()))
+		assert.Equal(t, []string{"a2"}, bodies(f.tick()))
+		assert.Equal(t, []string{"b1"}, bodies(f.tick()))
+	})
+}
+
+func TestQueue_RecipientsCap(t *testing.T) {
+	// simulator accepts up to 50 recipients per message
+	withSimulator := func() (*fixture, external.Simulator) {
+		sim := external.InitSimulator(utils.InitClock(), external.SimulatorConfig{MaxRecipients: 50})
+		f := initFixture(func(f *fixture) {
+			f.Config.Gateway = sim
+			f.Config.Merge = queue.InitMergePolicy(50)
+		})
+
+		return f, sim
+	}
+
+	t.Run("thousands of identical submissions are sent in batches", func(t *testing.T) {
+		t.Parallel()
+		f, sim := withSimulator()
+
+		for i := 1; i <= 2000; i++ {
+			f.Queue.Push(initPart(strconv.Itoa(i), "body", 1, int64(i)))
+		}
+
+		f.tick()
+
+		received := map[string]int{}
+
+		for _, m := range sim.Received() {
+			assert.Empty(t, m.Error)
+			assert.Len(t, m.Recipients, 50)
+
+			for _, r := range m.Recipients {
+				received[r]++
+			}
+		}
+
+		assert.Len(t, sim.Received(), 40)
+		assert.Len(t, received, 2000)
+
+		for r, n := range received {
+			assert.Equal(t, 1, n, r)
+		}
+
+		assert.Empty(t, f.Config.Storage.Load())
+	})
+
+	t.Run("oversized split message is sent in batches sharing the UDH", func(t *testing.T) {
+		t.Parallel()
+		f, sim := withSimulator()
+
+		var recipients []int64
+
+		for i := 1; i <= 120; i++ {
+			recipients = append(recipients, int64(i))
+		}
+
+		f.Queue.Push(initPart("a", "p1", 1, recipients...), initPart("a", "p2", 2, recipients...))
+
+		f.tick()
+
+		var bodies []string
+		var sizes []int
+
+		for _, m := range sim.Received() {
+			assert.Empty(t, m.Error)
+			assert.Equal(t, "udh"+m.Body[1:], m.UDH)
+
+			bodies = append(bodies, m.Body)
+			sizes = append(sizes, len(m.Recipients))
+		}
+
+		// every batch gets all the parts before the next one
+		assert.Equal(t, []string{"p1", "p2", "p1", "p2", "p1", "p2"}, bodies)
+		assert.Equal(t, []int{50, 50, 50, 50, 20, 20}, sizes)
+		assert.Empty(t, f.Config.Storage.Load())
+	})
+}
+
+func TestQueue_Shutdown(t *testing.T) {
+	// the queue doesn't check the collection by itself and sends one message per second
+	slow := func(f *fixture) {
+		oneByOne(f)
+		f.Config.Tick = time.Minute
+	}
+
+	t.Run("sends all pending messages before stopping", func(t *testing.T) {
+		t.Parallel()
+		f := initFixture(slow)
+		c, mb := f.Clock, f.MessageBird
+
+		f.Queue.Push(initPart("m1", "m1", 1, 123), initPart("m2", "m2", 1, 123))
+		// let the pipe deliver all the messages to the collection
+		time.Sleep(50 * time.Millisecond)
+
+		errs := make(chan error)
+
+		go func() {
+			errs <- f.Queue.Shutdown(context.Background())
+		}()
+
+		// queue waits for the next token after sending the first message (the other waiter is the abandoned tick)
+		c.BlockUntil(2)
+		mb.AssertNumberOfCalls(t, "NewMessage", 1)
+
+		c.Advance(time.Second)
+
+		assert.Nil(t, <-errs)
+		mb.AssertNumberOfCalls(t, "NewMessage", 2)
+		assert.Empty(t, f.Config.Storage.Load())
+
+		t.Run("stopped queue could be shut down again", func(t *testing.T) {
+			assert.Nil(t, f.Queue.Shutdown(context.Background()))
+		})
+	})
+
+	t.Run("messages that weren't sent before the context is done are kept in the storage", func(t *testing.T) {
+		t.Parallel()
+		f := initFixture(slow)
+
+		f.Queue.Push(initPart("m1", "m1", 1, 123), initPart("m2", "m2", 1, 123))
+		time.Sleep(50 * time.Millisecond)
+
+		ctx, cancel := context.WithCancel(context.Background())
+		errs := make(chan error)
+
+		go func() {
+			errs <- f.Queue.Shutdown(ctx)
+		}()
+
+		f.Clock.BlockUntil(2)
+		cancel()
+
+		assert.Equal(t, context.Canceled, <-errs)
+		f.MessageBird.AssertNumberOfCalls(t, "NewMessage", 1)
+		assert.Len(t, f.Config.Storage.Load(), 1)
+	})
+}
+
+func TestQueue_Logging(t *testing.T) {
+	t.Run("log entries of the sent message carry identifiers of all the merged requests", func(t *testing.T) {
+		buf := &bytes.Buffer{}
+		f := initFixture(func(f *fixture) {
+			oneByOne(f)
+			f.Config.Tick = time.Minute
+			f.Config.Logger = utils.InitLogger(buf, f.Clock, utils.InfoLevel)
+			f.respond(mock.Anything, &messagebird.Message{Id: "mb"}, nil)
+		})
+
+		initMessage := func(id string, recipient int64) models.QueueMessage {
+			rm := apiModels.InitMessage()
+			rm.SetID(id)
+			rm.SetRequestID("r" + id)
+			reflect.ValueOf(rm).Elem().FieldByName("Recipient").SetInt(recipient)
+			return models.InitQueueMessage("body", "", rm, "", 1)
+		}
+
+		f.Queue.Push(initMessage("id1", 1), initMessage("id2", 2))
+		// let the pipe deliver all the messages to the collection
+		time.Sleep(50 * time.Millisecond)
+
+		assert.Nil(t, f.Queue.Shutdown(context.Background()))
+
+		entry := map[string]interface{}{}
+		assert.Nil(t, json.Unmarshal(bytes.TrimSpace(buf.Bytes()), &entry))
+
+		assert.Equal(t, "message sent", entry["msg"])
+		assert.Equal(t, []interface{}{"rid1", "rid2"}, entry["request_ids"])
+		assert.Equal(t, "mb", entry["provider_id"])
+		assert.Equal(t, float64(2), entry["recipients"])
 	})
 }
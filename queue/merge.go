@@ -0,0 +1,93 @@
+package queue
+
+import (
+	qModels "queue/models"
+	"time"
+)
+
+// MergePolicy decides which of the queued messages are sent to their recipients within one call of the SMS provider
+type MergePolicy interface {
+	Key(m qModels.QueueMessage) string
+	Merge(m qModels.QueueMessage, o qModels.QueueMessage) qModels.QueueMessage
+	Split(m qModels.QueueMessage) []qModels.QueueMessage
+}
+
+type mergePolicy struct {
+	MaxRecipients int
+}
+
+// InitMergePolicy is MergePolicy factory method. Messages with the same originator, body, UDH, data coding and
+// schedule are merged till the merged message has the maximum amount of recipients the SMS provider accepts within
+// one call (no limit if it's zero)
+func InitMergePolicy(maxRecipients int) MergePolicy {
+	return &mergePolicy{maxRecipients}
+}
+
+// Key identifies the messages that could be merged
+func (p *mergePolicy) Key(m qModels.QueueMessage) string {
+	return m.GetOriginator() + "\x00" +
+		string(m.GetDataCoding()) + "\x00" +
+		m.GetUDH() + "\x00" +
+		m.GetMessage() + "\x00" +
+		m.GetScheduledAt().UTC().Format(time.RFC3339Nano)
+}
+
+// Merge adds recipients of the message with the same key to the first message. Recipients that are already added
+// (they are intended to receive the message twice) or don't fit into the first message are returned back within the
+// copy of the second one. The second message itself is returned if nothing was merged and nil if everything was
+func (p *mergePolicy) Merge(m qModels.QueueMessage, o qModels.QueueMessage) qModels.QueueMessage {
+	var merged, rest []qModels.Delivery
+
+	added := map[string]bool{}
+
+	for _, r := range m.GetRecipients() {
+		added[r] = true
+	}
+
+	for _, d := range o.GetDeliveries() {
+		if added[d.Recipient] || (p.MaxRecipients > 0 && len(added) >= p.MaxRecipients) {
+			rest = append(rest, d)
+			continue
+		}
+
+		added[d.Recipient] = true
+		merged = append(merged, d)
+	}
+
+	if len(merged) == 0 && len(rest) > 0 {
+		return o
+	}
+
+	m.Merge(o.WithDeliveries(merged))
+
+	if len(rest) == 0 {
+		return nil
+	}
+
+	return o.WithDeliveries(rest)
+}
+
+// Split divides the message into the copies with the maximum amount of recipients. The message itself is returned if
+// it doesn't have more recipients than that
+func (p *mergePolicy) Split(m qModels.QueueMessage) []qModels.QueueMessage {
+	ds := m.GetDeliveries()
+
+	if p.MaxRecipients <= 0 || len(ds) <= p.MaxRecipients {
+		return []qModels.QueueMessage{m}
+	}
+
+	var result []qModels.QueueMessage
+
+	for len(ds) > 0 {
+		n := p.MaxRecipients
+
+		if len(ds) < n {
+			n = len(ds)
+		}
+
+		result = append(result, m.WithDeliveries(ds[:n]))
+		ds = ds[n:]
+	}
+
+	return result
+}
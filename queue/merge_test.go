@@ -0,0 +1,227 @@
+package queue_test
+
+import (
+	apiModels "api/models"
+	"queue"
+	"queue/models"
+	"reflect"
+	"sort"
+	"testing"
+	"testing/quick"
+	"time"
+	"utils"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func initMergeMessage(originator string, body string, recipients []int64) models.QueueMessage {
+	rm := apiModels.InitMessage()
+	reflect.ValueOf(rm).Elem().FieldByName("Originator").SetString(originator)
+	reflect.ValueOf(rm).Elem().FieldByName("Recipients").Set(reflect.ValueOf(recipients))
+
+	return models.InitQueueMessage(body, utils.Plain, rm, "udh", 1)
+}
+
+func TestMergePolicy_Key(t *testing.T) {
+	p := queue.InitMergePolicy(0)
+	m := initMergeMessage("originator", "body", []int64{1})
+
+	t.Run("same content has the same key regardless of the recipients", func(t *testing.T) {
+		assert.Equal(t, p.Key(m), p.Key(initMergeMessage("originator", "body", []int64{2, 3})))
+	})
+
+	t.Run("different content has different keys", func(t *testing.T) {
+		at := time.Date(2017, 1, 1, 0, 0, 0, 0, time.UTC)
+		scheduled := apiModels.InitMessage()
+		reflect.ValueOf(scheduled).Elem().FieldByName("Originator").SetString("originator")
+		reflect.ValueOf(scheduled).Elem().FieldByName("ScheduledAt").Set(reflect.ValueOf(&at))
+
+		rm := apiModels.InitMessage()
+		reflect.ValueOf(rm).Elem().FieldByName("Originator").SetString("originator")
+
+		for name, o := range map[string]models.QueueMessage{
+			"originator": initMergeMessage("other", "body", []int64{1}),
+			"body":       initMergeMessage("originator", "other", []int64{1}),
+			"udh":        models.InitQueueMessage("body", utils.Plain, rm, "other", 1),
+			"datacoding": models.InitQueueMessage("body", utils.Unicode, rm, "udh", 1),
+			"schedule":   models.InitQueueMessage("body", utils.Plain, scheduled, "udh", 1),
+		} {
+			assert.NotEqual(t, p.Key(m), p.Key(o), name)
+		}
+	})
+}
+
+func TestMergePolicy_Merge(t *testing.T) {
+	t.Run("adds all the new recipients", func(t *testing.T) {
+		m := initMergeMessage("originator", "body", []int64{1, 2})
+
+		assert.Nil(t, queue.InitMergePolicy(0).Merge(m, initMergeMessage("originator", "body", []int64{3, 4})))
+		assert.Equal(t, []string{"1", "2", "3", "4"}, m.GetRecipients())
+	})
+
+	t.Run("returns back the recipients that are already added", func(t *testing.T) {
+		m := initMergeMessage("originator", "body", []int64{1, 2, 3})
+
+		rest := queue.InitMergePolicy(0).Merge(m, initMergeMessage("originator", "body", []int64{1, 4}))
+
+		assert.Equal(t, []string{"1", "2", "3", "4"}, m.GetRecipients())
+		assert.Equal(t, []string{"1"}, rest.GetRecipients())
+	})
+
+	t.Run("returns back the recipients that exceed the maximum", func(t *testing.T) {
+		m := initMergeMessage("originator", "body", []int64{1, 2})
+
+		rest := queue.InitMergePolicy(3).Merge(m, initMergeMessage("originator", "body", []int64{3, 4, 5}))
+
+		assert.Equal(t, []string{"1", "2", "3"}, m.GetRecipients())
+		assert.Equal(t, []string{"4", "5"}, rest.GetRecipients())
+	})
+
+	t.Run("returns the same message if nothing is merged", func(t *testing.T) {
+		m := initMergeMessage("originator", "body", []int64{1, 2})
+		o := initMergeMessage("originator", "body", []int64{3})
+
+		assert.Exactly(t, o, queue.InitMergePolicy(2).Merge(m, o))
+		assert.Equal(t, []string{"1", "2"}, m.GetRecipients())
+		assert.Len(t, m.GetReferences(), 1)
+	})
+}
+
+func TestMergePolicy_Split(t *testing.T) {
+	m := initMergeMessage("originator", "body", []int64{1, 2, 3, 4, 5})
+
+	t.Run("returns the same message if it fits", func(t *testing.T) {
+		assert.Exactly(t, []models.QueueMessage{m}, queue.InitMergePolicy(5).Split(m))
+		assert.Exactly(t, []models.QueueMessage{m}, queue.InitMergePolicy(0).Split(m))
+	})
+
+	t.Run("divides the recipients between the copies of the message", func(t *testing.T) {
+		ms := queue.InitMergePolicy(2).Split(m)
+
+		assert.Len(t, ms, 3)
+		assert.Equal(t, []string{"1", "2"}, ms[0].GetRecipients())
+		assert.Equal(t, []string{"3", "4"}, ms[1].GetRecipients())
+		assert.Equal(t, []string{"5"}, ms[2].GetRecipients())
+
+		for _, c := range ms {
+			assert.Equal(t, m.GetUDH(), c.GetUDH())
+			assert.Equal(t, m.GetReferences(), c.GetReferences())
+		}
+	})
+}
+
+func TestMergePolicy_Properties(t *testing.T) {
+	recipients := func(rs []uint8) []int64 {
+		var result []int64
+
+		// small range, so the recipients are often the same
+		for _, r := range rs {
+			result = append(result, int64(r%16)+1)
+		}
+
+		return result
+	}
+
+	sorted := func(rs ...[]string) []string {
+		result := []string{}
+
+		for _, r := range rs {
+			result = append(result, r...)
+		}
+
+		sort.Strings(result)
+
+		return result
+	}
+
+	unique := func(rs []string) bool {
+		added := map[string]bool{}
+
+		for _, r := range rs {
+			if added[r] {
+				return false
+			}
+
+			added[r] = true
+		}
+
+		return true
+	}
+
+	merge := func(a []uint8, b []uint8, max uint8) (models.QueueMessage, models.QueueMessage, models.QueueMessage, int) {
+		limit := int(max % 8)
+		m := initMergeMessage("originator", "body", recipients(a))
+		o := initMergeMessage("originator", "body", recipients(b))
+
+		return m, o, queue.InitMergePolicy(limit).Merge(m, o), limit
+	}
+
+	t.Run("no recipient is lost or duplicated", func(t *testing.T) {
+		f := func(a []uint8, b []uint8, max uint8) bool {
+			m, o, rest, _ := merge(a, b, max)
+			expected := sorted(initMergeMessage("", "", recipients(a)).GetRecipients(), o.GetRecipients())
+
+			if rest == nil {
+				return assert.ObjectsAreEqual(expected, sorted(m.GetRecipients()))
+			}
+
+			return assert.ObjectsAreEqual(expected, sorted(m.GetRecipients(), rest.GetRecipients()))
+		}
+
+		assert.NoError(t, quick.Check(f, nil))
+	})
+
+	t.Run("merged message has every recipient once", func(t *testing.T) {
+		f := func(a []uint8, b []uint8, max uint8) bool {
+			m, _, _, _ := merge(a, b, max)
+
+			return unique(m.GetRecipients())
+		}
+
+		assert.NoError(t, quick.Check(f, nil))
+	})
+
+	t.Run("merged message doesn't exceed the maximum", func(t *testing.T) {
+		f := func(a []uint8, b []uint8, max uint8) bool {
+			m, _, _, limit := merge(a, b, max)
+			before := len(initMergeMessage("", "", recipients(a)).GetRecipients())
+
+			// message that is already full gets no recipients at all
+			return limit == 0 || len(m.GetRecipients()) <= limit || len(m.GetRecipients()) == before
+		}
+
+		assert.NoError(t, quick.Check(f, nil))
+	})
+
+	t.Run("split messages have all the recipients and don't exceed the maximum", func(t *testing.T) {
+		f := func(a []uint8, max uint8) bool {
+			limit := int(max % 8)
+			m := initMergeMessage("originator", "body", recipients(a))
+
+			split := []string{}
+
+			for _, c := range queue.InitMergePolicy(limit).Split(m) {
+				if limit > 0 && len(c.GetRecipients()) > limit {
+					return false
+				}
+
+				split = append(split, c.GetRecipients()...)
+			}
+
+			return assert.ObjectsAreEqual(m.GetRecipients(), split)
+		}
+
+		assert.NoError(t, quick.Check(f, nil))
+	})
+
+	t.Run("the same message is returned only if nothing is merged", func(t *testing.T) {
+		f := func(a []uint8, b []uint8, max uint8) bool {
+			m, o, rest, _ := merge(a, b, max)
+			before := len(initMergeMessage("", "", recipients(a)).GetRecipients())
+
+			return (rest == o) == (len(m.GetRecipients()) == before && len(o.GetRecipients()) > 0)
+		}
+
+		assert.NoError(t, quick.Check(f, nil))
+	})
+}
@@ -0,0 +1,48 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// DeadLetter is a submitted message that won't be sent anymore together with the reason of the failure. Parts of
+// the split message fail together, so they are kept together in order of the parts
+type DeadLetter struct {
+	ID       string         `json:"id"`
+	Reason   string         `json:"reason"`
+	Attempts int            `json:"attempts"`
+	FailedAt time.Time      `json:"failed_at"`
+	Parts    []QueueMessage `json:"parts"`
+}
+
+// deadLetterRecord is a serializable representation of DeadLetter
+type deadLetterRecord struct {
+	ID       string            `json:"id"`
+	Reason   string            `json:"reason"`
+	Attempts int               `json:"attempts"`
+	FailedAt time.Time         `json:"failed_at"`
+	Parts    []json.RawMessage `json:"parts"`
+}
+
+// UnmarshalDeadLetter restores DeadLetter from its JSON representation
+func UnmarshalDeadLetter(b []byte) (*DeadLetter, error) {
+	r := &deadLetterRecord{}
+
+	if err := json.Unmarshal(b, r); err != nil {
+		return nil, err
+	}
+
+	l := &DeadLetter{r.ID, r.Reason, r.Attempts, r.FailedAt, make([]QueueMessage, len(r.Parts))}
+
+	for i, p := range r.Parts {
+		m, err := UnmarshalQueueMessage(p)
+
+		if err != nil {
+			return nil, err
+		}
+
+		l.Parts[i] = m
+	}
+
+	return l, nil
+}
@@ -2,35 +2,134 @@ package models
 
 import (
 	"api/models"
+	"encoding/json"
 	"errors"
-	"sort"
 	"strconv"
+	"time"
 	"utils"
 )
 
 // QueueMessage is a message that is kept within the queue
 type QueueMessage interface {
+	json.Marshaler
 	AddRecipient(r int64) error
+	Merge(o QueueMessage) QueueMessage
+	WithDeliveries(d []Delivery) QueueMessage
+	WithRetry(attempts int, at time.Time) QueueMessage
+	ForMessage(id string) QueueMessage
 	GetMessage() string
 	GetOriginalRecipient() int64
 	GetRecipientsAmount() int64
 	GetOriginator() string
 	GetRecipients() []string
+	GetDeliveries() []Delivery
 	GetDataCoding() utils.Datacoding
 	GetUDH() string
+	GetPart() int
+	GetRef() PartRef
+	AddReferences(r ...PartRef)
+	GetReferences() []PartRef
+	GetAttempts() int
+	Retry(at time.Time)
+	ResetAttempts()
+	IsDue(now time.Time) bool
+	GetRetryAt() time.Time
+	GetScheduledAt() time.Time
+	GetRequestIDs() []string
+	GetPriority() models.Priority
+	Enqueue(at time.Time)
+	GetQueuedAt() time.Time
+}
+
+// Delivery is a recipient of the message part together with the reference to the submitted message part it belongs to
+// and the name of the API client that submitted the message (empty if the request wasn't authenticated)
+type Delivery struct {
+	Recipient string  `json:"recipient"`
+	Ref       PartRef `json:"ref"`
+	Client    string  `json:"client,omitempty"`
 }
 
 type qMessage struct {
-	recipients      []string
+	recipients      []Delivery
 	Message         string
 	Encoding        utils.Datacoding
 	OriginalMessage models.Message
 	UDH             string
+	Part            int
+	references      []PartRef
+	attempts        int
+	retryAt         time.Time
+	requestIDs      []string
+	priority        models.Priority
+	queuedAt        time.Time
+}
+
+// qMessageRecord is a serializable representation of qMessage
+type qMessageRecord struct {
+	Deliveries []Delivery       `json:"deliveries"`
+	Message    string           `json:"message"`
+	Encoding   utils.Datacoding `json:"encoding"`
+	Original   json.RawMessage  `json:"original"`
+	UDH        string           `json:"udh"`
+	Part       int              `json:"part"`
+	References []PartRef        `json:"references"`
+	Attempts   int              `json:"attempts"`
+	RetryAt    time.Time        `json:"retry_at"`
+	RequestIDs []string         `json:"request_ids"`
+	Priority   models.Priority  `json:"priority"`
+	QueuedAt   time.Time        `json:"queued_at"`
 }
 
 // InitQueueMessage factory method to create QueueMessage
-func InitQueueMessage(message string, enc utils.Datacoding, m models.Message, udh string) QueueMessage {
-	return &qMessage{[]string{}, message, enc, m, udh}
+func InitQueueMessage(message string, enc utils.Datacoding, m models.Message, udh string, part int) QueueMessage {
+	ref := PartRef{m.GetID(), part}
+	ds := []Delivery{}
+
+	// all the recipients of the submitted message are batched into one message from the start
+	for _, r := range m.GetRecipients() {
+		ds = append(ds, Delivery{strconv.FormatInt(r, 10), ref, m.GetClient()})
+	}
+
+	var rids []string
+
+	if m.GetRequestID() != "" {
+		rids = []string{m.GetRequestID()}
+	}
+
+	return &qMessage{ds, message, enc, m, udh, part, []PartRef{ref}, 0, time.Time{}, rids, m.GetPriority(), time.Time{}}
+}
+
+// UnmarshalQueueMessage restores QueueMessage from its JSON representation
+func UnmarshalQueueMessage(b []byte) (QueueMessage, error) {
+	r := &qMessageRecord{}
+
+	if err := json.Unmarshal(b, r); err != nil {
+		return nil, err
+	}
+
+	om := models.InitMessage()
+
+	if err := json.Unmarshal(r.Original, om); err != nil {
+		return nil, err
+	}
+
+	// messages persisted before the priorities were introduced get the one of the submitted message
+	if r.Priority == "" {
+		r.Priority = om.GetPriority()
+	}
+
+	return &qMessage{r.Deliveries, r.Message, r.Encoding, om, r.UDH, r.Part, r.References, r.Attempts, r.RetryAt, r.RequestIDs, r.Priority, r.QueuedAt}, nil
+}
+
+// MarshalJSON returns JSON representation of the message so it could be persisted
+func (m *qMessage) MarshalJSON() ([]byte, error) {
+	om, err := json.Marshal(m.OriginalMessage)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return json.Marshal(&qMessageRecord{m.recipients, m.Message, m.Encoding, om, m.UDH, m.Part, m.references, m.attempts, m.retryAt, m.requestIDs, m.priority, m.queuedAt})
 }
 
 // GetRecipientsAmount returns the amount of recipients currently added to the message
@@ -41,21 +140,120 @@ func (m *qMessage) GetRecipientsAmount() int64 {
 // AddRecipient adds recipient to the list and returns an error if such recipient is already added
 func (m *qMessage) AddRecipient(r int64) error {
 	rs := strconv.FormatInt(r, 10)
-	l := len(m.recipients)
-
-	i := sort.Search(l, func(i int) bool {
-		return rs == m.recipients[i]
-	})
 
-	if i < len(m.recipients) {
+	if m.hasRecipient(rs) {
 		return errors.New("existing recipient")
 	}
 
-	m.recipients = append(m.recipients, rs)
+	m.recipients = append(m.recipients, Delivery{rs, m.GetRef(), m.OriginalMessage.GetClient()})
 
 	return nil
 }
 
+// Merge adds recipients of the identical message to this message. Recipients that are already added
+// are intended to receive the message twice, so they are returned back within the copy of the identical message
+func (m *qMessage) Merge(o QueueMessage) QueueMessage {
+	var rest []Delivery
+
+	ds := o.GetDeliveries()
+	added := map[string]bool{}
+
+	for _, d := range m.recipients {
+		added[d.Recipient] = true
+	}
+
+	for _, d := range ds {
+		if added[d.Recipient] {
+			rest = append(rest, d)
+			continue
+		}
+
+		added[d.Recipient] = true
+		m.recipients = append(m.recipients, d)
+	}
+
+	// nothing was merged
+	if len(ds) > 0 && len(rest) == len(ds) {
+		return o
+	}
+
+	// at least part of the recipients would receive the message together with this one
+	m.AddReferences(o.GetReferences()...)
+	m.addRequestIDs(o.GetRequestIDs()...)
+
+	// merged message is sent as soon as the most urgent of them
+	if o.GetPriority().Rank() > m.priority.Rank() {
+		m.priority = o.GetPriority()
+	}
+
+	if q := o.GetQueuedAt(); !q.IsZero() && (m.queuedAt.IsZero() || q.Before(m.queuedAt)) {
+		m.queuedAt = q
+	}
+
+	if len(rest) == 0 {
+		return nil
+	}
+
+	return o.WithDeliveries(rest)
+}
+
+// WithDeliveries returns copy of the message with the provided recipients
+func (m *qMessage) WithDeliveries(d []Delivery) QueueMessage {
+	c := *m
+	c.recipients = make([]Delivery, len(d))
+	copy(c.recipients, d)
+	c.references = m.GetReferences()
+	c.requestIDs = m.GetRequestIDs()
+
+	return &c
+}
+
+// WithRetry returns copy of the message with the provided amount of failed attempts and the time of the next one
+func (m *qMessage) WithRetry(attempts int, at time.Time) QueueMessage {
+	c := m.WithDeliveries(m.recipients).(*qMessage)
+	c.attempts = attempts
+	c.retryAt = at
+
+	return c
+}
+
+// ForMessage returns copy of the message with the recipients of the provided submitted message only or nil if it has
+// none of them
+func (m *qMessage) ForMessage(id string) QueueMessage {
+	var ds []Delivery
+
+	for _, d := range m.recipients {
+		if d.Ref.MessageID == id {
+			ds = append(ds, d)
+		}
+	}
+
+	if len(ds) == 0 {
+		return nil
+	}
+
+	c := m.WithDeliveries(ds).(*qMessage)
+	c.references = nil
+
+	for _, r := range m.references {
+		if r.MessageID == id {
+			c.references = append(c.references, r)
+		}
+	}
+
+	return c
+}
+
+func (m *qMessage) hasRecipient(r string) bool {
+	for _, i := range m.recipients {
+		if i.Recipient == r {
+			return true
+		}
+	}
+
+	return false
+}
+
 // GetMessage returns already encoded message from the message
 func (m *qMessage) GetMessage() string {
 	return m.Message
@@ -71,13 +269,29 @@ func (m *qMessage) GetOriginator() string {
 	return m.OriginalMessage.GetOriginator()
 }
 
+// GetScheduledAt returns the time when the message should be delivered (zero time if right away)
+func (m *qMessage) GetScheduledAt() time.Time {
+	return m.OriginalMessage.GetScheduledAt()
+}
+
 // GetRecipients returns collection of added recipients copy
 func (m *qMessage) GetRecipients() []string {
 	cr := make([]string, len(m.recipients))
-	copy(cr, m.recipients)
+
+	for i, d := range m.recipients {
+		cr[i] = d.Recipient
+	}
+
 	return cr
 }
 
+// GetDeliveries returns copy of the added recipients together with the parts they belong to
+func (m *qMessage) GetDeliveries() []Delivery {
+	cd := make([]Delivery, len(m.recipients))
+	copy(cd, m.recipients)
+	return cd
+}
+
 // GetDataCoding of the message
 func (m *qMessage) GetDataCoding() utils.Datacoding {
 	return m.Encoding
@@ -88,6 +302,97 @@ func (m *qMessage) GetUDH() string {
 	return m.UDH
 }
 
+// GetPart returns index of the part within the original message (starts with 1)
+func (m *qMessage) GetPart() int {
+	return m.Part
+}
+
+// GetRef returns reference to the submitted message part this message was created from
+func (m *qMessage) GetRef() PartRef {
+	return PartRef{m.OriginalMessage.GetID(), m.Part}
+}
+
+// AddReferences adds references to the parts of other messages that are sent together with this one
+func (m *qMessage) AddReferences(r ...PartRef) {
+	m.references = append(m.references, r...)
+}
+
+// GetReferences returns copy of the references to all the parts that are sent with this message
+func (m *qMessage) GetReferences() []PartRef {
+	cr := make([]PartRef, len(m.references))
+	copy(cr, m.references)
+	return cr
+}
+
+// GetRequestIDs returns identifiers of the HTTP requests all the parts sent with this message were submitted with
+func (m *qMessage) GetRequestIDs() []string {
+	cr := make([]string, len(m.requestIDs))
+	copy(cr, m.requestIDs)
+	return cr
+}
+
+func (m *qMessage) addRequestIDs(ids ...string) {
+	for _, id := range ids {
+		if !m.hasRequestID(id) {
+			m.requestIDs = append(m.requestIDs, id)
+		}
+	}
+}
+
+func (m *qMessage) hasRequestID(id string) bool {
+	for _, i := range m.requestIDs {
+		if i == id {
+			return true
+		}
+	}
+
+	return false
+}
+
+// GetAttempts returns the amount of failed attempts to send the message
+func (m *qMessage) GetAttempts() int {
+	return m.attempts
+}
+
+// Retry registers failed attempt and postpones the next one till provided time
+func (m *qMessage) Retry(at time.Time) {
+	m.attempts++
+	m.retryAt = at
+}
+
+// ResetAttempts forgets about all the failed attempts so message could be sent right away
+func (m *qMessage) ResetAttempts() {
+	m.attempts = 0
+	m.retryAt = time.Time{}
+}
+
+// IsDue checks if it's time to send the message
+func (m *qMessage) IsDue(now time.Time) bool {
+	return !now.Before(m.retryAt)
+}
+
+// GetPriority returns the priority class of the message
+func (m *qMessage) GetPriority() models.Priority {
+	return m.priority
+}
+
+// Enqueue marks the time the message entered the queue. Time is kept if the message is already marked
+func (m *qMessage) Enqueue(at time.Time) {
+	if m.queuedAt.IsZero() {
+		m.queuedAt = at
+	}
+}
+
+// GetQueuedAt returns the time the message entered the queue
+func (m *qMessage) GetQueuedAt() time.Time {
+	return m.queuedAt
+}
+
+// GetRetryAt returns the time of the next attempt to send the message
+func (m *qMessage) GetRetryAt() time.Time {
+	return m.retryAt
+}
+
 // ByRecipientsAmount is type for sorting the collection of QueueMessage by recipients amount
 type ByRecipientsAmount []QueueMessage
 
@@ -8,6 +8,7 @@ import (
 	"utils"
 
 	"strconv"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 )
@@ -18,7 +19,7 @@ func TestInitQueueMessage(t *testing.T) {
 	rm := apiModels.InitMessage()
 	udh := "udh"
 
-	m := models.InitQueueMessage(body, utils.Datacoding(dc), rm, udh)
+	m := models.InitQueueMessage(body, utils.Datacoding(dc), rm, udh, 1)
 	reflected := reflect.ValueOf(m).Elem()
 
 	t.Run("new message keeps reference to api model", func(t *testing.T) {
@@ -36,6 +37,23 @@ func TestInitQueueMessage(t *testing.T) {
 	t.Run("new message keeps the same passed message body", func(t *testing.T) {
 		assert.Equal(t, body, reflected.FieldByName("Message").String())
 	})
+
+	t.Run("new message has all the recipients of the submitted message", func(t *testing.T) {
+		rm := apiModels.InitMessage()
+		reflect.ValueOf(rm).Elem().FieldByName("Recipient").SetInt(31)
+		reflect.ValueOf(rm).Elem().FieldByName("Recipients").Set(reflect.ValueOf([]int64{32, 33}))
+
+		m := models.InitQueueMessage(body, utils.Datacoding(dc), rm, udh, 1)
+		assert.Equal(t, []string{"31", "32", "33"}, m.GetRecipients())
+	})
+
+	t.Run("new message keeps the same passed part index", func(t *testing.T) {
+		assert.Equal(t, int64(1), reflected.FieldByName("Part").Int())
+	})
+
+	t.Run("new message references its own part", func(t *testing.T) {
+		assert.Equal(t, []models.PartRef{{MessageID: rm.GetID(), Part: 1}}, m.GetReferences())
+	})
 }
 
 func TestByRecipientsAmount_Len(t *testing.T) {
@@ -44,8 +62,8 @@ func TestByRecipientsAmount_Len(t *testing.T) {
 	rm := apiModels.InitMessage()
 	udh := "udh"
 
-	m1 := models.InitQueueMessage(body, utils.Datacoding(dc), rm, udh)
-	m2 := models.InitQueueMessage(body, utils.Datacoding(dc), rm, udh)
+	m1 := models.InitQueueMessage(body, utils.Datacoding(dc), rm, udh, 1)
+	m2 := models.InitQueueMessage(body, utils.Datacoding(dc), rm, udh, 1)
 
 	c := models.ByRecipientsAmount{m1}
 	assert.Equal(t, 1, c.Len())
@@ -59,8 +77,8 @@ func TestByRecipientsAmount_Less(t *testing.T) {
 	rm := apiModels.InitMessage()
 	udh := "udh"
 
-	m1 := models.InitQueueMessage(body, utils.Datacoding(dc), rm, udh)
-	m2 := models.InitQueueMessage(body, utils.Datacoding(dc), rm, udh)
+	m1 := models.InitQueueMessage(body, utils.Datacoding(dc), rm, udh, 1)
+	m2 := models.InitQueueMessage(body, utils.Datacoding(dc), rm, udh, 1)
 
 	m1.AddRecipient(0)
 
@@ -87,8 +105,8 @@ func TestByRecipientsAmount_Swap(t *testing.T) {
 	rm := apiModels.InitMessage()
 	udh := "udh"
 
-	m1 := models.InitQueueMessage(body, utils.Datacoding(dc), rm, udh)
-	m2 := models.InitQueueMessage(body, utils.Datacoding(dc), rm, udh)
+	m1 := models.InitQueueMessage(body, utils.Datacoding(dc), rm, udh, 1)
+	m2 := models.InitQueueMessage(body, utils.Datacoding(dc), rm, udh, 1)
 
 	t.Run("swaps elements in collection", func(t *testing.T) {
 		c := models.ByRecipientsAmount{m1, m2}
@@ -105,7 +123,7 @@ func TestQMessage_AddRecipient(t *testing.T) {
 	rm := apiModels.InitMessage()
 	udh := "udh"
 
-	m := models.InitQueueMessage(body, utils.Datacoding(dc), rm, udh)
+	m := models.InitQueueMessage(body, utils.Datacoding(dc), rm, udh, 1)
 
 	t.Run("adds recipient to the message", func(t *testing.T) {
 		assert.Equal(t, m.GetRecipientsAmount(), int64(0))
@@ -118,6 +136,15 @@ func TestQMessage_AddRecipient(t *testing.T) {
 		m.AddRecipient(0)
 		assert.Equal(t, int64(1), m.GetRecipientsAmount())
 	})
+
+	t.Run("doesn't add any of the added recipients twice", func(t *testing.T) {
+		m.AddRecipient(1)
+		m.AddRecipient(2)
+
+		assert.Error(t, m.AddRecipient(0))
+		assert.Error(t, m.AddRecipient(1))
+		assert.Equal(t, int64(3), m.GetRecipientsAmount())
+	})
 }
 
 func TestQMessage_GetDataCoding(t *testing.T) {
@@ -126,7 +153,7 @@ func TestQMessage_GetDataCoding(t *testing.T) {
 	rm := apiModels.InitMessage()
 	udh := "udh"
 
-	m := models.InitQueueMessage(body, utils.Datacoding(dc), rm, udh)
+	m := models.InitQueueMessage(body, utils.Datacoding(dc), rm, udh, 1)
 
 	t.Run("returns provided datacoding", func(t *testing.T) {
 		assert.Equal(t, utils.Datacoding(dc), m.GetDataCoding())
@@ -139,7 +166,7 @@ func TestQMessage_GetMessage(t *testing.T) {
 	rm := apiModels.InitMessage()
 	udh := "udh"
 
-	m := models.InitQueueMessage(body, utils.Datacoding(dc), rm, udh)
+	m := models.InitQueueMessage(body, utils.Datacoding(dc), rm, udh, 1)
 
 	t.Run("returns provided message", func(t *testing.T) {
 		assert.Equal(t, body, m.GetMessage())
@@ -152,7 +179,7 @@ func TestQMessage_GetOriginalRecipient(t *testing.T) {
 	rm := apiModels.InitMessage()
 	udh := "udh"
 
-	m := models.InitQueueMessage(body, utils.Datacoding(dc), rm, udh)
+	m := models.InitQueueMessage(body, utils.Datacoding(dc), rm, udh, 1)
 
 	t.Run("returns originally provided recipient", func(t *testing.T) {
 		originalRecipient := int64(123123123)
@@ -168,7 +195,7 @@ func TestQMessage_GetOriginator(t *testing.T) {
 	rm := apiModels.InitMessage()
 	udh := "udh"
 
-	m := models.InitQueueMessage(body, utils.Datacoding(dc), rm, udh)
+	m := models.InitQueueMessage(body, utils.Datacoding(dc), rm, udh, 1)
 
 	t.Run("returns originally provided recipient", func(t *testing.T) {
 		originator := "originator"
@@ -178,13 +205,24 @@ func TestQMessage_GetOriginator(t *testing.T) {
 	})
 }
 
+func TestQMessage_GetScheduledAt(t *testing.T) {
+	rm := apiModels.InitMessage()
+	m := models.InitQueueMessage("body", utils.Plain, rm, "udh", 1)
+
+	t.Run("returns originally provided scheduled time", func(t *testing.T) {
+		at := time.Date(2017, 1, 1, 10, 0, 0, 0, time.UTC)
+		reflect.ValueOf(rm).Elem().FieldByName("ScheduledAt").Set(reflect.ValueOf(&at))
+		assert.Equal(t, at, m.GetScheduledAt())
+	})
+}
+
 func TestQMessage_GetRecipients(t *testing.T) {
 	body := "body"
 	dc := "plain"
 	rm := apiModels.InitMessage()
 	udh := "udh"
 
-	m := models.InitQueueMessage(body, utils.Datacoding(dc), rm, udh)
+	m := models.InitQueueMessage(body, utils.Datacoding(dc), rm, udh, 1)
 
 	t.Run("returns provided recipients", func(t *testing.T) {
 		original := []int64{31, 32, 33, 34}
@@ -205,7 +243,7 @@ func TestQMessage_GetRecipientsAmount(t *testing.T) {
 	rm := apiModels.InitMessage()
 	udh := "udh"
 
-	m := models.InitQueueMessage(body, utils.Datacoding(dc), rm, udh)
+	m := models.InitQueueMessage(body, utils.Datacoding(dc), rm, udh, 1)
 
 	t.Run("returns provided recipients", func(t *testing.T) {
 		original := []int64{31, 32, 33, 34}
@@ -224,9 +262,248 @@ func TestQMessage_GetUDH(t *testing.T) {
 	rm := apiModels.InitMessage()
 	udh := "udh"
 
-	m := models.InitQueueMessage(body, utils.Datacoding(dc), rm, udh)
+	m := models.InitQueueMessage(body, utils.Datacoding(dc), rm, udh, 1)
 
 	t.Run("returns originally provided udh", func(t *testing.T) {
 		assert.Equal(t, udh, m.GetUDH())
 	})
 }
+
+func TestQMessage_GetPart(t *testing.T) {
+	m := models.InitQueueMessage("body", utils.Plain, apiModels.InitMessage(), "udh", 3)
+
+	t.Run("returns provided part index", func(t *testing.T) {
+		assert.Equal(t, 3, m.GetPart())
+	})
+}
+
+func TestQMessage_AddReferences(t *testing.T) {
+	rm := apiModels.InitMessage()
+	rm.SetID("id1")
+
+	m := models.InitQueueMessage("body", utils.Plain, rm, "udh", 2)
+
+	t.Run("adds references to the other messages parts", func(t *testing.T) {
+		m.AddReferences(models.PartRef{MessageID: "id2", Part: 2}, models.PartRef{MessageID: "id3", Part: 2})
+
+		expected := []models.PartRef{
+			{MessageID: "id1", Part: 2},
+			{MessageID: "id2", Part: 2},
+			{MessageID: "id3", Part: 2},
+		}
+
+		assert.Equal(t, expected, m.GetReferences())
+	})
+}
+
+func TestQMessage_Merge(t *testing.T) {
+	initMessage := func(id string, recipients ...int64) models.QueueMessage {
+		rm := apiModels.InitMessage()
+		rm.SetID(id)
+		reflect.ValueOf(rm).Elem().FieldByName("Recipients").Set(reflect.ValueOf(recipients))
+
+		return models.InitQueueMessage("body", utils.Plain, rm, "udh", 1)
+	}
+
+	t.Run("adds all the recipients of identical message", func(t *testing.T) {
+		m1 := initMessage("id1", 1, 2)
+		m2 := initMessage("id2", 3)
+
+		assert.Nil(t, m1.Merge(m2))
+		assert.Equal(t, []string{"1", "2", "3"}, m1.GetRecipients())
+		assert.Equal(t, []models.PartRef{{MessageID: "id1", Part: 1}, {MessageID: "id2", Part: 1}}, m1.GetReferences())
+	})
+
+	t.Run("returns identical message with already added recipients", func(t *testing.T) {
+		m1 := initMessage("id1", 1, 2)
+		m2 := initMessage("id2", 2, 3)
+
+		rest := m1.Merge(m2)
+
+		assert.Equal(t, []string{"1", "2", "3"}, m1.GetRecipients())
+		assert.Equal(t, []string{"2"}, rest.GetRecipients())
+		assert.Equal(t, []string{"2", "3"}, m2.GetRecipients())
+	})
+
+	t.Run("returns the same message if nothing was merged", func(t *testing.T) {
+		m1 := initMessage("id1", 1, 2)
+		m2 := initMessage("id2", 2, 1)
+
+		assert.Exactly(t, m2, m1.Merge(m2))
+		assert.Equal(t, []models.PartRef{{MessageID: "id1", Part: 1}}, m1.GetReferences())
+	})
+
+	t.Run("keeps request identifiers of all the merged messages", func(t *testing.T) {
+		rm1 := apiModels.InitMessage()
+		rm1.SetID("id1")
+		rm1.SetRequestID("rid1")
+		reflect.ValueOf(rm1).Elem().FieldByName("Recipient").SetInt(1)
+
+		rm2 := apiModels.InitMessage()
+		rm2.SetID("id2")
+		rm2.SetRequestID("rid2")
+		reflect.ValueOf(rm2).Elem().FieldByName("Recipient").SetInt(2)
+
+		m1 := models.InitQueueMessage("body", utils.Plain, rm1, "udh", 1)
+		m1.Merge(models.InitQueueMessage("body", utils.Plain, rm2, "udh", 1))
+
+		assert.Equal(t, []string{"rid1", "rid2"}, m1.GetRequestIDs())
+	})
+
+	t.Run("keeps the highest priority and the earliest queued time", func(t *testing.T) {
+		now := time.Now()
+		m1 := initMessage("id1", 1)
+		m1.Enqueue(now)
+		rm2 := apiModels.InitMessage()
+		reflect.ValueOf(rm2).Elem().FieldByName("Recipient").SetInt(2)
+		reflect.ValueOf(rm2).Elem().FieldByName("Priority").SetString("otp")
+		m2 := models.InitQueueMessage("body", utils.Plain, rm2, "udh", 1)
+		m2.Enqueue(now.Add(-time.Minute))
+
+		assert.Equal(t, apiModels.PriorityTransactional, m1.GetPriority())
+
+		m1.Merge(m2)
+
+		assert.Equal(t, apiModels.PriorityOTP, m1.GetPriority())
+		assert.Equal(t, now.Add(-time.Minute), m1.GetQueuedAt())
+	})
+}
+
+func TestQMessage_WithDeliveries(t *testing.T) {
+	rm := apiModels.InitMessage()
+	reflect.ValueOf(rm).Elem().FieldByName("Recipient").SetInt(1)
+
+	m := models.InitQueueMessage("body", utils.Plain, rm, "udh", 1)
+
+	t.Run("returns copy of the message with provided recipients", func(t *testing.T) {
+		ref := models.PartRef{MessageID: "id", Part: 1}
+		c := m.WithDeliveries([]models.Delivery{{Recipient: "2", Ref: ref}, {Recipient: "3", Ref: ref}})
+
+		assert.Equal(t, []string{"2", "3"}, c.GetRecipients())
+		assert.Equal(t, m.GetMessage(), c.GetMessage())
+		assert.Equal(t, m.GetUDH(), c.GetUDH())
+		assert.Equal(t, m.GetReferences(), c.GetReferences())
+		assert.Equal(t, []string{"1"}, m.GetRecipients())
+	})
+}
+
+func TestQMessage_GetDeliveries(t *testing.T) {
+	rm1 := apiModels.InitMessage()
+	rm1.SetID("id1")
+	reflect.ValueOf(rm1).Elem().FieldByName("Recipient").SetInt(1)
+
+	rm2 := apiModels.InitMessage()
+	rm2.SetID("id2")
+	reflect.ValueOf(rm2).Elem().FieldByName("Recipient").SetInt(2)
+
+	m1 := models.InitQueueMessage("body", utils.Plain, rm1, "udh", 2)
+	m2 := models.InitQueueMessage("body", utils.Plain, rm2, "udh", 2)
+
+	t.Run("merged recipients keep the reference to their own message part", func(t *testing.T) {
+		m1.Merge(m2)
+
+		expected := []models.Delivery{
+			{Recipient: "1", Ref: models.PartRef{MessageID: "id1", Part: 2}},
+			{Recipient: "2", Ref: models.PartRef{MessageID: "id2", Part: 2}},
+		}
+
+		assert.Equal(t, expected, m1.GetDeliveries())
+	})
+}
+
+func TestQMessage_GetRef(t *testing.T) {
+	rm := apiModels.InitMessage()
+	rm.SetID("id")
+
+	m := models.InitQueueMessage("body", utils.Plain, rm, "udh", 2)
+
+	t.Run("returns reference to the message part it was created from", func(t *testing.T) {
+		assert.Equal(t, models.PartRef{MessageID: "id", Part: 2}, m.GetRef())
+	})
+}
+
+func TestUnmarshalQueueMessage(t *testing.T) {
+	rm := apiModels.InitMessage()
+	rm.SetID("id")
+	reflect.ValueOf(rm).Elem().FieldByName("Recipients").Set(reflect.ValueOf([]int64{31, 32}))
+	reflect.ValueOf(rm).Elem().FieldByName("Originator").SetString("originator")
+	reflect.ValueOf(rm).Elem().FieldByName("Body").SetString("body")
+	rm.SetRequestID("rid")
+	reflect.ValueOf(rm).Elem().FieldByName("Priority").SetString("bulk")
+
+	m := models.InitQueueMessage("626f6479", utils.Unicode, rm, "050003010201", 1)
+	m.Enqueue(time.Date(2017, 11, 5, 10, 0, 0, 0, time.UTC))
+
+	t.Run("restores marshaled message", func(t *testing.T) {
+		b, err := m.MarshalJSON()
+		assert.Nil(t, err)
+
+		restored, err := models.UnmarshalQueueMessage(b)
+		assert.Nil(t, err)
+
+		assert.Equal(t, m.GetMessage(), restored.GetMessage())
+		assert.Equal(t, m.GetDataCoding(), restored.GetDataCoding())
+		assert.Equal(t, m.GetUDH(), restored.GetUDH())
+		assert.Equal(t, m.GetOriginator(), restored.GetOriginator())
+		assert.Equal(t, m.GetDeliveries(), restored.GetDeliveries())
+		assert.Equal(t, m.GetReferences(), restored.GetReferences())
+		assert.Equal(t, m.GetRef(), restored.GetRef())
+		assert.Equal(t, []string{"rid"}, restored.GetRequestIDs())
+		assert.Equal(t, apiModels.PriorityBulk, restored.GetPriority())
+		assert.True(t, m.GetQueuedAt().Equal(restored.GetQueuedAt()))
+	})
+
+	t.Run("restores the priority of the submitted message if it wasn't persisted", func(t *testing.T) {
+		restored, err := models.UnmarshalQueueMessage([]byte(`{"original": {"priority": "otp"}}`))
+		assert.Nil(t, err)
+
+		assert.Equal(t, apiModels.PriorityOTP, restored.GetPriority())
+	})
+
+	t.Run("returns error for malformed message", func(t *testing.T) {
+		_, err := models.UnmarshalQueueMessage([]byte("{"))
+		assert.NotNil(t, err)
+	})
+}
+
+func TestQMessage_Enqueue(t *testing.T) {
+	m := models.InitQueueMessage("body", utils.Plain, apiModels.InitMessage(), "udh", 1)
+	now := time.Now()
+
+	t.Run("new message is not queued yet", func(t *testing.T) {
+		assert.True(t, m.GetQueuedAt().IsZero())
+	})
+
+	t.Run("first time is kept", func(t *testing.T) {
+		m.Enqueue(now)
+		m.Enqueue(now.Add(time.Minute))
+
+		assert.Equal(t, now, m.GetQueuedAt())
+	})
+}
+
+func TestQMessage_Retry(t *testing.T) {
+	m := models.InitQueueMessage("body", utils.Plain, apiModels.InitMessage(), "udh", 1)
+	now := time.Now()
+
+	t.Run("new message is due right away", func(t *testing.T) {
+		assert.Equal(t, 0, m.GetAttempts())
+		assert.True(t, m.IsDue(now))
+	})
+
+	t.Run("retried message is postponed", func(t *testing.T) {
+		m.Retry(now.Add(time.Minute))
+
+		assert.Equal(t, 1, m.GetAttempts())
+		assert.False(t, m.IsDue(now))
+		assert.True(t, m.IsDue(now.Add(time.Minute)))
+		assert.Equal(t, now.Add(time.Minute), m.GetRetryAt())
+	})
+
+	t.Run("reset message is due right away", func(t *testing.T) {
+		m.ResetAttempts()
+
+		assert.Equal(t, 0, m.GetAttempts())
+		assert.True(t, m.IsDue(now))
+	})
+}
@@ -0,0 +1,189 @@
+package models
+
+import "time"
+
+// State is a semantic type for the lifecycle state of the message part
+type State string
+
+const (
+	// Accepted means message passed validation but is not split and queued yet
+	Accepted State = "accepted"
+
+	// Queued means message part is waiting in the queue to be sent
+	Queued State = "queued"
+
+	// Sent means message part was submitted to MessageBird
+	Sent State = "sent"
+
+	// Scheduled means message part was submitted to MessageBird to be delivered at the scheduled time
+	Scheduled State = "scheduled"
+
+	// Failed means message part won't be sent anymore
+	Failed State = "failed"
+
+	// Retrying means MessageBird returned an error and message part is sent back to the queue
+	Retrying State = "retrying"
+)
+
+// IsFinal checks if the message part in this state won't be sent anymore
+func (s State) IsFinal() bool {
+	return s == Sent || s == Scheduled || s == Failed
+}
+
+// PartRef points to the exact part of the submitted message
+type PartRef struct {
+	MessageID string `json:"message_id"`
+	Part      int    `json:"part"`
+}
+
+// DeliveryReport is the delivery status of the message part for one recipient reported by MessageBird
+type DeliveryReport struct {
+	MessageBirdID  string `json:"messagebird_id"`
+	Recipient      string `json:"recipient"`
+	Status         string `json:"status"`
+	StatusDatetime string `json:"status_datetime"`
+}
+
+// PartStatus is a representation of the message part state
+type PartStatus struct {
+	Part           int               `json:"part"`
+	State          State             `json:"state"`
+	MessageBirdIDs []string          `json:"messagebird_ids"`
+	Reports        []*DeliveryReport `json:"delivery_reports"`
+	recipients     map[string]State  // recipients of the part could be sent within the different MessageBird calls
+}
+
+// InitPartStatus is a PartStatus factory method
+func InitPartStatus(part int, s State) *PartStatus {
+	return &PartStatus{part, s, []string{}, []*DeliveryReport{}, nil}
+}
+
+// SetState changes the state of the provided recipients of the part. Part is sent only when it's sent to all its
+// recipients and it fails only when none of them is pending anymore. Part without known recipients takes the state
+func (p *PartStatus) SetState(recipients []string, s State) {
+	if len(recipients) == 0 && len(p.recipients) == 0 {
+		p.State = s
+		return
+	}
+
+	if p.recipients == nil {
+		p.recipients = map[string]State{}
+	}
+
+	states := map[State]bool{}
+
+	for _, r := range recipients {
+		p.recipients[r] = s
+	}
+
+	for _, rs := range p.recipients {
+		states[rs] = true
+	}
+
+	switch {
+	case states[Retrying]:
+		p.State = Retrying
+	case states[Queued]:
+		p.State = Queued
+	case states[Failed]:
+		p.State = Failed
+	case states[Scheduled]:
+		p.State = Scheduled
+	default:
+		p.State = Sent
+	}
+}
+
+// AddReport keeps the latest delivery report for every recipient. Reports could come in any order,
+// so the report that is older than already received one is ignored
+func (p *PartStatus) AddReport(r *DeliveryReport) {
+	for i, e := range p.Reports {
+		if e.MessageBirdID != r.MessageBirdID || e.Recipient != r.Recipient {
+			continue
+		}
+
+		if isBefore(r.StatusDatetime, e.StatusDatetime) {
+			return
+		}
+
+		p.Reports[i] = r
+		return
+	}
+
+	p.Reports = append(p.Reports, r)
+}
+
+// isBefore compares RFC3339 times. Not parsable times are not considered to be before any other time
+func isBefore(a string, b string) bool {
+	ta, errA := time.Parse(time.RFC3339, a)
+	tb, errB := time.Parse(time.RFC3339, b)
+
+	if errA != nil || errB != nil {
+		return false
+	}
+
+	return ta.Before(tb)
+}
+
+// MessageStatus is a representation of the submitted message state and all its parts
+type MessageStatus struct {
+	ID    string        `json:"id"`
+	State State         `json:"state"`
+	Parts []*PartStatus `json:"parts"`
+	// Client is the name of the API client that submitted the message. It's never rendered
+	Client string `json:"-"`
+}
+
+// InitMessageStatus is a MessageStatus factory method
+func InitMessageStatus(id string, client string) *MessageStatus {
+	return &MessageStatus{id, Accepted, []*PartStatus{}, client}
+}
+
+// Copy returns deep copy of the status so it could be safely rendered outside
+func (s *MessageStatus) Copy() *MessageStatus {
+	c := &MessageStatus{s.ID, s.State, make([]*PartStatus, len(s.Parts)), s.Client}
+
+	for i, p := range s.Parts {
+		ids := make([]string, len(p.MessageBirdIDs))
+		copy(ids, p.MessageBirdIDs)
+
+		rs := make([]*DeliveryReport, len(p.Reports))
+
+		for j, r := range p.Reports {
+			cr := *r
+			rs[j] = &cr
+		}
+
+		c.Parts[i] = &PartStatus{p.Part, p.State, ids, rs, nil}
+	}
+
+	return c
+}
+
+// Refresh recalculates overall message state based on the states of its parts.
+// The least advanced part defines the state, while failed part fails the whole message
+func (s *MessageStatus) Refresh() {
+	if len(s.Parts) == 0 {
+		s.State = Accepted
+		return
+	}
+
+	states := map[State]bool{}
+
+	for _, p := range s.Parts {
+		states[p.State] = true
+	}
+
+	switch {
+	case states[Failed]:
+		s.State = Failed
+	case states[Retrying]:
+		s.State = Retrying
+	case states[Queued]:
+		s.State = Queued
+	case states[Scheduled]:
+		s.State = Scheduled
+	default:
+		s.State = Sent
+	}
+}
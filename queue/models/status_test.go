@@ -0,0 +1,94 @@
+package models_test
+
+import (
+	"queue/models"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestInitMessageStatus(t *testing.T) {
+	t.Run("new status is accepted and has no parts", func(t *testing.T) {
+		s := models.InitMessageStatus("id", "")
+
+		assert.Equal(t, "id", s.ID)
+		assert.Equal(t, models.Accepted, s.State)
+		assert.Empty(t, s.Parts)
+	})
+}
+
+func TestMessageStatus_Copy(t *testing.T) {
+	t.Run("changes of the copy don't affect original status", func(t *testing.T) {
+		s := models.InitMessageStatus("id", "")
+		s.Parts = append(s.Parts, &models.PartStatus{
+			Part:           1,
+			State:          models.Sent,
+			MessageBirdIDs: []string{"mb"},
+			Reports:        []*models.DeliveryReport{{MessageBirdID: "mb", Recipient: "123", Status: "sent"}},
+		})
+
+		c := s.Copy()
+		c.Parts[0].State = models.Failed
+		c.Parts[0].MessageBirdIDs[0] = "changed"
+		c.Parts[0].Reports[0].Status = "changed"
+
+		assert.Equal(t, models.Sent, s.Parts[0].State)
+		assert.Equal(t, []string{"mb"}, s.Parts[0].MessageBirdIDs)
+		assert.Equal(t, "sent", s.Parts[0].Reports[0].Status)
+	})
+}
+
+func TestPartStatus_AddReport(t *testing.T) {
+	p := models.InitPartStatus(1, models.Sent)
+
+	sent := &models.DeliveryReport{MessageBirdID: "mb", Recipient: "123", Status: "sent", StatusDatetime: "2017-01-01T10:00:00+00:00"}
+	delivered := &models.DeliveryReport{MessageBirdID: "mb", Recipient: "123", Status: "delivered", StatusDatetime: "2017-01-01T10:00:05+00:00"}
+	other := &models.DeliveryReport{MessageBirdID: "mb", Recipient: "321", Status: "sent", StatusDatetime: "2017-01-01T10:00:00+00:00"}
+
+	t.Run("keeps report for every recipient", func(t *testing.T) {
+		p.AddReport(sent)
+		p.AddReport(other)
+
+		assert.Equal(t, []*models.DeliveryReport{sent, other}, p.Reports)
+	})
+
+	t.Run("newer report replaces the previous one", func(t *testing.T) {
+		p.AddReport(delivered)
+
+		assert.Equal(t, []*models.DeliveryReport{delivered, other}, p.Reports)
+	})
+
+	t.Run("older report is ignored", func(t *testing.T) {
+		p.AddReport(sent)
+
+		assert.Equal(t, []*models.DeliveryReport{delivered, other}, p.Reports)
+	})
+}
+
+func TestMessageStatus_Refresh(t *testing.T) {
+	cases := []struct {
+		name     string
+		parts    []models.State
+		expected models.State
+	}{
+		{"accepted if no parts yet", []models.State{}, models.Accepted},
+		{"sent if all parts sent", []models.State{models.Sent, models.Sent}, models.Sent},
+		{"scheduled if some parts are scheduled", []models.State{models.Sent, models.Scheduled}, models.Scheduled},
+		{"queued if some parts are queued", []models.State{models.Sent, models.Queued}, models.Queued},
+		{"retrying if some parts are retrying", []models.State{models.Queued, models.Retrying}, models.Retrying},
+		{"failed if any part failed", []models.State{models.Retrying, models.Failed, models.Sent}, models.Failed},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			s := models.InitMessageStatus("id", "")
+
+			for i, st := range c.parts {
+				s.Parts = append(s.Parts, &models.PartStatus{Part: i + 1, State: st})
+			}
+
+			s.Refresh()
+			assert.Equal(t, c.expected, s.State)
+		})
+	}
+}
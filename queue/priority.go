@@ -0,0 +1,74 @@
+package queue
+
+import (
+	qModels "queue/models"
+	"sort"
+	"time"
+)
+
+// PriorityPolicy decides the order the due messages are sent in
+type PriorityPolicy interface {
+	Order(ms []qModels.QueueMessage, now time.Time)
+}
+
+type priorityPolicy struct {
+	Aging time.Duration
+}
+
+// InitPriorityPolicy is PriorityPolicy factory method. Messages of the higher priority class are sent first. Waiting
+// message is raised by one class every aging period, so bulk messages are never starved (no aging if it's zero)
+func InitPriorityPolicy(aging time.Duration) PriorityPolicy {
+	return &priorityPolicy{aging}
+}
+
+// Order sorts the messages by their rank at the provided time. Messages of the same rank are sent by the biggest
+// amount of recipients and then by the time they entered the queue
+func (p *priorityPolicy) Order(ms []qModels.QueueMessage, now time.Time) {
+	ranks := make([]int, len(ms))
+
+	for i, m := range ms {
+		ranks[i] = p.rank(m, now)
+	}
+
+	sort.Stable(&rankedMessages{ms, ranks})
+}
+
+// rank is the order of the message priority class raised by the amount of aging periods it waits in the queue
+func (p *priorityPolicy) rank(m qModels.QueueMessage, now time.Time) int {
+	r := m.GetPriority().Rank()
+
+	if p.Aging > 0 && !m.GetQueuedAt().IsZero() && now.After(m.GetQueuedAt()) {
+		r += int(now.Sub(m.GetQueuedAt()) / p.Aging)
+	}
+
+	return r
+}
+
+// rankedMessages sorts the messages together with their ranks
+type rankedMessages struct {
+	Messages []qModels.QueueMessage
+	Ranks    []int
+}
+
+func (a *rankedMessages) Len() int {
+	return len(a.Messages)
+}
+
+func (a *rankedMessages) Swap(i, j int) {
+	a.Messages[i], a.Messages[j] = a.Messages[j], a.Messages[i]
+	a.Ranks[i], a.Ranks[j] = a.Ranks[j], a.Ranks[i]
+}
+
+func (a *rankedMessages) Less(i, j int) bool {
+	if a.Ranks[i] != a.Ranks[j] {
+		return a.Ranks[i] > a.Ranks[j]
+	}
+
+	mi, mj := a.Messages[i], a.Messages[j]
+
+	if mi.GetRecipientsAmount() != mj.GetRecipientsAmount() {
+		return mi.GetRecipientsAmount() > mj.GetRecipientsAmount()
+	}
+
+	return mi.GetQueuedAt().Before(mj.GetQueuedAt())
+}
@@ -0,0 +1,88 @@
+package queue_test
+
+import (
+	apiModels "api/models"
+	"queue"
+	"queue/models"
+	"reflect"
+	"testing"
+	"time"
+	"utils"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPriorityPolicy_Order(t *testing.T) {
+	now := time.Date(2017, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	initMessage := func(body string, p apiModels.Priority, recipients []int64, queuedAt time.Time) models.QueueMessage {
+		rm := apiModels.InitMessage()
+		reflect.ValueOf(rm).Elem().FieldByName("Priority").SetString(string(p))
+		reflect.ValueOf(rm).Elem().FieldByName("Recipients").Set(reflect.ValueOf(recipients))
+
+		m := models.InitQueueMessage(body, utils.Plain, rm, "", 1)
+		m.Enqueue(queuedAt)
+
+		return m
+	}
+
+	bodies := func(ms []models.QueueMessage) []string {
+		var result []string
+
+		for _, m := range ms {
+			result = append(result, m.GetMessage())
+		}
+
+		return result
+	}
+
+	t.Run("higher priority is sent first regardless of the amount of recipients", func(t *testing.T) {
+		ms := []models.QueueMessage{
+			initMessage("bulk", apiModels.PriorityBulk, []int64{1, 2, 3}, now),
+			initMessage("transactional", apiModels.PriorityTransactional, []int64{1, 2}, now),
+			initMessage("otp", apiModels.PriorityOTP, []int64{1}, now),
+		}
+
+		queue.InitPriorityPolicy(time.Minute).Order(ms, now)
+
+		assert.Equal(t, []string{"otp", "transactional", "bulk"}, bodies(ms))
+	})
+
+	t.Run("same priority is sent by the amount of recipients and then by the queued time", func(t *testing.T) {
+		ms := []models.QueueMessage{
+			initMessage("late", apiModels.PriorityBulk, []int64{1}, now),
+			initMessage("early", apiModels.PriorityBulk, []int64{1}, now.Add(-time.Second)),
+			initMessage("many", apiModels.PriorityBulk, []int64{1, 2}, now),
+		}
+
+		queue.InitPriorityPolicy(time.Minute).Order(ms, now)
+
+		assert.Equal(t, []string{"many", "early", "late"}, bodies(ms))
+	})
+
+	t.Run("waiting message is raised by one class every aging period", func(t *testing.T) {
+		bulk := initMessage("bulk", apiModels.PriorityBulk, []int64{1}, now.Add(-2*time.Minute))
+		transactional := initMessage("transactional", apiModels.PriorityTransactional, []int64{1}, now.Add(-time.Minute))
+
+		ms := []models.QueueMessage{initMessage("otp", apiModels.PriorityOTP, []int64{1}, now), transactional, bulk}
+		queue.InitPriorityPolicy(time.Minute).Order(ms, now)
+
+		assert.Equal(t, []string{"bulk", "transactional", "otp"}, bodies(ms))
+
+		ms = []models.QueueMessage{initMessage("otp", apiModels.PriorityOTP, []int64{1}, now), transactional, bulk}
+		queue.InitPriorityPolicy(time.Minute).Order(ms, now.Add(-61*time.Second))
+
+		assert.Equal(t, []string{"otp", "transactional", "bulk"}, bodies(ms))
+	})
+
+	t.Run("no aging if it's zero", func(t *testing.T) {
+		ms := []models.QueueMessage{
+			initMessage("bulk", apiModels.PriorityBulk, []int64{1}, now.Add(-time.Hour)),
+			initMessage("otp", apiModels.PriorityOTP, []int64{1}, now),
+		}
+
+		queue.InitPriorityPolicy(0).Order(ms, now)
+
+		assert.Equal(t, []string{"otp", "bulk"}, bodies(ms))
+	})
+}
@@ -0,0 +1,56 @@
+package queue
+
+import (
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// RetryPolicy decides if and when failed message should be sent again
+type RetryPolicy interface {
+	Backoff(attempt int) (time.Duration, bool)
+}
+
+type retryPolicy struct {
+	MaxAttempts int
+	BaseDelay   time.Duration
+	MaxDelay    time.Duration
+	Mutex       *sync.Mutex
+	Rand        *rand.Rand
+}
+
+// InitRetryPolicy is RetryPolicy factory method. Delay grows exponentially from base delay up to max delay
+func InitRetryPolicy(maxAttempts int, base time.Duration, max time.Duration) RetryPolicy {
+	return &retryPolicy{maxAttempts, base, max, &sync.Mutex{}, rand.New(rand.NewSource(time.Now().UnixNano()))} // #nosec
+}
+
+// Backoff returns the delay before the next attempt after provided amount of failed attempts.
+// Returns false if message is out of attempts
+func (p *retryPolicy) Backoff(attempt int) (time.Duration, bool) {
+	if attempt >= p.MaxAttempts {
+		return 0, false
+	}
+
+	d := p.BaseDelay
+
+	for i := 1; i < attempt && d < p.MaxDelay; i++ {
+		d *= 2
+	}
+
+	if d > p.MaxDelay {
+		d = p.MaxDelay
+	}
+
+	// equal jitter: keep half of the delay and randomise the other half, so failed messages won't retry all at once
+	half := int64(d / 2)
+
+	if half == 0 {
+		return d, true
+	}
+
+	p.Mutex.Lock()
+	j := p.Rand.Int63n(half + 1)
+	p.Mutex.Unlock()
+
+	return d - time.Duration(half-j), true
+}
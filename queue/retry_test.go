@@ -0,0 +1,40 @@
+package queue_test
+
+import (
+	"queue"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRetryPolicy_Backoff(t *testing.T) {
+	p := queue.InitRetryPolicy(5, time.Second, 3*time.Second)
+
+	t.Run("delay grows exponentially with jitter", func(t *testing.T) {
+		d, ok := p.Backoff(1)
+		assert.True(t, ok)
+		assert.True(t, d >= 500*time.Millisecond && d <= time.Second, d)
+
+		d, ok = p.Backoff(2)
+		assert.True(t, ok)
+		assert.True(t, d >= time.Second && d <= 2*time.Second, d)
+	})
+
+	t.Run("delay doesn't exceed max delay", func(t *testing.T) {
+		d, ok := p.Backoff(4)
+		assert.True(t, ok)
+		assert.True(t, d >= 1500*time.Millisecond && d <= 3*time.Second, d)
+	})
+
+	t.Run("no more attempts after max attempts", func(t *testing.T) {
+		_, ok := p.Backoff(5)
+		assert.False(t, ok)
+	})
+
+	t.Run("zero delay is not jittered", func(t *testing.T) {
+		d, ok := queue.InitRetryPolicy(5, 0, 0).Backoff(1)
+		assert.True(t, ok)
+		assert.Equal(t, time.Duration(0), d)
+	})
+}
@@ -0,0 +1,212 @@
+package queue
+
+import (
+	qModels "queue/models"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Storage keeps the pending messages parts so they could be replayed after the restart
+type Storage interface {
+	Save(m qModels.QueueMessage) error
+	Remove(m qModels.QueueMessage) error
+	Retry(m qModels.QueueMessage) error
+	Load() []qModels.QueueMessage
+}
+
+// storageEntry is a pending submitted message part with the sequence number of its submission
+type storageEntry struct {
+	Seq     uint64
+	Message qModels.QueueMessage
+}
+
+type memoryStorage struct {
+	Mutex   *sync.Mutex
+	Seq     uint64
+	Entries map[qModels.PartRef]*storageEntry
+}
+
+// InitMemoryStorage is in-memory Storage factory method. Messages are not kept after the restart
+func InitMemoryStorage() Storage {
+	return initMemoryStorage()
+}
+
+func initMemoryStorage() *memoryStorage {
+	return &memoryStorage{&sync.Mutex{}, 0, map[qModels.PartRef]*storageEntry{}}
+}
+
+// Save keeps the submitted message part until all its recipients would receive it
+func (s *memoryStorage) Save(m qModels.QueueMessage) error {
+	s.Mutex.Lock()
+	defer s.Mutex.Unlock()
+
+	s.save(m)
+
+	return nil
+}
+
+// Remove forgets about the recipients of the sent message
+func (s *memoryStorage) Remove(m qModels.QueueMessage) error {
+	s.Mutex.Lock()
+	defer s.Mutex.Unlock()
+
+	s.remove(m.GetDeliveries(), m.GetReferences())
+
+	return nil
+}
+
+// Retry keeps the failed attempts of the message, so the backoff is not reset by the restart
+func (s *memoryStorage) Retry(m qModels.QueueMessage) error {
+	s.Mutex.Lock()
+	defer s.Mutex.Unlock()
+
+	s.retry(messageRefs(m), m.GetAttempts(), m.GetRetryAt())
+
+	return nil
+}
+
+// Load returns all the pending messages parts in order of their submission
+func (s *memoryStorage) Load() []qModels.QueueMessage {
+	s.Mutex.Lock()
+	defer s.Mutex.Unlock()
+
+	return s.entries()
+}
+
+func (s *memoryStorage) entries() []qModels.QueueMessage {
+	es := make([]*storageEntry, 0, len(s.Entries))
+
+	for _, e := range s.Entries {
+		es = append(es, e)
+	}
+
+	sort.Slice(es, func(i, j int) bool {
+		return es[i].Seq < es[j].Seq
+	})
+
+	result := make([]qModels.QueueMessage, len(es))
+
+	for i, e := range es {
+		result[i] = e.Message
+	}
+
+	return result
+}
+
+func (s *memoryStorage) save(m qModels.QueueMessage) {
+	groups := map[qModels.PartRef][]qModels.Delivery{}
+	refs := []qModels.PartRef{}
+
+	// message could contain deliveries of several parts (e.g. replayed merged message), so every part is kept separately
+	for _, d := range m.GetDeliveries() {
+		if _, ok := groups[d.Ref]; !ok {
+			refs = append(refs, d.Ref)
+		}
+
+		groups[d.Ref] = append(groups[d.Ref], d)
+	}
+
+	if len(refs) == 0 {
+		refs = append(refs, m.GetRef())
+	}
+
+	for _, ref := range refs {
+		// message in the queue is mutated while merging, so storage keeps its own copy
+		ds := groups[ref]
+
+		if e, ok := s.Entries[ref]; ok {
+			e.Message = e.Message.WithDeliveries(mergeDeliveries(e.Message.GetDeliveries(), ds)).WithRetry(m.GetAttempts(), m.GetRetryAt())
+			continue
+		}
+
+		s.Seq++
+		s.Entries[ref] = &storageEntry{s.Seq, m.WithDeliveries(ds)}
+	}
+}
+
+func (s *memoryStorage) remove(ds []qModels.Delivery, refs []qModels.PartRef) {
+	sent := map[qModels.PartRef]map[string]bool{}
+
+	for _, d := range ds {
+		if _, ok := sent[d.Ref]; !ok {
+			sent[d.Ref] = map[string]bool{}
+		}
+
+		sent[d.Ref][d.Recipient] = true
+	}
+
+	for ref, rs := range sent {
+		e, ok := s.Entries[ref]
+
+		if !ok {
+			continue
+		}
+
+		var rest []qModels.Delivery
+
+		for _, d := range e.Message.GetDeliveries() {
+			if !rs[d.Recipient] {
+				rest = append(rest, d)
+			}
+		}
+
+		e.Message = e.Message.WithDeliveries(rest)
+	}
+
+	for ref := range sent {
+		refs = append(refs, ref)
+	}
+
+	// message parts without recipients left are done
+	for _, ref := range refs {
+		if e, ok := s.Entries[ref]; ok && e.Message.GetRecipientsAmount() == 0 {
+			delete(s.Entries, ref)
+		}
+	}
+}
+
+func (s *memoryStorage) retry(refs []qModels.PartRef, attempts int, at time.Time) {
+	for _, ref := range refs {
+		if e, ok := s.Entries[ref]; ok {
+			e.Message = e.Message.WithRetry(attempts, at)
+		}
+	}
+}
+
+// messageRefs returns the references of all the submitted message parts the message delivers
+func messageRefs(m qModels.QueueMessage) []qModels.PartRef {
+	refs := m.GetReferences()
+	known := map[qModels.PartRef]bool{}
+
+	for _, ref := range refs {
+		known[ref] = true
+	}
+
+	for _, d := range m.GetDeliveries() {
+		if !known[d.Ref] {
+			refs = append(refs, d.Ref)
+			known[d.Ref] = true
+		}
+	}
+
+	return refs
+}
+
+// mergeDeliveries adds deliveries that are not in the list yet
+func mergeDeliveries(ds []qModels.Delivery, add []qModels.Delivery) []qModels.Delivery {
+	existing := map[qModels.Delivery]bool{}
+
+	for _, d := range ds {
+		existing[d] = true
+	}
+
+	for _, d := range add {
+		if !existing[d] {
+			ds = append(ds, d)
+			existing[d] = true
+		}
+	}
+
+	return ds
+}
@@ -0,0 +1,90 @@
+package queue_test
+
+import (
+	apiModels "api/models"
+	"queue"
+	"queue/models"
+	"reflect"
+	"testing"
+	"time"
+	"utils"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func initStoredMessage(id string, part int, recipients ...int64) models.QueueMessage {
+	rm := apiModels.InitMessage()
+	rm.SetID(id)
+	reflect.ValueOf(rm).Elem().FieldByName("Recipients").Set(reflect.ValueOf(recipients))
+	reflect.ValueOf(rm).Elem().FieldByName("Originator").SetString("originator")
+
+	return models.InitQueueMessage("body", utils.Plain, rm, "udh", part)
+}
+
+func testStorage(t *testing.T, s queue.Storage) {
+	t.Run("returns saved messages in order of submission", func(t *testing.T) {
+		m1 := initStoredMessage("id1", 1, 31)
+		m2 := initStoredMessage("id1", 2, 31)
+		m3 := initStoredMessage("id2", 1, 32)
+
+		assert.Nil(t, s.Save(m1))
+		assert.Nil(t, s.Save(m2))
+		assert.Nil(t, s.Save(m3))
+
+		l := s.Load()
+
+		assert.Len(t, l, 3)
+		assert.Equal(t, m1.GetRef(), l[0].GetRef())
+		assert.Equal(t, m2.GetRef(), l[1].GetRef())
+		assert.Equal(t, m3.GetRef(), l[2].GetRef())
+
+		assert.Nil(t, s.Remove(m1))
+		assert.Nil(t, s.Remove(m2))
+		assert.Nil(t, s.Remove(m3))
+		assert.Empty(t, s.Load())
+	})
+
+	t.Run("keeps recipients of the merged message that were not sent yet", func(t *testing.T) {
+		m1 := initStoredMessage("id1", 1, 31)
+		m2 := initStoredMessage("id2", 1, 31, 32)
+
+		assert.Nil(t, s.Save(m1))
+		assert.Nil(t, s.Save(m2))
+
+		// recipient 31 of the second message is sent separately
+		rest := m1.Merge(m2)
+		assert.Nil(t, s.Remove(m1))
+
+		l := s.Load()
+		assert.Len(t, l, 1)
+		assert.Equal(t, m2.GetRef(), l[0].GetRef())
+		assert.Equal(t, []string{"31"}, l[0].GetRecipients())
+
+		assert.Nil(t, s.Remove(rest))
+		assert.Empty(t, s.Load())
+	})
+
+	t.Run("keeps failed attempts of the pending messages", func(t *testing.T) {
+		m := initStoredMessage("id1", 1, 31)
+		at := time.Date(2017, 1, 1, 0, 0, 0, 0, time.UTC)
+
+		assert.Nil(t, s.Save(m))
+
+		m.Retry(at)
+		assert.Equal(t, 0, s.Load()[0].GetAttempts())
+		assert.Nil(t, s.Retry(m))
+
+		l := s.Load()
+		assert.Len(t, l, 1)
+		assert.Equal(t, 1, l[0].GetAttempts())
+		assert.Equal(t, at, l[0].GetRetryAt())
+		assert.Equal(t, []string{"31"}, l[0].GetRecipients())
+
+		assert.Nil(t, s.Remove(m))
+		assert.Empty(t, s.Load())
+	})
+}
+
+func TestMemoryStorage(t *testing.T) {
+	testStorage(t, queue.InitMemoryStorage())
+}
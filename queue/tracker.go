@@ -0,0 +1,263 @@
+package queue
+
+import (
+	qModels "queue/models"
+	"sync"
+	"time"
+	"utils"
+)
+
+// StatusTracker keeps the lifecycle states of the submitted messages and all their parts
+type StatusTracker interface {
+	Accept(id string, client string)
+	Track(id string, parts int)
+	SetState(ref qModels.PartRef, recipients []string, s qModels.State)
+	AddMessageBirdID(ref qModels.PartRef, mbID string, recipients []string)
+	Report(r *qModels.DeliveryReport) bool
+	Get(id string) (*qModels.MessageStatus, bool)
+}
+
+type tracker struct {
+	Mutex      *sync.Mutex
+	Clock      utils.Clock
+	TTL        time.Duration
+	Statuses   map[string]*qModels.MessageStatus
+	Recipients map[string]map[string]qModels.PartRef // MessageBird id -> recipient -> part the recipient belongs to
+	FinishedAt map[string]time.Time                  // message id -> time the message reached the final state
+	Finished   []finishedStatus                      // messages in order they reached the final state
+}
+
+// finishedStatus is the message that reached the final state at the provided time
+type finishedStatus struct {
+	ID string
+	At time.Time
+}
+
+// InitStatusTracker is StatusTracker factory method. Status of the message is forgotten after the TTL since all its
+// parts are sent or the message failed
+func InitStatusTracker(ttl time.Duration, c utils.Clock) StatusTracker {
+	return &tracker{&sync.Mutex{}, c, ttl, map[string]*qModels.MessageStatus{}, map[string]map[string]qModels.PartRef{},
+		map[string]time.Time{}, nil}
+}
+
+// Accept registers new message that passed the validation together with the API client that submitted it
+func (t *tracker) Accept(id string, client string) {
+	t.Mutex.Lock()
+	defer t.Mutex.Unlock()
+
+	t.evict()
+	t.Statuses[id] = qModels.InitMessageStatus(id, client)
+}
+
+// Track registers all the parts of the split message as queued
+func (t *tracker) Track(id string, parts int) {
+	t.Mutex.Lock()
+	defer t.Mutex.Unlock()
+
+	s, ok := t.Statuses[id]
+
+	if !ok {
+		s = qModels.InitMessageStatus(id, "")
+		t.Statuses[id] = s
+	}
+
+	s.Parts = make([]*qModels.PartStatus, parts)
+
+	for i := range s.Parts {
+		s.Parts[i] = qModels.InitPartStatus(i+1, qModels.Queued)
+	}
+
+	s.Refresh()
+	t.finish(s)
+}
+
+// SetState changes the state of the recipients of the message part. Part is in the least advanced state of its
+// recipients, so it's sent only when all of them are sent
+func (t *tracker) SetState(ref qModels.PartRef, recipients []string, st qModels.State) {
+	t.Mutex.Lock()
+	defer t.Mutex.Unlock()
+
+	s, p := t.getPart(ref)
+
+	if p == nil {
+		return
+	}
+
+	p.SetState(recipients, st)
+	s.Refresh()
+	t.finish(s)
+}
+
+// AddMessageBirdID saves the identifier MessageBird returned for the message part together with the recipients
+// of the part, so delivery reports could be correlated with the part later
+func (t *tracker) AddMessageBirdID(ref qModels.PartRef, mbID string, recipients []string) {
+	t.Mutex.Lock()
+	defer t.Mutex.Unlock()
+
+	_, p := t.getPart(ref)
+
+	if p == nil {
+		return
+	}
+
+	p.MessageBirdIDs = append(p.MessageBirdIDs, mbID)
+
+	// the same MessageBird message could contain recipients of different submitted messages
+	rs, ok := t.Recipients[mbID]
+
+	if !ok {
+		rs = map[string]qModels.PartRef{}
+		t.Recipients[mbID] = rs
+	}
+
+	for _, r := range recipients {
+		rs[r] = ref
+	}
+}
+
+// Report adds delivery report to the message part it belongs to. Returns false if the report can't be correlated
+func (t *tracker) Report(r *qModels.DeliveryReport) bool {
+	t.Mutex.Lock()
+	defer t.Mutex.Unlock()
+
+	ref, ok := t.Recipients[r.MessageBirdID][r.Recipient]
+
+	if !ok {
+		return false
+	}
+
+	_, p := t.getPart(ref)
+
+	if p == nil {
+		return false
+	}
+
+	p.AddReport(r)
+
+	return true
+}
+
+// Get returns copy of the message status
+func (t *tracker) Get(id string) (*qModels.MessageStatus, bool) {
+	t.Mutex.Lock()
+	defer t.Mutex.Unlock()
+
+	t.evict()
+
+	s, ok := t.Statuses[id]
+
+	if !ok {
+		return nil, false
+	}
+
+	return s.Copy(), true
+}
+
+func (t *tracker) getPart(ref qModels.PartRef) (*qModels.MessageStatus, *qModels.PartStatus) {
+	s, ok := t.Statuses[ref.MessageID]
+
+	// parts are counted from 1
+	if !ok || ref.Part < 1 || ref.Part > len(s.Parts) {
+		return nil, nil
+	}
+
+	return s, s.Parts[ref.Part-1]
+}
+
+// finish remembers when the message reached the final state, so it could be forgotten after the TTL
+func (t *tracker) finish(s *qModels.MessageStatus) {
+	if !s.State.IsFinal() {
+		delete(t.FinishedAt, s.ID)
+		return
+	}
+
+	if _, ok := t.FinishedAt[s.ID]; ok {
+		return
+	}
+
+	now := t.Clock.Now()
+	t.FinishedAt[s.ID] = now
+	t.Finished = append(t.Finished, finishedStatus{s.ID, now})
+}
+
+// evict forgets the messages that are in the final state for longer than the TTL together with their recipients
+func (t *tracker) evict() {
+	before := t.Clock.Now().Add(-t.TTL)
+	i := 0
+
+	for ; i < len(t.Finished) && !t.Finished[i].At.After(before); i++ {
+		f := t.Finished[i]
+
+		// message could leave the final state (e.g. replayed from the dead-letter store) and reach it again later
+		if at, ok := t.FinishedAt[f.ID]; !ok || !at.Equal(f.At) {
+			continue
+		}
+
+		for _, p := range t.Statuses[f.ID].Parts {
+			t.forgetRecipients(f.ID, p.MessageBirdIDs)
+		}
+
+		delete(t.Statuses, f.ID)
+		delete(t.FinishedAt, f.ID)
+	}
+
+	t.Finished = t.Finished[i:]
+}
+
+// forgetRecipients removes the recipients of the message from the MessageBird messages. The same MessageBird message
+// could contain recipients of other messages, they are kept
+func (t *tracker) forgetRecipients(id string, mbIDs []string) {
+	for _, mbID := range mbIDs {
+		rs := t.Recipients[mbID]
+
+		for r, ref := range rs {
+			if ref.MessageID == id {
+				delete(rs, r)
+			}
+		}
+
+		if len(rs) == 0 {
+			delete(t.Recipients, mbID)
+		}
+	}
+}
+
+// restoreStatuses registers the messages replayed from the storage that are not tracked (e.g. after the restart).
+// Storage keeps every part of the message till all of them are sent to all the recipients, so the message has as
+// many parts as there are persisted. Deliveries keep the client that submitted the message
+func restoreStatuses(t StatusTracker, ms []qModels.QueueMessage) {
+	var ids []string
+
+	parts := map[string]int{}
+	clients := map[string]string{}
+
+	for _, m := range ms {
+		refs := []qModels.PartRef{m.GetRef()}
+
+		if ds := m.GetDeliveries(); len(ds) > 0 {
+			refs = refs[:0]
+
+			for _, d := range ds {
+				refs = append(refs, d.Ref)
+				clients[d.Ref.MessageID] = d.Client
+			}
+		}
+
+		for _, r := range refs {
+			if _, ok := parts[r.MessageID]; !ok {
+				ids = append(ids, r.MessageID)
+			}
+
+			if r.Part > parts[r.MessageID] {
+				parts[r.MessageID] = r.Part
+			}
+		}
+	}
+
+	for _, id := range ids {
+		if _, ok := t.Get(id); !ok && id != "" {
+			t.Accept(id, clients[id])
+			t.Track(id, parts[id])
+		}
+	}
+}
@@ -0,0 +1,189 @@
+package queue_test
+
+import (
+	"mocks"
+	"queue"
+	"queue/models"
+	"testing"
+	"time"
+	"utils"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStatusTracker(t *testing.T) {
+	t.Run("unknown message is not found", func(t *testing.T) {
+		st := queue.InitStatusTracker(time.Hour, utils.InitClock())
+		_, ok := st.Get("unknown")
+
+		assert.False(t, ok)
+	})
+
+	t.Run("accepted message has no parts", func(t *testing.T) {
+		st := queue.InitStatusTracker(time.Hour, utils.InitClock())
+		st.Accept("id", "shop")
+
+		s, ok := st.Get("id")
+
+		assert.True(t, ok)
+		assert.Equal(t, models.Accepted, s.State)
+		assert.Empty(t, s.Parts)
+		assert.Equal(t, "shop", s.Client)
+	})
+
+	t.Run("tracked message has all parts queued", func(t *testing.T) {
+		st := queue.InitStatusTracker(time.Hour, utils.InitClock())
+		st.Accept("id", "")
+		st.Track("id", 2)
+
+		s, _ := st.Get("id")
+
+		assert.Equal(t, models.Queued, s.State)
+		assert.Equal(t, []*models.PartStatus{
+			{Part: 1, State: models.Queued, MessageBirdIDs: []string{}, Reports: []*models.DeliveryReport{}},
+			{Part: 2, State: models.Queued, MessageBirdIDs: []string{}, Reports: []*models.DeliveryReport{}},
+		}, s.Parts)
+	})
+
+	t.Run("part state and messagebird ids are updated", func(t *testing.T) {
+		st := queue.InitStatusTracker(time.Hour, utils.InitClock())
+		st.Accept("id", "")
+		st.Track("id", 2)
+
+		ref := models.PartRef{MessageID: "id", Part: 2}
+		st.SetState(ref, nil, models.Sent)
+		st.AddMessageBirdID(ref, "mb", []string{"123"})
+
+		s, _ := st.Get("id")
+
+		assert.Equal(t, models.Queued, s.Parts[0].State)
+		assert.Equal(t, models.Sent, s.Parts[1].State)
+		assert.Equal(t, []string{"mb"}, s.Parts[1].MessageBirdIDs)
+		assert.Equal(t, models.Queued, s.State)
+	})
+
+	t.Run("part is in the least advanced state of its recipients", func(t *testing.T) {
+		st := queue.InitStatusTracker(time.Hour, utils.InitClock())
+		st.Track("id", 1)
+
+		ref := models.PartRef{MessageID: "id", Part: 1}
+		state := func() models.State {
+			s, _ := st.Get("id")
+			return s.Parts[0].State
+		}
+
+		st.SetState(ref, []string{"1", "2", "3"}, models.Queued)
+		st.SetState(ref, []string{"1"}, models.Sent)
+		assert.Equal(t, models.Queued, state())
+
+		st.SetState(ref, []string{"2"}, models.Retrying)
+		assert.Equal(t, models.Retrying, state())
+
+		st.SetState(ref, []string{"2"}, models.Sent)
+		assert.Equal(t, models.Queued, state())
+
+		st.SetState(ref, []string{"3"}, models.Failed)
+		assert.Equal(t, models.Failed, state())
+
+		st.SetState(ref, []string{"3"}, models.Sent)
+		assert.Equal(t, models.Sent, state())
+	})
+
+	t.Run("unknown parts are ignored", func(t *testing.T) {
+		st := queue.InitStatusTracker(time.Hour, utils.InitClock())
+		st.Track("id", 1)
+
+		st.SetState(models.PartRef{MessageID: "id", Part: 2}, nil, models.Failed)
+		st.SetState(models.PartRef{MessageID: "other", Part: 1}, nil, models.Failed)
+
+		s, _ := st.Get("id")
+
+		assert.Equal(t, models.Queued, s.State)
+	})
+
+	t.Run("delivery reports are correlated with the parts by messagebird id and recipient", func(t *testing.T) {
+		st := queue.InitStatusTracker(time.Hour, utils.InitClock())
+		st.Track("a", 1)
+		st.Track("b", 2)
+
+		// recipients of different submitted messages were sent within one messagebird message
+		st.AddMessageBirdID(models.PartRef{MessageID: "a", Part: 1}, "mb", []string{"123"})
+		st.AddMessageBirdID(models.PartRef{MessageID: "b", Part: 2}, "mb", []string{"321"})
+
+		assert.True(t, st.Report(&models.DeliveryReport{MessageBirdID: "mb", Recipient: "321", Status: "delivered"}))
+
+		a, _ := st.Get("a")
+		b, _ := st.Get("b")
+
+		assert.Empty(t, a.Parts[0].Reports)
+		assert.Empty(t, b.Parts[0].Reports)
+		assert.Equal(t, []*models.DeliveryReport{{MessageBirdID: "mb", Recipient: "321", Status: "delivered"}}, b.Parts[1].Reports)
+	})
+
+	t.Run("delivery reports for unknown messages are not correlated", func(t *testing.T) {
+		st := queue.InitStatusTracker(time.Hour, utils.InitClock())
+		st.Track("a", 1)
+		st.AddMessageBirdID(models.PartRef{MessageID: "a", Part: 1}, "mb", []string{"123"})
+
+		assert.False(t, st.Report(&models.DeliveryReport{MessageBirdID: "other", Recipient: "123"}))
+		assert.False(t, st.Report(&models.DeliveryReport{MessageBirdID: "mb", Recipient: "321"}))
+	})
+
+	t.Run("status is forgotten after the TTL since the message is sent", func(t *testing.T) {
+		c := mocks.NewClockMock(time.Now())
+		st := queue.InitStatusTracker(time.Hour, c)
+		st.Track("id", 2)
+
+		st.SetState(models.PartRef{MessageID: "id", Part: 1}, nil, models.Sent)
+		c.Advance(time.Hour)
+
+		// part that isn't sent yet keeps the status
+		_, ok := st.Get("id")
+		assert.True(t, ok)
+
+		st.SetState(models.PartRef{MessageID: "id", Part: 2}, nil, models.Sent)
+		st.AddMessageBirdID(models.PartRef{MessageID: "id", Part: 2}, "mb", []string{"123"})
+		c.Advance(time.Hour - time.Second)
+
+		_, ok = st.Get("id")
+		assert.True(t, ok)
+		assert.True(t, st.Report(&models.DeliveryReport{MessageBirdID: "mb", Recipient: "123"}))
+
+		c.Advance(time.Second)
+
+		_, ok = st.Get("id")
+		assert.False(t, ok)
+		assert.False(t, st.Report(&models.DeliveryReport{MessageBirdID: "mb", Recipient: "123"}))
+	})
+
+	t.Run("failed message that is sent again keeps the status", func(t *testing.T) {
+		c := mocks.NewClockMock(time.Now())
+		st := queue.InitStatusTracker(time.Hour, c)
+		st.Track("id", 1)
+
+		st.SetState(models.PartRef{MessageID: "id", Part: 1}, nil, models.Failed)
+		c.Advance(30 * time.Minute)
+		st.SetState(models.PartRef{MessageID: "id", Part: 1}, nil, models.Queued)
+		c.Advance(time.Hour)
+
+		s, ok := st.Get("id")
+		assert.True(t, ok)
+		assert.Equal(t, models.Queued, s.State)
+	})
+
+	t.Run("recipients of other messages sent within the same messagebird message are kept", func(t *testing.T) {
+		c := mocks.NewClockMock(time.Now())
+		st := queue.InitStatusTracker(time.Hour, c)
+		st.Track("a", 1)
+		st.Track("b", 1)
+
+		st.SetState(models.PartRef{MessageID: "a", Part: 1}, nil, models.Sent)
+		st.AddMessageBirdID(models.PartRef{MessageID: "a", Part: 1}, "mb", []string{"123"})
+		st.AddMessageBirdID(models.PartRef{MessageID: "b", Part: 1}, "mb", []string{"321"})
+		c.Advance(time.Hour)
+
+		_, ok := st.Get("a")
+		assert.False(t, ok)
+		assert.True(t, st.Report(&models.DeliveryReport{MessageBirdID: "mb", Recipient: "321"}))
+	})
+}
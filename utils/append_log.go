@@ -0,0 +1,147 @@
+package utils
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// AppendLog is the file JSON records are appended to, so the state they describe is restored after the restart.
+// The log is rewritten with the records of the current state only once it has enough records appended
+type AppendLog interface {
+	Replay(apply func(r json.RawMessage) error) error
+	Append(r interface{}) error
+	Compact() error
+}
+
+// Snapshot writes the records the current state is restored from
+type Snapshot func(write func(r interface{}) error) error
+
+type appendLog struct {
+	File      *os.File
+	Path      string
+	Records   int
+	Threshold int
+	Snapshot  Snapshot
+}
+
+// InitAppendLog is AppendLog factory method. The log at the provided path is rewritten with the snapshot records
+// after the threshold amount of records is appended. Log is opened for appending by the first compaction
+func InitAppendLog(path string, threshold int, s Snapshot) AppendLog {
+	return &appendLog{nil, path, 0, threshold, s}
+}
+
+// Replay applies all the records of existing log
+func (l *appendLog) Replay(apply func(r json.RawMessage) error) error {
+	f, err := os.Open(l.Path)
+
+	if os.IsNotExist(err) {
+		return nil
+	}
+
+	if err != nil {
+		return err
+	}
+
+	defer f.Close()
+
+	d := json.NewDecoder(bufio.NewReader(f))
+
+	for {
+		var r json.RawMessage
+		err := d.Decode(&r)
+
+		// the last record could be written partially if the process crashed in the middle of the writing
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return nil
+		}
+
+		if err != nil {
+			return err
+		}
+
+		if err = apply(r); err != nil {
+			return err
+		}
+	}
+}
+
+// Compact rewrites the log with the snapshot records only
+func (l *appendLog) Compact() error {
+	if l.File != nil {
+		_ = l.File.Close() // #nosec
+	}
+
+	tmp := l.Path + ".tmp"
+
+	f, err := os.OpenFile(tmp, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0600)
+
+	if err != nil {
+		return err
+	}
+
+	w := bufio.NewWriter(f)
+	e := json.NewEncoder(w)
+
+	if err = l.Snapshot(e.Encode); err == nil {
+		if err = w.Flush(); err == nil {
+			err = f.Sync()
+		}
+	}
+
+	_ = f.Close() // #nosec
+
+	if err != nil {
+		return err
+	}
+
+	if err = os.Rename(tmp, l.Path); err != nil {
+		return err
+	}
+
+	l.syncDir()
+
+	l.File, err = os.OpenFile(l.Path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	l.Records = 0
+
+	return err
+}
+
+// Append writes the record to the end of the log and flushes it to the disk
+func (l *appendLog) Append(r interface{}) error {
+	b, err := json.Marshal(r)
+
+	if err != nil {
+		return err
+	}
+
+	if _, err = l.File.Write(append(b, '\n')); err != nil {
+		return err
+	}
+
+	if err = l.File.Sync(); err != nil {
+		return err
+	}
+
+	l.Records++
+
+	if l.Records >= l.Threshold {
+		return l.Compact()
+	}
+
+	return nil
+}
+
+// syncDir flushes the rename of the log to the disk
+func (l *appendLog) syncDir() {
+	d, err := os.Open(filepath.Dir(l.Path))
+
+	if err != nil {
+		return
+	}
+
+	_ = d.Sync()  // #nosec
+	_ = d.Close() // #nosec
+}
@@ -0,0 +1,105 @@
+package utils_test
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"utils"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAppendLog(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "birdfeeder")
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "append.log")
+
+	var state []string
+
+	snapshot := func(write func(r interface{}) error) error {
+		for _, s := range state {
+			if err := write(s); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	}
+
+	replay := func(l utils.AppendLog) ([]string, error) {
+		var result []string
+
+		err := l.Replay(func(r json.RawMessage) error {
+			var s string
+			err := json.Unmarshal(r, &s)
+			result = append(result, s)
+
+			return err
+		})
+
+		return result, err
+	}
+
+	t.Run("missing log has no records", func(t *testing.T) {
+		rs, err := replay(utils.InitAppendLog(path, 3, snapshot))
+
+		assert.Nil(t, err)
+		assert.Empty(t, rs)
+	})
+
+	t.Run("appended records are replayed in order", func(t *testing.T) {
+		l := utils.InitAppendLog(path, 3, snapshot)
+		assert.Nil(t, l.Compact())
+
+		assert.Nil(t, l.Append("a"))
+		assert.Nil(t, l.Append("b"))
+
+		rs, err := replay(utils.InitAppendLog(path, 3, snapshot))
+
+		assert.Nil(t, err)
+		assert.Equal(t, []string{"a", "b"}, rs)
+	})
+
+	t.Run("log is rewritten with the snapshot after the threshold", func(t *testing.T) {
+		state = []string{"state"}
+		l := utils.InitAppendLog(path, 3, snapshot)
+		assert.Nil(t, l.Compact())
+
+		assert.Nil(t, l.Append("a"))
+		assert.Nil(t, l.Append("b"))
+		assert.Nil(t, l.Append("c"))
+		assert.Nil(t, l.Append("d"))
+
+		rs, err := replay(utils.InitAppendLog(path, 3, snapshot))
+
+		assert.Nil(t, err)
+		assert.Equal(t, []string{"state", "d"}, rs)
+
+		_, err = os.Stat(path + ".tmp")
+		assert.True(t, os.IsNotExist(err))
+	})
+
+	t.Run("partially written last record is ignored", func(t *testing.T) {
+		f, _ := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0600)
+		f.WriteString(`"parti`)
+		f.Close()
+
+		rs, err := replay(utils.InitAppendLog(path, 3, snapshot))
+
+		assert.Nil(t, err)
+		assert.Equal(t, []string{"state", "d"}, rs)
+	})
+
+	t.Run("returns the error of the applied record", func(t *testing.T) {
+		corrupted := filepath.Join(dir, "corrupted.log")
+		ioutil.WriteFile(corrupted, []byte(strings.Repeat("{}\n", 2)), 0600)
+
+		_, err := replay(utils.InitAppendLog(corrupted, 3, snapshot))
+
+		assert.NotNil(t, err)
+	})
+}
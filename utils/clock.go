@@ -0,0 +1,26 @@
+package utils
+
+import "time"
+
+// Clock is a source of time. It makes it possible to test time-dependent logic without real sleeping
+type Clock interface {
+	Now() time.Time
+	After(d time.Duration) <-chan time.Time
+}
+
+type clock struct{}
+
+// InitClock is real Clock factory method
+func InitClock() Clock {
+	return &clock{}
+}
+
+// Now returns current time
+func (c *clock) Now() time.Time {
+	return time.Now()
+}
+
+// After waits for the duration to elapse and then sends the current time on the returned channel
+func (c *clock) After(d time.Duration) <-chan time.Time {
+	return time.After(d)
+}
@@ -0,0 +1,23 @@
+package utils_test
+
+import (
+	"testing"
+	"time"
+	"utils"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestClock(t *testing.T) {
+	c := utils.InitClock()
+
+	t.Run("returns current time", func(t *testing.T) {
+		assert.WithinDuration(t, time.Now(), c.Now(), time.Second)
+	})
+
+	t.Run("sends time after the duration", func(t *testing.T) {
+		start := time.Now()
+		<-c.After(10 * time.Millisecond)
+		assert.True(t, time.Since(start) >= 10*time.Millisecond)
+	})
+}
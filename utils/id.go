@@ -0,0 +1,18 @@
+package utils
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+)
+
+// messageIDLength is the amount of random bytes used for message identifiers
+const messageIDLength = 16
+
+// GenerateID returns random hex identifier that is used to track submitted messages
+func GenerateID() string {
+	b := make([]byte, messageIDLength)
+
+	_, _ = rand.Read(b) // #nosec
+
+	return hex.EncodeToString(b)
+}
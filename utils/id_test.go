@@ -0,0 +1,18 @@
+package utils_test
+
+import (
+	"testing"
+	"utils"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGenerateID(t *testing.T) {
+	t.Run("generates 32 symbols long hex identifier", func(t *testing.T) {
+		assert.Regexp(t, "^[0-9a-f]{32}$", utils.GenerateID())
+	})
+
+	t.Run("generates different identifiers", func(t *testing.T) {
+		assert.NotEqual(t, utils.GenerateID(), utils.GenerateID())
+	})
+}
@@ -0,0 +1,99 @@
+package utils
+
+import (
+	"encoding/json"
+	"sync"
+	"time"
+)
+
+// IdempotentResponse is the response rendered for the request with the idempotency key. Hash of the request body
+// tells if the key is reused for another request
+type IdempotentResponse struct {
+	Key         string          `json:"key"`
+	RequestHash string          `json:"request_hash"`
+	Status      int             `json:"status"`
+	Body        json.RawMessage `json:"body"`
+	MessageID   string          `json:"message_id"`
+	CreatedAt   time.Time       `json:"created_at"`
+}
+
+// IdempotencyStore keeps the responses by the idempotency keys of the requests for the TTL, so the retried request
+// gets the original response instead of being processed again
+type IdempotencyStore interface {
+	Get(key string) (*IdempotentResponse, bool)
+	Add(r *IdempotentResponse) (*IdempotentResponse, error)
+}
+
+type idempotencyStore struct {
+	Mutex     *sync.Mutex
+	Clock     Clock
+	TTL       time.Duration
+	Responses map[string]*IdempotentResponse
+	// Expiry is the responses in order they were added
+	Expiry []*IdempotentResponse
+}
+
+// InitIdempotencyStore is in-memory IdempotencyStore factory method. Keys are forgotten after the TTL or the restart
+func InitIdempotencyStore(ttl time.Duration, c Clock) IdempotencyStore {
+	return initIdempotencyStore(ttl, c)
+}
+
+func initIdempotencyStore(ttl time.Duration, c Clock) *idempotencyStore {
+	return &idempotencyStore{&sync.Mutex{}, c, ttl, map[string]*IdempotentResponse{}, nil}
+}
+
+// Get returns the response of the request with the provided key unless it's expired
+func (s *idempotencyStore) Get(key string) (*IdempotentResponse, bool) {
+	s.Mutex.Lock()
+	defer s.Mutex.Unlock()
+
+	s.evict()
+
+	r, ok := s.Responses[key]
+
+	return r, ok
+}
+
+// Add keeps the response created now. If the response with the same key is already kept, it's returned instead
+func (s *idempotencyStore) Add(r *IdempotentResponse) (*IdempotentResponse, error) {
+	s.Mutex.Lock()
+	defer s.Mutex.Unlock()
+
+	r.CreatedAt = s.Clock.Now()
+
+	return s.add(r), nil
+}
+
+func (s *idempotencyStore) add(r *IdempotentResponse) *IdempotentResponse {
+	s.evict()
+
+	if e, ok := s.Responses[r.Key]; ok {
+		return e
+	}
+
+	// expired responses are never kept (e.g. replayed from the log)
+	if !r.CreatedAt.After(s.Clock.Now().Add(-s.TTL)) {
+		return r
+	}
+
+	s.Responses[r.Key] = r
+	s.Expiry = append(s.Expiry, r)
+
+	return r
+}
+
+// evict forgets the responses that are older than the TTL
+func (s *idempotencyStore) evict() {
+	before := s.Clock.Now().Add(-s.TTL)
+	i := 0
+
+	for ; i < len(s.Expiry) && !s.Expiry[i].CreatedAt.After(before); i++ {
+		if r := s.Expiry[i]; s.Responses[r.Key] == r {
+			delete(s.Responses, r.Key)
+		}
+
+		s.Expiry[i] = nil
+	}
+
+	s.Expiry = s.Expiry[i:]
+}
@@ -0,0 +1,78 @@
+package utils
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// amount of log records after which the log is rewritten with the responses that are not expired only
+const idempotencyCompactThreshold = 1000
+
+type fileIdempotencyStore struct {
+	Memory *idempotencyStore
+	Log    AppendLog
+}
+
+// InitFileIdempotencyStore is file-backed IdempotencyStore factory method. Every added response is appended to the
+// log at the provided path, so the keys are kept after the restart till the TTL
+func InitFileIdempotencyStore(path string, ttl time.Duration, c Clock) (IdempotencyStore, error) {
+	s := &fileIdempotencyStore{initIdempotencyStore(ttl, c), nil}
+	s.Log = InitAppendLog(path, idempotencyCompactThreshold, s.snapshot)
+
+	if err := s.Log.Replay(s.apply); err != nil {
+		return nil, err
+	}
+
+	// start from the log that keeps only the responses that are not expired
+	if err := s.Log.Compact(); err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
+// Get returns the response of the request with the provided key unless it's expired
+func (s *fileIdempotencyStore) Get(key string) (*IdempotentResponse, bool) {
+	return s.Memory.Get(key)
+}
+
+// Add appends the response created now to the log. If the response with the same key is already kept, it's returned
+// instead
+func (s *fileIdempotencyStore) Add(r *IdempotentResponse) (*IdempotentResponse, error) {
+	s.Memory.Mutex.Lock()
+	defer s.Memory.Mutex.Unlock()
+
+	r.CreatedAt = s.Memory.Clock.Now()
+
+	if e := s.Memory.add(r); e != r {
+		return e, nil
+	}
+
+	return r, s.Log.Append(r)
+}
+
+// apply adds the response of the log record
+func (s *fileIdempotencyStore) apply(b json.RawMessage) error {
+	r := &IdempotentResponse{}
+
+	if err := json.Unmarshal(b, r); err != nil {
+		return err
+	}
+
+	s.Memory.add(r)
+
+	return nil
+}
+
+// snapshot writes the responses that are not expired only
+func (s *fileIdempotencyStore) snapshot(write func(r interface{}) error) error {
+	s.Memory.evict()
+
+	for _, r := range s.Memory.Expiry {
+		if err := write(r); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,69 @@
+package utils_test
+
+import (
+	"io/ioutil"
+	"mocks"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+	"utils"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFileIdempotencyStore(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "birdfeeder")
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "idempotency.log")
+	c := mocks.NewClockMock(time.Date(2017, 11, 5, 10, 0, 0, 0, time.UTC))
+
+	s, err := utils.InitFileIdempotencyStore(path, time.Hour, c)
+	assert.Nil(t, err)
+
+	testIdempotencyStore(t, s, c)
+
+	t.Run("keys are restored after the restart till the TTL", func(t *testing.T) {
+		s.Add(&utils.IdempotentResponse{Key: "other", Status: 200, Body: []byte(`{"id":"id4"}`), MessageID: "id4"})
+
+		restarted, err := utils.InitFileIdempotencyStore(path, time.Hour, c)
+		assert.Nil(t, err)
+
+		r, ok := restarted.Get("key")
+		assert.True(t, ok)
+		assert.Equal(t, "id3", r.MessageID)
+		assert.JSONEq(t, `{"id":"id3"}`, string(r.Body))
+
+		c.Advance(time.Hour)
+
+		restarted, err = utils.InitFileIdempotencyStore(path, time.Hour, c)
+		assert.Nil(t, err)
+
+		_, ok = restarted.Get("other")
+		assert.False(t, ok)
+	})
+
+	t.Run("partially written last record is ignored", func(t *testing.T) {
+		restarted, _ := utils.InitFileIdempotencyStore(path, time.Hour, c)
+		restarted.Add(&utils.IdempotentResponse{Key: "last", Status: 200, Body: []byte(`{}`), MessageID: "id5"})
+
+		f, _ := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0600)
+		f.WriteString(`{"key":"partial","sta`)
+		f.Close()
+
+		restarted, err := utils.InitFileIdempotencyStore(path, time.Hour, c)
+		assert.Nil(t, err)
+
+		_, ok := restarted.Get("last")
+		assert.True(t, ok)
+	})
+
+	t.Run("returns error for corrupted log", func(t *testing.T) {
+		corrupted := filepath.Join(dir, "corrupted.log")
+		ioutil.WriteFile(corrupted, []byte("not a log\n"), 0600)
+
+		_, err := utils.InitFileIdempotencyStore(corrupted, time.Hour, c)
+		assert.NotNil(t, err)
+	})
+}
@@ -0,0 +1,57 @@
+package utils_test
+
+import (
+	"mocks"
+	"testing"
+	"time"
+	"utils"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIdempotencyStore(t *testing.T) {
+	c := mocks.NewClockMock(time.Date(2017, 11, 5, 10, 0, 0, 0, time.UTC))
+
+	testIdempotencyStore(t, utils.InitIdempotencyStore(time.Hour, c), c)
+}
+
+// testIdempotencyStore checks the behaviour every IdempotencyStore (with the TTL of one hour) should have
+func testIdempotencyStore(t *testing.T, s utils.IdempotencyStore, c *mocks.ClockMock) {
+	t.Run("returns nothing for unknown key", func(t *testing.T) {
+		_, ok := s.Get("unknown")
+
+		assert.False(t, ok)
+	})
+
+	t.Run("returns added response", func(t *testing.T) {
+		r := &utils.IdempotentResponse{Key: "key", Status: 200, Body: []byte(`{"id":"id1"}`), MessageID: "id1"}
+
+		added, err := s.Add(r)
+		assert.Nil(t, err)
+		assert.Exactly(t, r, added)
+		assert.Equal(t, c.Now(), r.CreatedAt)
+
+		stored, ok := s.Get("key")
+		assert.True(t, ok)
+		assert.Equal(t, "id1", stored.MessageID)
+		assert.JSONEq(t, `{"id":"id1"}`, string(stored.Body))
+	})
+
+	t.Run("returns the original response if the key is already added", func(t *testing.T) {
+		added, err := s.Add(&utils.IdempotentResponse{Key: "key", Status: 200, Body: []byte(`{"id":"id2"}`), MessageID: "id2"})
+
+		assert.Nil(t, err)
+		assert.Equal(t, "id1", added.MessageID)
+	})
+
+	t.Run("forgets the key after the TTL", func(t *testing.T) {
+		c.Advance(time.Hour)
+
+		_, ok := s.Get("key")
+		assert.False(t, ok)
+
+		added, err := s.Add(&utils.IdempotentResponse{Key: "key", Status: 200, Body: []byte(`{"id":"id3"}`), MessageID: "id3"})
+		assert.Nil(t, err)
+		assert.Equal(t, "id3", added.MessageID)
+	})
+}
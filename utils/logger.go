@@ -0,0 +1,133 @@
+package utils
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Level is a severity of the log entry
+type Level int
+
+// Log levels. Entries below the level of the logger are not written
+const (
+	DebugLevel Level = iota
+	InfoLevel
+	ErrorLevel
+)
+
+var levelNames = map[Level]string{
+	DebugLevel: "debug",
+	InfoLevel:  "info",
+	ErrorLevel: "error",
+}
+
+// String returns the name of the level
+func (l Level) String() string {
+	return levelNames[l]
+}
+
+// ParseLevel returns the level by its name
+func ParseLevel(s string) (Level, error) {
+	for l, n := range levelNames {
+		if n == strings.ToLower(s) {
+			return l, nil
+		}
+	}
+
+	return InfoLevel, fmt.Errorf("unknown log level %q", s)
+}
+
+// Fields are additional key-value pairs of the log entry
+type Fields map[string]interface{}
+
+// Logger writes structured log entries
+type Logger interface {
+	Debug(msg string, f Fields)
+	Info(msg string, f Fields)
+	Error(msg string, f Fields)
+	With(f Fields) Logger
+}
+
+type logger struct {
+	Writer io.Writer
+	Mutex  *sync.Mutex
+	Clock  Clock
+	Level  Level
+	Fields Fields
+}
+
+// InitLogger is Logger factory method. Every entry is written as a JSON line with the time, level and message
+func InitLogger(w io.Writer, c Clock, l Level) Logger {
+	return &logger{w, &sync.Mutex{}, c, l, Fields{}}
+}
+
+// Debug writes the entry with debug level
+func (l *logger) Debug(msg string, f Fields) {
+	l.write(DebugLevel, msg, f)
+}
+
+// Info writes the entry with info level
+func (l *logger) Info(msg string, f Fields) {
+	l.write(InfoLevel, msg, f)
+}
+
+// Error writes the entry with error level
+func (l *logger) Error(msg string, f Fields) {
+	l.write(ErrorLevel, msg, f)
+}
+
+// With returns the logger that adds provided fields to every entry
+func (l *logger) With(f Fields) Logger {
+	c := *l
+	c.Fields = l.merge(f)
+
+	return &c
+}
+
+func (l *logger) merge(f Fields) Fields {
+	r := make(Fields, len(l.Fields)+len(f))
+
+	for k, v := range l.Fields {
+		r[k] = v
+	}
+
+	for k, v := range f {
+		r[k] = v
+	}
+
+	return r
+}
+
+func (l *logger) write(lvl Level, msg string, f Fields) {
+	if lvl < l.Level {
+		return
+	}
+
+	e := l.merge(f)
+
+	for k, v := range e {
+		// errors are not serializable by themselves
+		if err, ok := v.(error); ok {
+			e[k] = err.Error()
+		}
+	}
+
+	e["time"] = l.Clock.Now().UTC().Format(time.RFC3339Nano)
+	e["level"] = lvl.String()
+	e["msg"] = msg
+
+	b, err := json.Marshal(e)
+
+	if err != nil {
+		b, _ = json.Marshal(Fields{"time": e["time"], "level": ErrorLevel.String(), "msg": "unable to write log entry", "error": err.Error()})
+	}
+
+	l.Mutex.Lock()
+	defer l.Mutex.Unlock()
+
+	_, _ = l.Writer.Write(append(b, '\n'))
+}
@@ -0,0 +1,84 @@
+package utils_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"mocks"
+	"strings"
+	"testing"
+	"time"
+	"utils"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseLevel(t *testing.T) {
+	t.Run("returns level by name", func(t *testing.T) {
+		l, err := utils.ParseLevel("ERROR")
+		assert.Nil(t, err)
+		assert.Equal(t, utils.ErrorLevel, l)
+	})
+
+	t.Run("returns error for unknown level", func(t *testing.T) {
+		_, err := utils.ParseLevel("verbose")
+		assert.NotNil(t, err)
+	})
+}
+
+func TestLogger(t *testing.T) {
+	now := time.Date(2017, 11, 5, 10, 0, 0, 0, time.UTC)
+	buf := &bytes.Buffer{}
+	l := utils.InitLogger(buf, mocks.NewClockMock(now), utils.InfoLevel)
+
+	// entries returns all the written entries and forgets about them
+	entries := func() []map[string]interface{} {
+		var r []map[string]interface{}
+
+		for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+			if line == "" {
+				continue
+			}
+
+			e := map[string]interface{}{}
+			assert.Nil(t, json.Unmarshal([]byte(line), &e))
+			r = append(r, e)
+		}
+
+		buf.Reset()
+
+		return r
+	}
+
+	t.Run("writes entry as JSON line with time, level and fields", func(t *testing.T) {
+		l.Info("message sent", utils.Fields{"part": 1, "error": errors.New("failed")})
+
+		assert.Equal(t, []map[string]interface{}{{
+			"time":  "2017-11-05T10:00:00Z",
+			"level": "info",
+			"msg":   "message sent",
+			"part":  float64(1),
+			"error": "failed",
+		}}, entries())
+	})
+
+	t.Run("skips entries below the level", func(t *testing.T) {
+		l.Debug("hidden", nil)
+		l.Error("shown", nil)
+
+		e := entries()
+		assert.Len(t, e, 1)
+		assert.Equal(t, "error", e[0]["level"])
+	})
+
+	t.Run("adds fields of the derived logger to every entry", func(t *testing.T) {
+		rl := l.With(utils.Fields{"request_id": "rid"})
+		rl.Info("first", utils.Fields{"part": 1})
+		l.Info("second", nil)
+
+		e := entries()
+		assert.Equal(t, "rid", e[0]["request_id"])
+		assert.Equal(t, float64(1), e[0]["part"])
+		assert.NotContains(t, e[1], "request_id")
+	})
+}
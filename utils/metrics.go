@@ -0,0 +1,123 @@
+package utils
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// Metrics collects the service metrics and exposes them in Prometheus format
+type Metrics interface {
+	RequestAccepted()
+	RequestRejected(tags ...string)
+	PartsSplit(enc Datacoding, parts int)
+	QueueDepth(f func() float64)
+	Merged()
+	ProviderCalled(d time.Duration, err error)
+	Retried()
+	Handler() http.Handler
+}
+
+type metrics struct {
+	Registry         *prometheus.Registry
+	Requests         *prometheus.CounterVec
+	Rejections       *prometheus.CounterVec
+	Parts            *prometheus.CounterVec
+	Merges           prometheus.Counter
+	ProviderDuration prometheus.Histogram
+	ProviderErrors   prometheus.Counter
+	Retries          prometheus.Counter
+}
+
+// InitMetrics is Metrics factory method. Every instance has its own registry
+func InitMetrics() Metrics {
+	m := &metrics{
+		Registry: prometheus.NewRegistry(),
+		Requests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "birdfeeder_requests_total",
+			Help: "Submitted messages by result (accepted or rejected).",
+		}, []string{"result"}),
+		Rejections: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "birdfeeder_validation_errors_total",
+			Help: "Validation errors of the rejected messages by validation tag.",
+		}, []string{"tag"}),
+		Parts: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "birdfeeder_parts_total",
+			Help: "Message parts produced by splitting the submitted messages by encoding.",
+		}, []string{"encoding"}),
+		Merges: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "birdfeeder_queue_merges_total",
+			Help: "Identical messages merged to be sent together.",
+		}),
+		ProviderDuration: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Name:    "birdfeeder_provider_request_duration_seconds",
+			Help:    "Latency of the requests to the SMS provider (MessageBird).",
+			Buckets: prometheus.DefBuckets,
+		}),
+		ProviderErrors: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "birdfeeder_provider_errors_total",
+			Help: "Requests to the SMS provider (MessageBird) that failed.",
+		}),
+		Retries: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "birdfeeder_queue_retries_total",
+			Help: "Messages sent back to the queue to be retried after the failure.",
+		}),
+	}
+
+	m.Registry.MustRegister(m.Requests, m.Rejections, m.Parts, m.Merges, m.ProviderDuration, m.ProviderErrors, m.Retries)
+
+	return m
+}
+
+// RequestAccepted counts the message that passed the validation
+func (m *metrics) RequestAccepted() {
+	m.Requests.WithLabelValues("accepted").Inc()
+}
+
+// RequestRejected counts the message that was rejected together with all the validation tags it failed
+func (m *metrics) RequestRejected(tags ...string) {
+	m.Requests.WithLabelValues("rejected").Inc()
+
+	for _, t := range tags {
+		m.Rejections.WithLabelValues(t).Inc()
+	}
+}
+
+// PartsSplit counts the parts the message was split into
+func (m *metrics) PartsSplit(enc Datacoding, parts int) {
+	m.Parts.WithLabelValues(string(enc)).Add(float64(parts))
+}
+
+// QueueDepth registers the function that returns the amount of messages waiting in the queue
+func (m *metrics) QueueDepth(f func() float64) {
+	m.Registry.MustRegister(prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+		Name: "birdfeeder_queue_depth",
+		Help: "Messages waiting in the queue to be sent.",
+	}, f))
+}
+
+// Merged counts the message merged into the identical one
+func (m *metrics) Merged() {
+	m.Merges.Inc()
+}
+
+// ProviderCalled observes the latency of the request to the SMS provider and counts the failed ones
+func (m *metrics) ProviderCalled(d time.Duration, err error) {
+	m.ProviderDuration.Observe(d.Seconds())
+
+	if err != nil {
+		m.ProviderErrors.Inc()
+	}
+}
+
+// Retried counts the message that is sent back to the queue after the failure
+func (m *metrics) Retried() {
+	m.Retries.Inc()
+}
+
+// Handler renders the metrics in Prometheus format
+func (m *metrics) Handler() http.Handler {
+	return promhttp.HandlerFor(m.Registry, promhttp.HandlerOpts{})
+}
@@ -0,0 +1,71 @@
+package utils_test
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+	"utils"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMetrics(t *testing.T) {
+	m := utils.InitMetrics()
+
+	// scrape renders metrics in Prometheus format
+	scrape := func() string {
+		rec := httptest.NewRecorder()
+		m.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+
+		return rec.Body.String()
+	}
+
+	t.Run("counts accepted and rejected requests by validation tag", func(t *testing.T) {
+		m.RequestAccepted()
+		m.RequestRejected("required", "msisdn")
+		m.RequestRejected("msisdn")
+
+		s := scrape()
+		assert.Contains(t, s, `birdfeeder_requests_total{result="accepted"} 1`)
+		assert.Contains(t, s, `birdfeeder_requests_total{result="rejected"} 2`)
+		assert.Contains(t, s, `birdfeeder_validation_errors_total{tag="msisdn"} 2`)
+		assert.Contains(t, s, `birdfeeder_validation_errors_total{tag="required"} 1`)
+	})
+
+	t.Run("counts parts by encoding", func(t *testing.T) {
+		m.PartsSplit(utils.Plain, 3)
+		m.PartsSplit(utils.Unicode, 1)
+
+		s := scrape()
+		assert.Contains(t, s, `birdfeeder_parts_total{encoding="plain"} 3`)
+		assert.Contains(t, s, `birdfeeder_parts_total{encoding="unicode"} 1`)
+	})
+
+	t.Run("reports queue depth", func(t *testing.T) {
+		m.QueueDepth(func() float64 { return 5 })
+
+		assert.Contains(t, scrape(), `birdfeeder_queue_depth 5`)
+	})
+
+	t.Run("counts merges and retries", func(t *testing.T) {
+		m.Merged()
+		m.Retried()
+		m.Retried()
+
+		s := scrape()
+		assert.Contains(t, s, `birdfeeder_queue_merges_total 1`)
+		assert.Contains(t, s, `birdfeeder_queue_retries_total 2`)
+	})
+
+	t.Run("observes provider latency and errors", func(t *testing.T) {
+		m.ProviderCalled(200*time.Millisecond, nil)
+		m.ProviderCalled(time.Second, errors.New("err"))
+
+		s := scrape()
+		assert.Contains(t, s, `birdfeeder_provider_request_duration_seconds_count 2`)
+		assert.Contains(t, s, `birdfeeder_provider_request_duration_seconds_sum 1.2`)
+		assert.Contains(t, s, `birdfeeder_provider_errors_total 1`)
+	})
+}
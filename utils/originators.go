@@ -0,0 +1,176 @@
+package utils
+
+import (
+	"io/ioutil"
+	"os"
+	"sort"
+	"sync"
+
+	"gopkg.in/yaml.v2"
+)
+
+// ApprovedOriginator is the originator (alphanumeric name or owned MSISDN) the messages could be sent from
+type ApprovedOriginator struct {
+	Originator string `json:"originator" yaml:"originator" validate:"required,textoriginator|msisdn"`
+	// Clients are the names of the API clients allowed to use the originator (any client if empty)
+	Clients []string `json:"clients" yaml:"clients"`
+}
+
+// allows checks if the client could send the messages from the originator
+func (a *ApprovedOriginator) allows(client string) bool {
+	if len(a.Clients) == 0 {
+		return true
+	}
+
+	for _, c := range a.Clients {
+		if c == client {
+			return true
+		}
+	}
+
+	return false
+}
+
+// OriginatorRegistry keeps the approved originators
+type OriginatorRegistry interface {
+	IsApproved(originator string, client string) bool
+	Approve(a *ApprovedOriginator) error
+	Revoke(originator string) (bool, error)
+	List() []*ApprovedOriginator
+}
+
+type originatorRegistry struct {
+	Mutex       *sync.RWMutex
+	Path        string
+	Originators map[string]*ApprovedOriginator
+}
+
+// InitOriginatorRegistry is OriginatorRegistry factory method. Approved originators are read from the file
+// (if it exists) and every change is written back to it. Registry is kept only in memory if the path is empty
+func InitOriginatorRegistry(path string) (OriginatorRegistry, error) {
+	r := &originatorRegistry{&sync.RWMutex{}, path, map[string]*ApprovedOriginator{}}
+
+	if path == "" {
+		return r, nil
+	}
+
+	b, err := ioutil.ReadFile(path)
+
+	if os.IsNotExist(err) {
+		return r, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	var as []*ApprovedOriginator
+
+	if err := yaml.UnmarshalStrict(b, &as); err != nil {
+		return nil, err
+	}
+
+	for _, a := range as {
+		r.Originators[a.Originator] = a
+	}
+
+	return r, nil
+}
+
+// IsApproved checks if the originator is approved and the client is allowed to use it
+func (r *originatorRegistry) IsApproved(originator string, client string) bool {
+	r.Mutex.RLock()
+	defer r.Mutex.RUnlock()
+
+	a, ok := r.Originators[originator]
+
+	return ok && a.allows(client)
+}
+
+// Approve adds the originator to the registry or replaces the clients allowed to use it
+func (r *originatorRegistry) Approve(a *ApprovedOriginator) error {
+	r.Mutex.Lock()
+	defer r.Mutex.Unlock()
+
+	c := &ApprovedOriginator{a.Originator, append([]string{}, a.Clients...)}
+	prev, existed := r.Originators[a.Originator]
+	r.Originators[a.Originator] = c
+
+	if err := r.save(); err != nil {
+		// registry has to match the file
+		if existed {
+			r.Originators[a.Originator] = prev
+		} else {
+			delete(r.Originators, a.Originator)
+		}
+
+		return err
+	}
+
+	return nil
+}
+
+// Revoke removes the originator from the registry. It returns false if originator wasn't approved
+func (r *originatorRegistry) Revoke(originator string) (bool, error) {
+	r.Mutex.Lock()
+	defer r.Mutex.Unlock()
+
+	prev, ok := r.Originators[originator]
+
+	if !ok {
+		return false, nil
+	}
+
+	delete(r.Originators, originator)
+
+	if err := r.save(); err != nil {
+		r.Originators[originator] = prev
+		return false, err
+	}
+
+	return true, nil
+}
+
+// List returns copy of all the approved originators ordered by the originator
+func (r *originatorRegistry) List() []*ApprovedOriginator {
+	r.Mutex.RLock()
+	defer r.Mutex.RUnlock()
+
+	return r.list()
+}
+
+func (r *originatorRegistry) list() []*ApprovedOriginator {
+	as := make([]*ApprovedOriginator, 0, len(r.Originators))
+
+	for _, a := range r.Originators {
+		as = append(as, &ApprovedOriginator{a.Originator, append([]string{}, a.Clients...)})
+	}
+
+	sort.Slice(as, func(i, j int) bool {
+		return as[i].Originator < as[j].Originator
+	})
+
+	return as
+}
+
+// save replaces the file with the current registry. It has to be called under the lock
+func (r *originatorRegistry) save() error {
+	if r.Path == "" {
+		return nil
+	}
+
+	b, err := yaml.Marshal(r.list())
+
+	if err != nil {
+		return err
+	}
+
+	// write to the temporary file first so the registry is never half-written
+	tmp := r.Path + ".tmp"
+
+	if err := ioutil.WriteFile(tmp, b, 0600); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp, r.Path)
+}
@@ -0,0 +1,90 @@
+package utils_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"utils"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOriginatorRegistry(t *testing.T) {
+	r, err := utils.InitOriginatorRegistry("")
+	assert.Nil(t, err)
+
+	assert.Nil(t, r.Approve(&utils.ApprovedOriginator{Originator: "Shop"}))
+	assert.Nil(t, r.Approve(&utils.ApprovedOriginator{Originator: "31612345678", Clients: []string{"bank"}}))
+
+	t.Run("originator is approved for any client if it's not bound", func(t *testing.T) {
+		assert.True(t, r.IsApproved("Shop", "bank"))
+		assert.True(t, r.IsApproved("Shop", ""))
+	})
+
+	t.Run("bound originator is approved only for its clients", func(t *testing.T) {
+		assert.True(t, r.IsApproved("31612345678", "bank"))
+		assert.False(t, r.IsApproved("31612345678", "shop"))
+		assert.False(t, r.IsApproved("31612345678", ""))
+	})
+
+	t.Run("unknown originator is not approved", func(t *testing.T) {
+		assert.False(t, r.IsApproved("Bank", "bank"))
+	})
+
+	t.Run("lists originators in order", func(t *testing.T) {
+		assert.Equal(t, []*utils.ApprovedOriginator{
+			{Originator: "31612345678", Clients: []string{"bank"}},
+			{Originator: "Shop", Clients: []string{}},
+		}, r.List())
+	})
+
+	t.Run("approving again replaces the clients", func(t *testing.T) {
+		assert.Nil(t, r.Approve(&utils.ApprovedOriginator{Originator: "Shop", Clients: []string{"shop"}}))
+		assert.False(t, r.IsApproved("Shop", "bank"))
+	})
+
+	t.Run("revoked originator is not approved", func(t *testing.T) {
+		ok, err := r.Revoke("Shop")
+		assert.True(t, ok)
+		assert.Nil(t, err)
+		assert.False(t, r.IsApproved("Shop", "shop"))
+
+		ok, err = r.Revoke("Shop")
+		assert.False(t, ok)
+		assert.Nil(t, err)
+	})
+}
+
+func TestInitOriginatorRegistry(t *testing.T) {
+	dir, err := ioutil.TempDir("", "originators")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "originators.yaml")
+
+	t.Run("starts empty if file doesn't exist", func(t *testing.T) {
+		r, err := utils.InitOriginatorRegistry(path)
+		assert.Nil(t, err)
+		assert.Empty(t, r.List())
+	})
+
+	t.Run("changes are persisted to the file", func(t *testing.T) {
+		r, _ := utils.InitOriginatorRegistry(path)
+		assert.Nil(t, r.Approve(&utils.ApprovedOriginator{Originator: "Shop", Clients: []string{"shop"}}))
+		assert.Nil(t, r.Approve(&utils.ApprovedOriginator{Originator: "Bank"}))
+		_, err := r.Revoke("Bank")
+		assert.Nil(t, err)
+
+		restored, err := utils.InitOriginatorRegistry(path)
+		assert.Nil(t, err)
+		assert.Equal(t, r.List(), restored.List())
+	})
+
+	t.Run("returns error for malformed file", func(t *testing.T) {
+		assert.Nil(t, ioutil.WriteFile(path, []byte("- unknown: field\n"), 0600))
+
+		_, err := utils.InitOriginatorRegistry(path)
+		assert.NotNil(t, err)
+	})
+}
@@ -23,38 +23,88 @@ const (
 	Unicode = "unicode"
 )
 
+// UDHReference is the size of the concatenated message reference number
+type UDHReference string
+
+const (
+	// Reference8Bit is 8-bit reference number (IEI 0x00). It's wrapped after 255 long messages
+	Reference8Bit UDHReference = "8bit"
+
+	// Reference16Bit is 16-bit reference number (IEI 0x08). It takes one more byte of every part
+	Reference16Bit UDHReference = "16bit"
+
+	// ReferenceAuto is 8-bit reference number unless all of them are used by the recipient within the reassembly window
+	ReferenceAuto UDHReference = "auto"
+)
+
 // ErrUC2 is a semantic name for error that is thrown after attempt to encode UC-2 message as GSM 7-bit
 var ErrUC2 = errors.New("UC-2")
 
 // UDHEncoder encodes text to string representation of hex values (depends on the used character)
 type UDHEncoder interface {
 	Encode(m string) *Encoded
-	GenerateUDH(p uint8, parts uint8, mesHash uint32) string
-	SplitTextMessage(m string) *Encoded
+	GenerateUDH(p uint8, parts uint8, reference uint16, ref UDHReference) string
+	SplitTextMessage(m string, maxParts int, ref UDHReference) *Encoded
+	Preview(m string, maxParts int, ref UDHReference) *Preview
+	Parts(m string) int
+	MaxParts() int
 }
 
 type udhenc struct {
-	udhUniqueID uint8
-	udhCache    map[uint32]uint8
-	udhTemplate *template.Template
+	udhTemplate   *template.Template
+	udhTemplate16 *template.Template
+	maxParts      int
+	reference     UDHReference
 }
 
 // Encoded is a representation of message split depending on amount of symbols and encoding
 type Encoded struct {
 	Encoding Datacoding
 	Messages []string
+	// Reference is the size of UDH reference number the parts were split for (empty if message isn't split)
+	Reference UDHReference
+}
+
+// Preview describes how the message would be encoded and split without sending it
+type Preview struct {
+	Encoding Datacoding     `json:"datacoding"`
+	Parts    int            `json:"parts"`
+	Messages []*PreviewPart `json:"messages"`
+	// Remaining is the amount of characters that would still fit into the last part
+	Remaining int `json:"remaining"`
+	// UnicodeCharacters are the characters that are not in GSM 7-bit alphabet and forced the switch to UCS-2
+	UnicodeCharacters []string `json:"unicode_characters"`
+}
+
+// PreviewPart is the text of the message part, its hex payload and UDH (if message is split)
+type PreviewPart struct {
+	Text string `json:"text"`
+	Hex  string `json:"hex"`
+	UDH  string `json:"udh,omitempty"`
 }
 
 const udhTemplate = "050003{{.UniqueID}}{{.Parts}}{{.Part}}"
+const udhTemplate16 = "060804{{.UniqueID}}{{.Parts}}{{.Part}}"
 
-// InitEncoder is UDHEncoder factory method
-func InitEncoder() UDHEncoder {
-	t, _ := template.New("udh").Parse(udhTemplate) // #nosec
+// MaxUDHParts is the max amount of parts the concatenated message could consist of (the amount is a single byte of UDH)
+const MaxUDHParts = 255
+
+// InitEncoder is UDHEncoder factory method. Messages are split into the provided max amount of parts (up to
+// MaxUDHParts), the rest of the message is discarded. Length of the message is counted for the provided size of the
+// reference number (automatic size is counted as 16-bit one, so the message never needs more parts when it's split)
+func InitEncoder(maxParts int, ref UDHReference) UDHEncoder {
+	if maxParts > MaxUDHParts {
+		maxParts = MaxUDHParts
+	}
+
+	t, _ := template.New("udh").Parse(udhTemplate)     // #nosec
+	t16, _ := template.New("udh").Parse(udhTemplate16) // #nosec
 
 	return &udhenc{
-		0x00,
-		map[uint32]uint8{},
 		t,
+		t16,
+		maxParts,
+		ref,
 	}
 }
 
@@ -117,17 +167,23 @@ func encodeGSMUC2(in string) []byte {
 	return buf.Bytes()
 }
 
-// by GSM documentation it can be up to 255 but MB documentation says up to 9
-const maxSplittedSMSParts = 9
-
 const nonsplittedPlainSMSLength = 160
 const splittedPlainSMSLength = 153
-const maxPlainSMSLength = splittedPlainSMSLength * maxSplittedSMSParts
+const splittedPlainSMSLength16 = 152
 
 const unicodeSymbolLengthBytes = 2
 const nonsplittedUnicodeSMSLength = 70
 const splittedUnicodeSMSLength = 67
-const maxUnicodeSMSLength = splittedUnicodeSMSLength * maxSplittedSMSParts
+const splittedUnicodeSMSLength16 = 66
+
+// splittedLengths returns the length of the split plain and unicode parts. 16-bit reference UDH takes one more byte
+func splittedLengths(ref UDHReference) (int, int) {
+	if ref == Reference16Bit {
+		return splittedPlainSMSLength16, splittedUnicodeSMSLength16
+	}
+
+	return splittedPlainSMSLength, splittedUnicodeSMSLength
+}
 
 type smsSplittingLimits struct {
 	NonsplittedSMSLength int
@@ -136,14 +192,18 @@ type smsSplittingLimits struct {
 	MaxSMSCharAmount     int
 }
 
-func getSMSSplittingLimits(e Datacoding) *smsSplittingLimits {
+func getSMSSplittingLimits(e Datacoding, maxParts int, ref UDHReference) *smsSplittingLimits {
 	var l *smsSplittingLimits
 
+	plain, unicode := splittedLengths(ref)
+	maxPlainSMSLength := plain * maxParts
+	maxUnicodeSMSLength := unicode * maxParts
+
 	switch e {
 	case Plain:
 		l = &smsSplittingLimits{
 			NonsplittedSMSLength: nonsplittedPlainSMSLength,
-			SplittedSMSLength:    splittedPlainSMSLength,
+			SplittedSMSLength:    plain,
 			MaxSMSLength:         maxPlainSMSLength,
 			MaxSMSCharAmount:     maxPlainSMSLength,
 		}
@@ -151,7 +211,7 @@ func getSMSSplittingLimits(e Datacoding) *smsSplittingLimits {
 		// multiplied by unicodeSymbolLengthBytes because some runes can
 		l = &smsSplittingLimits{
 			NonsplittedSMSLength: nonsplittedUnicodeSMSLength * unicodeSymbolLengthBytes,
-			SplittedSMSLength:    splittedUnicodeSMSLength * unicodeSymbolLengthBytes,
+			SplittedSMSLength:    unicode * unicodeSymbolLengthBytes,
 			MaxSMSLength:         maxUnicodeSMSLength * unicodeSymbolLengthBytes,
 			MaxSMSCharAmount:     maxUnicodeSMSLength,
 		}
@@ -162,8 +222,8 @@ func getSMSSplittingLimits(e Datacoding) *smsSplittingLimits {
 	return l
 }
 
-func splitBinaryMessages(enc []byte, e Datacoding) []string {
-	s := getSMSSplittingLimits(e)
+func splitBinaryMessages(enc []byte, e Datacoding, maxParts int, ref UDHReference) []string {
+	s := getSMSSplittingLimits(e, maxParts, ref)
 	l := len(enc)
 
 	// nothing to split here
@@ -215,12 +275,17 @@ func (e *udhenc) Encode(m string) *Encoded {
 		result.Encoding = Unicode
 	}
 
-	result.Messages = splitBinaryMessages(enc, result.Encoding)
+	ref := e.countedReference()
+	result.Messages = splitBinaryMessages(enc, result.Encoding, e.maxParts, ref)
+
+	if len(result.Messages) > 1 {
+		result.Reference = ref
+	}
 
 	return result
 }
 
-func splitPlainGSM7bit(m string) ([]string, error) {
+func splitPlainGSM7bit(m string, partLength int) ([]string, error) {
 	result := []string{}
 
 	sum := 0
@@ -236,7 +301,7 @@ func splitPlainGSM7bit(m string) ([]string, error) {
 
 		ls := len(s)
 
-		if ls+sum > splittedPlainSMSLength {
+		if ls+sum > partLength {
 			result = append(result, string(part))
 			part = []rune{}
 			sum = 0
@@ -248,14 +313,14 @@ func splitPlainGSM7bit(m string) ([]string, error) {
 
 	result = append(result, string(part))
 
-	if len(result) == 2 && sum+splittedPlainSMSLength <= nonsplittedPlainSMSLength {
+	if len(result) == 2 && sum+partLength <= nonsplittedPlainSMSLength {
 		return []string{m}, nil
 	}
 
 	return result, nil
 }
 
-func splitPlainGSMUC2(m string) []string {
+func splitPlainGSMUC2(m string, partLength int) []string {
 	runesM := []rune(m)
 	l := len(runesM)
 
@@ -263,14 +328,14 @@ func splitPlainGSMUC2(m string) []string {
 		return []string{m}
 	}
 
-	parts := l/splittedUnicodeSMSLength + 1
+	parts := int(math.Ceil(float64(l) / float64(partLength)))
 	result := []string{}
 
 	for i := 0; i < parts; i++ {
 		// top range
-		up := (i + 1) * splittedUnicodeSMSLength
+		up := (i + 1) * partLength
 
-		down := i * splittedUnicodeSMSLength
+		down := i * partLength
 
 		// if it's a last part let's set the top range to the message length, so no panic would be thrown
 		if up > l {
@@ -283,62 +348,171 @@ func splitPlainGSMUC2(m string) []string {
 	return result
 }
 
-// SplitTextMessage determines which encoding is used by message and splits it accordingly by the standards
-func (e *udhenc) SplitTextMessage(m string) *Encoded {
+// SplitTextMessage determines which encoding is used by message and splits it accordingly by the standards for the
+// provided size of the reference number. Parts above the provided max amount of parts are discarded. Encoder's max
+// amount is used if it's zero or bigger
+func (e *udhenc) SplitTextMessage(m string, maxParts int, ref UDHReference) *Encoded {
+	if ref != Reference8Bit && ref != Reference16Bit {
+		ref = e.countedReference()
+	}
+
+	result := e.split(m, ref)
+	max := e.limit(maxParts)
+
+	if len(result.Messages) > max {
+		result.Messages = result.Messages[:max]
+	}
+
+	return result
+}
+
+// Parts returns the amount of parts the message has to be split into to be sent as a whole
+func (e *udhenc) Parts(m string) int {
+	return len(e.split(m, e.countedReference()).Messages)
+}
+
+// countedReference is the size of the reference number the length of the message is counted for
+func (e *udhenc) countedReference() UDHReference {
+	if e.reference == Reference8Bit {
+		return Reference8Bit
+	}
+
+	return Reference16Bit
+}
+
+// MaxParts returns the max amount of parts the message is split into
+func (e *udhenc) MaxParts() int {
+	return e.maxParts
+}
+
+// limit returns the requested max amount of parts unless it's not set or exceeds the encoder's one
+func (e *udhenc) limit(maxParts int) int {
+	if maxParts <= 0 || maxParts > e.maxParts {
+		return e.maxParts
+	}
+
+	return maxParts
+}
+
+func (e *udhenc) split(m string, ref UDHReference) *Encoded {
 	result := &Encoded{
 		Encoding: Plain,
 	}
 
+	plain, unicode := splittedLengths(ref)
+
 	var err error
 
-	result.Messages, err = splitPlainGSM7bit(m)
+	result.Messages, err = splitPlainGSM7bit(m, plain)
 
 	if err == ErrUC2 {
-		result.Messages = splitPlainGSMUC2(m)
+		result.Messages = splitPlainGSMUC2(m, unicode)
 		result.Encoding = Unicode
 	}
 
-	if len(result.Messages) > maxSplittedSMSParts {
-		result.Messages = result.Messages[:maxSplittedSMSParts]
+	if len(result.Messages) > 1 {
+		result.Reference = ref
 	}
 
 	return result
 }
 
-// GenerateUDH generates UDH based on the body hash, part index and overall amount of parts.
-// If message already occurred, to make it possible to send one message to more than one recipient, the UDH is cached
-// by body hash (splitted messages still should have the same unique identifier)
-func (e *udhenc) GenerateUDH(p uint8, parts uint8, mesHash uint32) string {
-	var uniqueID uint8
-
-	if v, ok := e.udhCache[mesHash]; ok {
-		uniqueID = v
-	} else {
-		e.udhUniqueID++
-		uniqueID = e.udhUniqueID
+// GenerateUDH generates UDH of the part based on part index, overall amount of parts and the reference number of the
+// provided size. All the parts of the message should have the same reference number
+func (e *udhenc) GenerateUDH(p uint8, parts uint8, reference uint16, ref UDHReference) string {
+	t, id := e.udhTemplate, e.formatUintString(uint8(reference))
+
+	if ref == Reference16Bit {
+		t, id = e.udhTemplate16, fmt.Sprintf("%04x", reference)
 	}
 
-	data := map[string]string{
+	buf := &bytes.Buffer{}
+
+	_ = t.Execute(buf, map[string]string{
 		"Parts":    e.formatUintString(parts),
 		"Part":     e.formatUintString(p),
-		"UniqueID": e.formatUintString(uniqueID),
+		"UniqueID": id,
+	}) // #nosec
+
+	return buf.String()
+}
+
+func (e *udhenc) formatUintString(x uint8) string {
+	return fmt.Sprintf("%02x", x)
+}
+
+// Preview splits the message the same way SplitTextMessage does and describes the result. Reference number of the
+// UDH is always zero since it is allocated only when the message is sent
+func (e *udhenc) Preview(m string, maxParts int, ref UDHReference) *Preview {
+	mes := e.SplitTextMessage(m, maxParts, ref)
+	parts := len(mes.Messages)
+
+	p := &Preview{
+		Encoding:          mes.Encoding,
+		Parts:             parts,
+		Messages:          make([]*PreviewPart, 0, parts),
+		UnicodeCharacters: unicodeCharacters(m),
 	}
 
-	var udh string
+	for i, text := range mes.Messages {
+		part := &PreviewPart{Text: text}
 
-	buf := bytes.NewBufferString(udh)
+		if mes.Encoding == Unicode {
+			part.Hex = hex.EncodeToString(encodeGSMUC2(text))
+		} else {
+			enc, _ := encodeGSM7bit(text) // #nosec
+			part.Hex = hex.EncodeToString(enc)
+		}
 
-	_ = e.udhTemplate.Execute(buf, data) // #nosec
+		if parts > 1 {
+			part.UDH = e.GenerateUDH(uint8(i+1), uint8(parts), 0, mes.Reference)
+		}
 
-	if e.udhUniqueID == 0 {
-		e.udhCache = map[uint32]uint8{mesHash: uniqueID}
-	} else {
-		e.udhCache[mesHash] = uniqueID
+		p.Messages = append(p.Messages, part)
 	}
 
-	return buf.String()
+	p.Remaining = remainingCharacters(mes)
+
+	return p
 }
 
-func (e *udhenc) formatUintString(x uint8) string {
-	return fmt.Sprintf("%02x", x)
+// remainingCharacters counts how many characters would still fit into the last part of the split message
+func remainingCharacters(mes *Encoded) int {
+	last := mes.Messages[len(mes.Messages)-1]
+	split := len(mes.Messages) > 1
+	plain, unicode := splittedLengths(mes.Reference)
+
+	if mes.Encoding == Unicode {
+		if split {
+			return unicode - len([]rune(last))
+		}
+
+		return nonsplittedUnicodeSMSLength - len([]rune(last))
+	}
+
+	// symbols from the extension table take 2 septets
+	enc, _ := encodeGSM7bit(last) // #nosec
+
+	if split {
+		return plain - len(enc)
+	}
+
+	return nonsplittedPlainSMSLength - len(enc)
+}
+
+// unicodeCharacters returns the characters of the message that are not in GSM 7-bit alphabet, in order of occurrence
+func unicodeCharacters(m string) []string {
+	result := []string{}
+	seen := map[rune]bool{}
+
+	for _, r := range m {
+		if _, err := getGSM7BitEncodedSymbol(r); err == nil || seen[r] {
+			continue
+		}
+
+		seen[r] = true
+		result = append(result, string(r))
+	}
+
+	return result
 }
@@ -1,6 +1,7 @@
 package utils_test
 
 import (
+	"strings"
 	"testing"
 	"utils"
 
@@ -8,44 +9,44 @@ import (
 )
 
 func TestInitEncoder(t *testing.T) {
-	encoder := utils.InitEncoder()
+	encoder := utils.InitEncoder(9, utils.Reference8Bit)
 
 	assert.NotEmpty(t, encoder)
 }
 
 func TestUdhenc_Encode(t *testing.T) {
-	encoder := utils.InitEncoder()
+	encoder := utils.InitEncoder(9, utils.Reference8Bit)
 
 	t.Run("GSM 7-bit encode", func(t *testing.T) {
 		t.Run("encode regular symbols", func(t *testing.T) {
-			e := utils.Encoded{utils.Plain, []string{"48656c6c6f2e2049276d2066696e652c20616e6420796f753f"}}
+			e := utils.Encoded{Encoding: utils.Plain, Messages: []string{"48656c6c6f2e2049276d2066696e652c20616e6420796f753f"}}
 			m := encoder.Encode("Hello. I'm fine, and you?")
 			assert.Equal(t, e, *m)
 		})
 
 		t.Run("encode 2 space char symbols", func(t *testing.T) {
-			e := utils.Encoded{utils.Plain, []string{"1b2f1b401b281b291b3c1b3e1b3d1b651b14"}}
+			e := utils.Encoded{Encoding: utils.Plain, Messages: []string{"1b2f1b401b281b291b3c1b3e1b3d1b651b14"}}
 			m := encoder.Encode(`\|{}[]~€^`)
 			assert.Equal(t, e, *m)
 		})
 
 		t.Run("encode mixed symbols", func(t *testing.T) {
-			e := utils.Encoded{utils.Plain, []string{"4048656c6c6f21205d697d6f2e205e6265722e201315201b2873796d626f6c731b29"}}
+			e := utils.Encoded{Encoding: utils.Plain, Messages: []string{"4048656c6c6f21205d697d6f2e205e6265722e201315201b2873796d626f6c731b29"}}
 			m := encoder.Encode("¡Hello! Ñiño. Über. ΓΩ {symbols}")
 			assert.Equal(t, e, *m)
 		})
 
 		t.Run("example from MessageBird documentation", func(t *testing.T) {
-			e := utils.Encoded{utils.Plain, []string{"546865206d65737361676520746f2062652073656e74"}}
+			e := utils.Encoded{Encoding: utils.Plain, Messages: []string{"546865206d65737361676520746f2062652073656e74"}}
 			m := encoder.Encode("The message to be sent")
 			assert.Equal(t, e, *m)
 		})
 
 		t.Run("mixed symbols splitting", func(t *testing.T) {
-			e := utils.Encoded{utils.Plain, []string{
+			e := utils.Encoded{Encoding: utils.Plain, Messages: []string{
 				"546865206d65737361676520746f2062652073656e742c2074686174206e656564732073706c697474696e6720616e642068617320737472616e67652073796d626f6c73206c696b652074686f73653a201b3c1b3e1b281b291b2f2e20486f7765766572206974206e6565647320746f206265206c6f6e676572207468616e206f746865727320736f2069742077696c6c2074616b65206d6f",
 				"72652074686174203136302073796d626f6c732e2e2e",
-			}}
+			}, Reference: utils.Reference8Bit}
 
 			m := encoder.Encode(`The message to be sent, that needs splitting and has strange symbols like those: []{}\. However it needs to be longer than others so it will take more that 160 symbols...`)
 			assert.Equal(t, e, *m)
@@ -79,22 +80,22 @@ orci ac tempus. In mattis posuere.`)
 
 	t.Run("UC-2 encode", func(t *testing.T) {
 		t.Run("encode UC-2 symbols", func(t *testing.T) {
-			e := utils.Encoded{utils.Unicode, []string{"041f044004380432043504420021d83dde00"}}
+			e := utils.Encoded{Encoding: utils.Unicode, Messages: []string{"041f044004380432043504420021d83dde00"}}
 			m := encoder.Encode("Привет!😀")
 			assert.Equal(t, e, *m)
 		})
 
 		t.Run("encode only UC-2 symbols", func(t *testing.T) {
-			e := utils.Encoded{utils.Unicode, []string{"041f04400438043204350442d83dde000020041a0430043a002004340435043b0430"}}
+			e := utils.Encoded{Encoding: utils.Unicode, Messages: []string{"041f04400438043204350442d83dde000020041a0430043a002004340435043b0430"}}
 			m := encoder.Encode("Привет😀 Как дела")
 			assert.Equal(t, e, *m)
 		})
 
 		t.Run("splitted UC-2 message", func(t *testing.T) {
-			e := utils.Encoded{utils.Unicode, []string{
+			e := utils.Encoded{Encoding: utils.Unicode, Messages: []string{
 				"042d0442043e00200441043e043e043104490435043d0438043500200434043e043b0436043d043e00200438043c04350442044c00200431043e043b04350435002000370030002004410438043c0432043e043b043e0432002c00200434043b044f00200442043e0433043e002004470442043e0431044b00200431044b043b043000200432",
 				"043e0437043c043e0436043d043e04410442044c0020043f0440043e044204350441044204380440043e043204300442044c002004400430043704340435043b0435043d0438043500200441043e043e043104490435043d04380439002e",
-			}}
+			}, Reference: utils.Reference8Bit}
 
 			m := encoder.Encode("Это сообщение должно иметь более 70 символов, для того чтобы была возможность " +
 				"протестировать разделение сообщений.")
@@ -138,40 +139,40 @@ orci ac tempus. In mattis posuere.`)
 }
 
 func TestUdhenc_SplitTextMessage(t *testing.T) {
-	encoder := utils.InitEncoder()
+	encoder := utils.InitEncoder(9, utils.Reference8Bit)
 
 	t.Run("GSM 7-bit encode", func(t *testing.T) {
 		t.Run("encode regular symbols", func(t *testing.T) {
-			e := utils.Encoded{utils.Plain, []string{"Hello. I'm fine, and you?"}}
-			m := encoder.SplitTextMessage("Hello. I'm fine, and you?")
+			e := utils.Encoded{Encoding: utils.Plain, Messages: []string{"Hello. I'm fine, and you?"}}
+			m := encoder.SplitTextMessage("Hello. I'm fine, and you?", 0, utils.Reference8Bit)
 			assert.Equal(t, e, *m)
 		})
 
 		t.Run("encode 2 space char symbols", func(t *testing.T) {
-			e := utils.Encoded{utils.Plain, []string{`\|{}[]~€^`}}
-			m := encoder.SplitTextMessage(`\|{}[]~€^`)
+			e := utils.Encoded{Encoding: utils.Plain, Messages: []string{`\|{}[]~€^`}}
+			m := encoder.SplitTextMessage(`\|{}[]~€^`, 0, utils.Reference8Bit)
 			assert.Equal(t, e, *m)
 		})
 
 		t.Run("encode mixed symbols", func(t *testing.T) {
-			e := utils.Encoded{utils.Plain, []string{"¡Hello! Ñiño. Über. ΓΩ {symbols}"}}
-			m := encoder.SplitTextMessage("¡Hello! Ñiño. Über. ΓΩ {symbols}")
+			e := utils.Encoded{Encoding: utils.Plain, Messages: []string{"¡Hello! Ñiño. Über. ΓΩ {symbols}"}}
+			m := encoder.SplitTextMessage("¡Hello! Ñiño. Über. ΓΩ {symbols}", 0, utils.Reference8Bit)
 			assert.Equal(t, e, *m)
 		})
 
 		t.Run("example from MessageBird documentation", func(t *testing.T) {
-			e := utils.Encoded{utils.Plain, []string{"The message to be sent"}}
-			m := encoder.SplitTextMessage("The message to be sent")
+			e := utils.Encoded{Encoding: utils.Plain, Messages: []string{"The message to be sent"}}
+			m := encoder.SplitTextMessage("The message to be sent", 0, utils.Reference8Bit)
 			assert.Equal(t, e, *m)
 		})
 
 		t.Run("mixed symbols splitting", func(t *testing.T) {
-			e := utils.Encoded{utils.Plain, []string{
+			e := utils.Encoded{Encoding: utils.Plain, Messages: []string{
 				`The message to be sent, that needs splitting and has strange symbols like those: []{}\. However it needs to be longer than others so it will take mo`,
 				"re that 160 symbols...",
-			}}
+			}, Reference: utils.Reference8Bit}
 
-			m := encoder.SplitTextMessage(`The message to be sent, that needs splitting and has strange symbols like those: []{}\. However it needs to be longer than others so it will take more that 160 symbols...`)
+			m := encoder.SplitTextMessage(`The message to be sent, that needs splitting and has strange symbols like those: []{}\. However it needs to be longer than others so it will take more that 160 symbols...`, 0, utils.Reference8Bit)
 			assert.Equal(t, e, *m)
 		})
 
@@ -196,32 +197,32 @@ Mauris consequat laoreet leo in dignissim. Phasellus et faucibus diam. Proin et
 finibus laoreet vulputate sed ante. Vivamus blandit eros sed nisl pretium egestas. Ut ac posuere libero,
 a rutrum ligula. Pellentesque ac congue nibh.
 Etiam elementum aliquet accumsan. Donec auctor porta velit in consectetur. Pellentesque rutrum lacinia
-orci ac tempus. In mattis posuere.`)
+orci ac tempus. In mattis posuere.`, 0, utils.Reference8Bit)
 			assert.Equal(t, 9, len(m.Messages))
 		})
 	})
 
 	t.Run("UC-2 encode", func(t *testing.T) {
 		t.Run("encode UC-2 symbols", func(t *testing.T) {
-			e := utils.Encoded{utils.Unicode, []string{"Привет!😀"}}
-			m := encoder.SplitTextMessage("Привет!😀")
+			e := utils.Encoded{Encoding: utils.Unicode, Messages: []string{"Привет!😀"}}
+			m := encoder.SplitTextMessage("Привет!😀", 0, utils.Reference8Bit)
 			assert.Equal(t, e, *m)
 		})
 
 		t.Run("encode only UC-2 symbols", func(t *testing.T) {
-			e := utils.Encoded{utils.Unicode, []string{"Привет😀 Как дела"}}
-			m := encoder.SplitTextMessage("Привет😀 Как дела")
+			e := utils.Encoded{Encoding: utils.Unicode, Messages: []string{"Привет😀 Как дела"}}
+			m := encoder.SplitTextMessage("Привет😀 Как дела", 0, utils.Reference8Bit)
 			assert.Equal(t, e, *m)
 		})
 
 		t.Run("splitted UC-2 message", func(t *testing.T) {
-			e := utils.Encoded{utils.Unicode, []string{
+			e := utils.Encoded{Encoding: utils.Unicode, Messages: []string{
 				"Это сообщение должно иметь более 70 символов, для того чтобы была в",
 				"озможность протестировать разделение сообщений.",
-			}}
+			}, Reference: utils.Reference8Bit}
 
-			m := encoder.SplitTextMessage("Это сообщение должно иметь более 70 символов, для того чтобы была возможность " +
-				"протестировать разделение сообщений.")
+			m := encoder.SplitTextMessage("Это сообщение должно иметь более 70 символов, для того чтобы была возможность "+
+				"протестировать разделение сообщений.", 0, utils.Reference8Bit)
 			assert.Equal(t, e, *m)
 		})
 
@@ -255,42 +256,142 @@ orci ac tempus. In mattis posuere.`)
 				обеспечивает широкому кругу (специалистов) участие в формировании существенных финансовых и
 				административных условий. Равным образом укрепление и развитие структуры представляет собой интересный
 				эксперимент проверки новых предложений. Равным образом укрепление и развитие структуры обеспечивает
-				широкому кругу (специалистов) участие в формировании систем массового участия.`)
+				широкому кругу (специалистов) участие в формировании систем массового участия.`, 0, utils.Reference8Bit)
 			assert.Equal(t, 9, len(m.Messages))
 		})
 	})
 }
 
+func TestUdhenc_MaxParts(t *testing.T) {
+	t.Run("message is split into the provided max amount of parts", func(t *testing.T) {
+		m := strings.Repeat("a", 153*5)
+
+		assert.Len(t, utils.InitEncoder(3, utils.Reference8Bit).SplitTextMessage(m, 0, utils.Reference8Bit).Messages, 3)
+		assert.Len(t, utils.InitEncoder(3, utils.Reference8Bit).Encode(m).Messages, 3)
+		assert.Len(t, utils.InitEncoder(9, utils.Reference8Bit).SplitTextMessage(m, 0, utils.Reference8Bit).Messages, 5)
+	})
+
+	t.Run("message is split into the requested amount of parts within the encoder's one", func(t *testing.T) {
+		m := strings.Repeat("a", 153*5)
+
+		assert.Len(t, utils.InitEncoder(9, utils.Reference8Bit).SplitTextMessage(m, 2, utils.Reference8Bit).Messages, 2)
+		assert.Len(t, utils.InitEncoder(3, utils.Reference8Bit).SplitTextMessage(m, 4, utils.Reference8Bit).Messages, 3)
+		assert.Equal(t, 2, utils.InitEncoder(9, utils.Reference8Bit).Preview(m, 2, utils.Reference8Bit).Parts)
+	})
+
+	t.Run("message could be split up to 255 parts", func(t *testing.T) {
+		m := strings.Repeat("a", 153*300)
+
+		assert.Len(t, utils.InitEncoder(255, utils.Reference8Bit).SplitTextMessage(m, 0, utils.Reference8Bit).Messages, 255)
+		assert.Len(t, utils.InitEncoder(1000, utils.Reference8Bit).SplitTextMessage(m, 0, utils.Reference8Bit).Messages, 255)
+		assert.Equal(t, "0500030cffff", utils.InitEncoder(255, utils.Reference8Bit).GenerateUDH(255, 255, 12, utils.Reference8Bit))
+	})
+}
+
 func TestUdhenc_GenerateUDH(t *testing.T) {
-	e := utils.InitEncoder()
-
-	t.Run("generates unique UDH for message parts", func(t *testing.T) {
-		p := uint8(1)
-		parts := uint8(3)
-		mesHash := uint32(1)
-		udh1 := e.GenerateUDH(p, parts, mesHash)
-		p++
-		udh2 := e.GenerateUDH(p, parts, mesHash)
-		p++
-		udh3 := e.GenerateUDH(p, parts, mesHash)
-
-		assert.Equal(t, "050003010301", udh1)
-		assert.Equal(t, "050003010302", udh2)
-		assert.Equal(t, "050003010303", udh3)
+	e := utils.InitEncoder(9, utils.Reference8Bit)
+
+	t.Run("generates UDH with 8-bit reference for message parts", func(t *testing.T) {
+		assert.Equal(t, "050003010301", e.GenerateUDH(1, 3, 1, utils.Reference8Bit))
+		assert.Equal(t, "050003010302", e.GenerateUDH(2, 3, 1, utils.Reference8Bit))
+		assert.Equal(t, "050003ff0303", e.GenerateUDH(3, 3, 255, utils.Reference8Bit))
+	})
+
+	t.Run("generates UDH with 16-bit reference for message parts", func(t *testing.T) {
+		assert.Equal(t, "06080400010201", e.GenerateUDH(1, 2, 1, utils.Reference16Bit))
+		assert.Equal(t, "060804ffff0202", e.GenerateUDH(2, 2, 65535, utils.Reference16Bit))
+	})
+}
+
+func TestUdhenc_Preview(t *testing.T) {
+	e := utils.InitEncoder(9, utils.Reference8Bit)
+
+	t.Run("previews plain message that fits into one part", func(t *testing.T) {
+		assert.Equal(t, &utils.Preview{
+			Encoding:          utils.Plain,
+			Parts:             1,
+			Messages:          []*utils.PreviewPart{{Text: "Hi {you}", Hex: "4869201b28796f751b29"}},
+			Remaining:         150,
+			UnicodeCharacters: []string{},
+		}, e.Preview("Hi {you}", 0, utils.Reference8Bit))
+	})
+
+	t.Run("previews split message with UDH", func(t *testing.T) {
+		p := e.Preview(strings.Repeat("a", 160)+"bc", 0, utils.Reference8Bit)
+
+		assert.Equal(t, 2, p.Parts)
+		assert.Equal(t, strings.Repeat("a", 153), p.Messages[0].Text)
+		assert.Equal(t, "050003000201", p.Messages[0].UDH)
+		assert.Equal(t, "aaaaaaabc", p.Messages[1].Text)
+		assert.Equal(t, "616161616161616263", p.Messages[1].Hex)
+		assert.Equal(t, "050003000202", p.Messages[1].UDH)
+		assert.Equal(t, 144, p.Remaining)
+	})
+
+	t.Run("flags characters that forced UCS-2", func(t *testing.T) {
+		p := e.Preview("Price “10” – ok “", 0, utils.Reference8Bit)
+
+		assert.Equal(t, utils.Datacoding(utils.Unicode), p.Encoding)
+		assert.Equal(t, []string{"“", "”", "–"}, p.UnicodeCharacters)
+		assert.Equal(t, "005000720069", p.Messages[0].Hex[:12])
+		assert.Equal(t, 70-17, p.Remaining)
+	})
+}
+
+func TestUdhenc_Parts(t *testing.T) {
+	e := utils.InitEncoder(3, utils.Reference8Bit)
+
+	t.Run("counts all the parts the message needs", func(t *testing.T) {
+		assert.Equal(t, 1, e.Parts(strings.Repeat("a", 160)))
+		assert.Equal(t, 2, e.Parts(strings.Repeat("a", 161)))
+		assert.Equal(t, 5, e.Parts(strings.Repeat("a", 153*5)))
+		assert.Equal(t, 3, e.Parts(strings.Repeat("€", 153)))
+		assert.Equal(t, 2, e.Parts(strings.Repeat("ы", 67*2)))
+		assert.Equal(t, 3, e.MaxParts())
+	})
+
+	t.Run("unicode message of full parts has no empty part", func(t *testing.T) {
+		assert.Len(t, e.SplitTextMessage(strings.Repeat("ы", 67*2), 0, utils.Reference8Bit).Messages, 2)
+	})
+}
+
+func TestUdhenc_Reference16Bit(t *testing.T) {
+	e := utils.InitEncoder(9, utils.Reference16Bit)
+
+	t.Run("parts are one symbol shorter", func(t *testing.T) {
+		m := e.SplitTextMessage(strings.Repeat("a", 161), 0, utils.Reference16Bit)
+		assert.Equal(t, utils.Reference16Bit, m.Reference)
+		assert.Len(t, m.Messages[0], 152)
+
+		m = e.SplitTextMessage(strings.Repeat("ы", 71), 0, utils.Reference16Bit)
+		assert.Len(t, []rune(m.Messages[0]), 66)
+
+		assert.Equal(t, 3, e.Parts(strings.Repeat("a", 153*2)))
+	})
+
+	t.Run("not split message isn't referenced", func(t *testing.T) {
+		assert.Equal(t, utils.UDHReference(""), e.SplitTextMessage(strings.Repeat("a", 160), 0, utils.Reference16Bit).Reference)
+	})
+
+	t.Run("previews UDH with 16-bit reference", func(t *testing.T) {
+		assert.Equal(t, "06080400000202", e.Preview(strings.Repeat("a", 161), 0, utils.Reference16Bit).Messages[1].UDH)
+	})
+}
+
+func TestUdhenc_ReferenceAuto(t *testing.T) {
+	e := utils.InitEncoder(9, utils.ReferenceAuto)
+	m := strings.Repeat("a", 153*2)
+
+	t.Run("parts are counted for 16-bit reference", func(t *testing.T) {
+		assert.Equal(t, 3, e.Parts(m))
+	})
+
+	t.Run("message is split for the resolved reference", func(t *testing.T) {
+		assert.Len(t, e.SplitTextMessage(m, 0, utils.Reference8Bit).Messages, 2)
+		assert.Len(t, e.SplitTextMessage(m, 0, utils.Reference16Bit).Messages, 3)
 	})
 
-	t.Run("same hash should have same UDH next time", func(t *testing.T) {
-		p := uint8(1)
-		parts := uint8(3)
-		mesHash := uint32(1)
-		udh1 := e.GenerateUDH(p, parts, mesHash)
-		p++
-		udh2 := e.GenerateUDH(p, parts, mesHash)
-		p++
-		udh3 := e.GenerateUDH(p, parts, mesHash)
-
-		assert.Equal(t, "050003010301", udh1)
-		assert.Equal(t, "050003010302", udh2)
-		assert.Equal(t, "050003010303", udh3)
+	t.Run("message is split for 16-bit reference if it's not resolved", func(t *testing.T) {
+		assert.Len(t, e.SplitTextMessage(m, 0, utils.ReferenceAuto).Messages, 3)
 	})
 }
@@ -0,0 +1,207 @@
+package utils
+
+import (
+	"sync"
+	"time"
+)
+
+// ReferenceAllocator allocates the reference numbers of the split messages. Numbers are scoped by recipient: the
+// recipient never gets the same number for the different messages while the handset could still wait for their parts
+type ReferenceAllocator interface {
+	Reference(recipients []int64) UDHReference
+	Allocate(recipients []int64, hash uint32, ref UDHReference) uint16
+}
+
+type referenceAllocator struct {
+	Mutex  *sync.Mutex
+	Size   UDHReference
+	TTL    time.Duration
+	Clock  Clock
+	Spaces map[UDHReference]*referenceSpace
+}
+
+// referenceUsage is the reference number used for the content sent to the recipient
+type referenceUsage struct {
+	Recipient int64
+	Hash      uint32
+	Value     uint16
+	UsedAt    time.Time
+}
+
+// referenceSpace keeps the used numbers of one size
+type referenceSpace struct {
+	Size int
+	Next int
+	// Used are the numbers used by every recipient
+	Used map[int64]map[uint16]*referenceUsage
+	// Hashes are the numbers used for the content by every recipient, so the same content sent to the different
+	// recipients gets the same number (if it's free) and could be sent together
+	Hashes map[uint32]map[int64]*referenceUsage
+	// Expiry is the usages in order they were made
+	Expiry []*referenceUsage
+}
+
+// InitReferenceAllocator is ReferenceAllocator factory method. Numbers of the provided size are allocated and kept
+// used for the TTL (reassembly window of the handset). Automatic size is 8-bit one unless any of the recipients has no
+// free 8-bit numbers
+func InitReferenceAllocator(ref UDHReference, ttl time.Duration, c Clock) ReferenceAllocator {
+	return &referenceAllocator{
+		&sync.Mutex{},
+		ref,
+		ttl,
+		c,
+		map[UDHReference]*referenceSpace{
+			Reference8Bit:  initReferenceSpace(1 << 8),
+			Reference16Bit: initReferenceSpace(1 << 16),
+		},
+	}
+}
+
+func initReferenceSpace(size int) *referenceSpace {
+	// numbering starts from 1
+	return &referenceSpace{size, 1, map[int64]map[uint16]*referenceUsage{}, map[uint32]map[int64]*referenceUsage{}, nil}
+}
+
+// Reference resolves the size of the reference number the message to the recipients should be referenced with
+func (a *referenceAllocator) Reference(recipients []int64) UDHReference {
+	if a.Size == Reference8Bit || a.Size == Reference16Bit {
+		return a.Size
+	}
+
+	a.Mutex.Lock()
+	defer a.Mutex.Unlock()
+
+	s := a.Spaces[Reference8Bit]
+	s.evict(a.Clock.Now().Add(-a.TTL))
+
+	for _, r := range recipients {
+		if len(s.Used[r]) >= s.Size {
+			return Reference16Bit
+		}
+	}
+
+	return Reference8Bit
+}
+
+// Allocate returns the reference number of the provided size for the content sent to the recipients. Number that is
+// used by any of the recipients for the other content is never returned unless all the numbers are used
+func (a *referenceAllocator) Allocate(recipients []int64, hash uint32, ref UDHReference) uint16 {
+	a.Mutex.Lock()
+	defer a.Mutex.Unlock()
+
+	now := a.Clock.Now()
+
+	s, ok := a.Spaces[ref]
+
+	if !ok {
+		s = a.Spaces[Reference8Bit]
+	}
+
+	s.evict(now.Add(-a.TTL))
+
+	v := s.find(recipients, hash)
+
+	for _, r := range recipients {
+		u := &referenceUsage{r, hash, v, now}
+
+		if s.Used[r] == nil {
+			s.Used[r] = map[uint16]*referenceUsage{}
+		}
+
+		if s.Hashes[hash] == nil {
+			s.Hashes[hash] = map[int64]*referenceUsage{}
+		}
+
+		s.Used[r][v] = u
+		s.Hashes[hash][r] = u
+		s.Expiry = append(s.Expiry, u)
+	}
+
+	return v
+}
+
+// find returns the number the content was sent with if it's free for all the recipients (the most recently used one
+// is preferred) or the next free one
+func (s *referenceSpace) find(recipients []int64, hash uint32) uint16 {
+	// content could be sent with the different numbers to the different recipients
+	latest := map[uint16]time.Time{}
+
+	for _, u := range s.Hashes[hash] {
+		if at, ok := latest[u.Value]; !ok || u.UsedAt.After(at) {
+			latest[u.Value] = u.UsedAt
+		}
+	}
+
+	found := false
+	var v uint16
+
+	for c, at := range latest {
+		if found && (at.Before(latest[v]) || at.Equal(latest[v]) && c > v) {
+			continue
+		}
+
+		if s.isFree(recipients, c, hash) {
+			found = true
+			v = c
+		}
+	}
+
+	if found {
+		return v
+	}
+
+	first := uint16(s.Next)
+
+	for i := 0; i < s.Size; i++ {
+		v := uint16(s.Next)
+		s.Next = (s.Next + 1) % s.Size
+
+		if s.isFree(recipients, v, hash) {
+			return v
+		}
+	}
+
+	// all the numbers are used, so one of them is reused anyway
+	return first
+}
+
+// isFree checks if none of the recipients uses the number for the other content
+func (s *referenceSpace) isFree(recipients []int64, v uint16, hash uint32) bool {
+	for _, r := range recipients {
+		if u, ok := s.Used[r][v]; ok && u.Hash != hash {
+			return false
+		}
+	}
+
+	return true
+}
+
+// evict releases the numbers used before the provided time
+func (s *referenceSpace) evict(before time.Time) {
+	i := 0
+
+	for ; i < len(s.Expiry) && !s.Expiry[i].UsedAt.After(before); i++ {
+		u := s.Expiry[i]
+
+		// number could be used again after this usage
+		if s.Used[u.Recipient][u.Value] == u {
+			delete(s.Used[u.Recipient], u.Value)
+
+			if len(s.Used[u.Recipient]) == 0 {
+				delete(s.Used, u.Recipient)
+			}
+		}
+
+		if s.Hashes[u.Hash][u.Recipient] == u {
+			delete(s.Hashes[u.Hash], u.Recipient)
+
+			if len(s.Hashes[u.Hash]) == 0 {
+				delete(s.Hashes, u.Hash)
+			}
+		}
+
+		s.Expiry[i] = nil
+	}
+
+	s.Expiry = s.Expiry[i:]
+}
@@ -0,0 +1,154 @@
+package utils_test
+
+import (
+	"mocks"
+	"sync"
+	"testing"
+	"time"
+	"utils"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReferenceAllocator_Allocate(t *testing.T) {
+	c := mocks.NewClockMock(time.Date(2017, 11, 5, 10, 0, 0, 0, time.UTC))
+	a := utils.InitReferenceAllocator(utils.Reference8Bit, time.Hour, c)
+
+	t.Run("different content gets different numbers", func(t *testing.T) {
+		assert.Equal(t, uint16(1), a.Allocate([]int64{1}, 100, utils.Reference8Bit))
+		assert.Equal(t, uint16(2), a.Allocate([]int64{1}, 200, utils.Reference8Bit))
+	})
+
+	t.Run("same content gets the same number", func(t *testing.T) {
+		assert.Equal(t, uint16(1), a.Allocate([]int64{1}, 100, utils.Reference8Bit))
+		assert.Equal(t, uint16(1), a.Allocate([]int64{2, 3}, 100, utils.Reference8Bit))
+	})
+
+	t.Run("sizes are allocated independently", func(t *testing.T) {
+		assert.Equal(t, uint16(1), a.Allocate([]int64{1}, 200, utils.Reference16Bit))
+	})
+
+	t.Run("content is forgotten after the TTL", func(t *testing.T) {
+		c.Advance(time.Hour)
+
+		assert.Equal(t, uint16(3), a.Allocate([]int64{1}, 100, utils.Reference8Bit))
+	})
+
+	t.Run("content keeps the numbers of all the recipients it was sent to", func(t *testing.T) {
+		a := utils.InitReferenceAllocator(utils.Reference8Bit, time.Hour, c)
+
+		assert.Equal(t, uint16(1), a.Allocate([]int64{1}, 100, utils.Reference8Bit))
+
+		// recipient 9 uses all the numbers but 0 and 1
+		for i := 0; i < 254; i++ {
+			a.Allocate([]int64{9}, uint32(1000+i), utils.Reference8Bit)
+		}
+
+		// number 1 of the content isn't free for recipient 2, so the content is sent to it with number 2
+		assert.Equal(t, uint16(0), a.Allocate([]int64{2}, 200, utils.Reference8Bit))
+		assert.Equal(t, uint16(1), a.Allocate([]int64{2}, 300, utils.Reference8Bit))
+		assert.Equal(t, uint16(2), a.Allocate([]int64{2}, 100, utils.Reference8Bit))
+
+		// the latest number 2 is used by recipient 9, but the one of recipient 1 is free
+		assert.Equal(t, uint16(1), a.Allocate([]int64{9}, 100, utils.Reference8Bit))
+	})
+
+	t.Run("numbers used by the recipient are skipped till the TTL", func(t *testing.T) {
+		a := utils.InitReferenceAllocator(utils.Reference8Bit, time.Hour, c)
+
+		for i := 0; i < 254; i++ {
+			a.Allocate([]int64{1}, uint32(1000+i), utils.Reference8Bit)
+		}
+
+		assert.Equal(t, uint16(255), a.Allocate([]int64{1}, 2000, utils.Reference8Bit))
+		assert.Equal(t, uint16(0), a.Allocate([]int64{2}, 2001, utils.Reference8Bit))
+		assert.Equal(t, uint16(0), a.Allocate([]int64{1}, 2002, utils.Reference8Bit))
+
+		c.Advance(time.Hour)
+
+		assert.Equal(t, uint16(1), a.Allocate([]int64{1}, 2003, utils.Reference8Bit))
+	})
+}
+
+func TestReferenceAllocator_Reference(t *testing.T) {
+	c := mocks.NewClockMock(time.Date(2017, 11, 5, 10, 0, 0, 0, time.UTC))
+
+	t.Run("configured size is used", func(t *testing.T) {
+		assert.Equal(t, utils.Reference8Bit, utils.InitReferenceAllocator(utils.Reference8Bit, time.Hour, c).Reference([]int64{1}))
+		assert.Equal(t, utils.Reference16Bit, utils.InitReferenceAllocator(utils.Reference16Bit, time.Hour, c).Reference([]int64{1}))
+	})
+
+	t.Run("automatic size", func(t *testing.T) {
+		a := utils.InitReferenceAllocator(utils.ReferenceAuto, time.Hour, c)
+
+		for i := 0; i < 255; i++ {
+			a.Allocate([]int64{1}, uint32(i), utils.Reference8Bit)
+		}
+
+		t.Run("is 8-bit while the recipient has free 8-bit numbers", func(t *testing.T) {
+			assert.Equal(t, utils.Reference8Bit, a.Reference([]int64{1, 2}))
+		})
+
+		t.Run("is 16-bit when 8-bit numbers of any recipient would wrap", func(t *testing.T) {
+			a.Allocate([]int64{1}, 255, utils.Reference8Bit)
+
+			assert.Equal(t, utils.Reference16Bit, a.Reference([]int64{1, 2}))
+			assert.Equal(t, utils.Reference8Bit, a.Reference([]int64{2}))
+		})
+
+		t.Run("is 8-bit again after the reassembly window", func(t *testing.T) {
+			c.Advance(time.Hour)
+
+			assert.Equal(t, utils.Reference8Bit, a.Reference([]int64{1, 2}))
+		})
+	})
+}
+
+func TestReferenceAllocator_Concurrency(t *testing.T) {
+	a := utils.InitReferenceAllocator(utils.ReferenceAuto, time.Hour, utils.InitClock())
+
+	type usage struct {
+		recipient int64
+		value     uint16
+	}
+
+	var mutex sync.Mutex
+	used := map[usage]uint32{}
+	collisions := 0
+
+	var wg sync.WaitGroup
+
+	for g := 0; g < 100; g++ {
+		wg.Add(1)
+
+		go func(g int) {
+			defer wg.Done()
+
+			for i := 0; i < 200; i++ {
+				recipients := []int64{int64(g % 10), int64(i % 10)}
+				hash := uint32(g*1000 + i%50)
+
+				ref := a.Reference(recipients)
+				v := a.Allocate(recipients, hash, utils.Reference16Bit)
+
+				mutex.Lock()
+
+				for _, r := range recipients {
+					if h, ok := used[usage{r, v}]; ok && h != hash {
+						collisions++
+					}
+
+					used[usage{r, v}] = hash
+				}
+
+				mutex.Unlock()
+
+				assert.Equal(t, utils.Reference8Bit, ref)
+			}
+		}(g)
+	}
+
+	wg.Wait()
+
+	assert.Equal(t, 0, collisions)
+}
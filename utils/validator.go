@@ -2,9 +2,11 @@ package utils
 
 import (
 	"config"
+	"reflect"
 	"regexp"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/go-playground/locales/en"
 	ut "github.com/go-playground/universal-translator"
@@ -42,6 +44,136 @@ func textoriginatorValidator(fl validator.FieldLevel) bool {
 	return textoriginatorRegex.MatchString(v.String())
 }
 
+// scheduledValidator checks if time is in the future but not further than the scheduling horizon
+func scheduledValidator(horizon time.Duration, c Clock) validator.Func {
+	return func(fl validator.FieldLevel) bool {
+		t, ok := fl.Field().Interface().(time.Time)
+
+		if !ok {
+			return false
+		}
+
+		now := c.Now()
+
+		return t.After(now) && !t.After(now.Add(horizon))
+	}
+}
+
+// maxpartsValidator checks if the text doesn't need more parts than it could be split into. Params are the names of
+// the int field with the requested max amount of parts (encoder's one is used if it's zero) and of the bool field that
+// allows the truncation (any text is accepted then)
+func maxpartsValidator(enc UDHEncoder) validator.Func {
+	return func(fl validator.FieldLevel) bool {
+		v := fl.Field()
+
+		if v.Kind() != reflect.String {
+			return false
+		}
+
+		max := enc.MaxParts()
+		parent := reflect.Indirect(fl.Parent())
+
+		for _, name := range strings.Fields(fl.Param()) {
+			f := parent.FieldByName(name)
+
+			switch {
+			case !f.IsValid():
+				continue
+			case f.Kind() == reflect.Bool && f.Bool():
+				return true
+			case f.Kind() == reflect.Int && f.Int() > 0 && int(f.Int()) < max:
+				max = int(f.Int())
+			}
+		}
+
+		return enc.Parts(v.String()) <= max
+	}
+}
+
+// partslimitValidator checks if the requested max amount of parts is within the encoder's one
+func partslimitValidator(enc UDHEncoder) validator.Func {
+	return func(fl validator.FieldLevel) bool {
+		v := fl.Field()
+
+		return v.Kind() == reflect.Int && v.Int() >= 1 && v.Int() <= int64(enc.MaxParts())
+	}
+}
+
+// maxrecipientsValidator checks if the list of recipients isn't longer than the provided limit
+func maxrecipientsValidator(max int) validator.Func {
+	return func(fl validator.FieldLevel) bool {
+		v := fl.Field()
+
+		return v.Kind() == reflect.Slice && v.Len() <= max
+	}
+}
+
+// oneofValidator checks if the text is one of the space separated values provided as a param
+func oneofValidator(fl validator.FieldLevel) bool {
+	v := fl.Field()
+
+	if v.Kind() != reflect.String {
+		return false
+	}
+
+	for _, o := range strings.Fields(fl.Param()) {
+		if v.String() == o {
+			return true
+		}
+	}
+
+	return false
+}
+
+// approvedoriginatorValidator checks if originator is approved for the API client which name is kept within the field
+// provided as a param. Any originator is accepted if there is no registry
+func approvedoriginatorValidator(reg OriginatorRegistry) validator.Func {
+	return func(fl validator.FieldLevel) bool {
+		if reg == nil {
+			return true
+		}
+
+		if fl.Field().Kind() != reflect.String {
+			return false
+		}
+
+		var client string
+
+		if c := reflect.Indirect(fl.Parent()).FieldByName(fl.Param()); fl.Param() != "" && c.IsValid() && c.Kind() == reflect.String {
+			client = c.String()
+		}
+
+		return reg.IsApproved(fl.Field().String(), client)
+	}
+}
+
+// requiredwithoutValidator checks if field has a value in case if the field provided as a param doesn't have one
+func requiredwithoutValidator(fl validator.FieldLevel) bool {
+	if hasValue(fl.Field()) {
+		return true
+	}
+
+	other := reflect.Indirect(fl.Parent()).FieldByName(fl.Param())
+
+	if !other.IsValid() {
+		return false
+	}
+
+	return hasValue(other)
+}
+
+// hasValue checks if value is not zero (empty collections are considered as not having a value)
+func hasValue(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Slice, reflect.Map, reflect.Array, reflect.String:
+		return v.Len() > 0
+	case reflect.Ptr, reflect.Interface:
+		return !v.IsNil()
+	default:
+		return v.IsValid() && v.Interface() != reflect.Zero(v.Type()).Interface()
+	}
+}
+
 // CustomValidator is interface for validator that matches echo.Validator
 type CustomValidator interface {
 	Validate(i interface{}) error
@@ -76,6 +208,23 @@ func HumaniseValidationErrors(err error) map[string]string {
 	return e
 }
 
+// ValidationErrorTags returns validation tags of all the failed fields
+func ValidationErrorTags(err error) []string {
+	errs, ok := err.(validator.ValidationErrors)
+
+	if !ok {
+		return nil
+	}
+
+	tags := make([]string, len(errs))
+
+	for i, val := range errs {
+		tags[i] = val.Tag()
+	}
+
+	return tags
+}
+
 // RegisterCustomTranslations which would be readable for end-users
 func (v *cValidator) RegisterCustomTranslations() {
 	for key, text := range config.ValidationMessages {
@@ -93,8 +242,41 @@ func (v *cValidator) registerTranslation(tag string, text string) {
 	})
 }
 
-// InitValidator is the CustomValidator factory method
-func InitValidator() CustomValidator {
+// registerPartsTranslations replaces the messages about the parts and recipients with the ones that contain the
+// amounts of them
+func (v *cValidator) registerPartsTranslations(enc UDHEncoder, maxRecipients int) {
+	v.registerParamsTranslation("maxparts", func(fe validator.FieldError) []string {
+		s, _ := fe.Value().(string)
+		return []string{strconv.Itoa(enc.Parts(s))}
+	})
+
+	v.registerParamsTranslation("partslimit", func(validator.FieldError) []string {
+		return []string{strconv.Itoa(enc.MaxParts())}
+	})
+
+	v.registerParamsTranslation("maxrecipients", func(validator.FieldError) []string {
+		return []string{strconv.Itoa(maxRecipients)}
+	})
+
+	v.registerParamsTranslation("oneof", func(fe validator.FieldError) []string {
+		return []string{strings.Join(strings.Fields(fe.Param()), ", ")}
+	})
+}
+
+func (v *cValidator) registerParamsTranslation(tag string, params func(fe validator.FieldError) []string) {
+	v.validator.RegisterTranslation(tag, v.trans, func(ut ut.Translator) error {
+		return ut.Add(tag, config.ValidationMessages[tag], true)
+	}, func(ut ut.Translator, fe validator.FieldError) string {
+		t, _ := ut.T(tag, params(fe)...)
+
+		return t
+	})
+}
+
+// InitValidator is the CustomValidator factory method. Messages are limited to the amount of parts the encoder splits
+// them into and to the provided amount of recipients, could be scheduled not further than the provided horizon from
+// the clock's time and sent only from the originators of the registry (if any)
+func InitValidator(enc UDHEncoder, horizon time.Duration, reg OriginatorRegistry, maxRecipients int, c Clock) CustomValidator {
 	en := en.New()
 	uni := ut.New(en, en)
 
@@ -103,9 +285,17 @@ func InitValidator() CustomValidator {
 	v := validator.New()
 	v.RegisterValidation("msisdn", msisdnValidator)
 	v.RegisterValidation("textoriginator", textoriginatorValidator)
+	v.RegisterValidation("requiredwithout", requiredwithoutValidator)
+	v.RegisterValidation("scheduled", scheduledValidator(horizon, c))
+	v.RegisterValidation("maxparts", maxpartsValidator(enc))
+	v.RegisterValidation("partslimit", partslimitValidator(enc))
+	v.RegisterValidation("maxrecipients", maxrecipientsValidator(maxRecipients))
+	v.RegisterValidation("oneof", oneofValidator)
+	v.RegisterValidation("approvedoriginator", approvedoriginatorValidator(reg))
 
 	val := &cValidator{v, trans}
 	val.RegisterCustomTranslations()
+	val.registerPartsTranslations(enc, maxRecipients)
 
 	return val
 }
@@ -2,12 +2,19 @@ package utils_test
 
 import (
 	"github.com/stretchr/testify/assert"
+	"mocks"
+	"strings"
 	"testing"
+	"time"
 	"utils"
 )
 
+const maxParts = 2
+const horizon = 24 * time.Hour
+const maxRecipients = 3
+
 func TestInitValidator(t *testing.T) {
-	v := utils.InitValidator()
+	v := utils.InitValidator(utils.InitEncoder(maxParts, utils.Reference8Bit), horizon, nil, maxRecipients, utils.InitClock())
 	t.Run("validator should not be empty", func(t *testing.T) {
 		assert.NotEmpty(t, v)
 	})
@@ -22,19 +29,19 @@ func TestCValidator_Validate(t *testing.T) {
 			}
 
 			t.Run("less symbols", func(t *testing.T) {
-				v := utils.InitValidator()
+				v := utils.InitValidator(utils.InitEncoder(maxParts, utils.Reference8Bit), horizon, nil, maxRecipients, utils.InitClock())
 				err := v.Validate(&vStruct{12345, "12345"})
 				assert.NotNil(t, err)
 			})
 
 			t.Run("more symbols", func(t *testing.T) {
-				v := utils.InitValidator()
+				v := utils.InitValidator(utils.InitEncoder(maxParts, utils.Reference8Bit), horizon, nil, maxRecipients, utils.InitClock())
 				err := v.Validate(&vStruct{1234567890123456, "1234567890123456"})
 				assert.NotNil(t, err)
 			})
 
 			t.Run("right amount of symbols", func(t *testing.T) {
-				v := utils.InitValidator()
+				v := utils.InitValidator(utils.InitEncoder(maxParts, utils.Reference8Bit), horizon, nil, maxRecipients, utils.InitClock())
 				err := v.Validate(&vStruct{33617129674, "33617129674"})
 				assert.Nil(t, err)
 			})
@@ -45,14 +52,14 @@ func TestCValidator_Validate(t *testing.T) {
 				A string `validate:"msisdn"`
 			}
 
-			v := utils.InitValidator()
+			v := utils.InitValidator(utils.InitEncoder(maxParts, utils.Reference8Bit), horizon, nil, maxRecipients, utils.InitClock())
 			err := v.Validate(&vStruct{"02345678901234"})
 			assert.NotNil(t, err)
 		})
 	})
 
 	t.Run("should validate textoriginator", func(t *testing.T) {
-		v := utils.InitValidator()
+		v := utils.InitValidator(utils.InitEncoder(maxParts, utils.Reference8Bit), horizon, nil, maxRecipients, utils.InitClock())
 
 		type vStruct struct {
 			A string `validate:"textoriginator"`
@@ -86,7 +93,7 @@ func TestCValidator_Validate(t *testing.T) {
 	})
 
 	t.Run("msisdn|textoriginator", func(t *testing.T) {
-		v := utils.InitValidator()
+		v := utils.InitValidator(utils.InitEncoder(maxParts, utils.Reference8Bit), horizon, nil, maxRecipients, utils.InitClock())
 
 		type vStruct struct {
 			A string `validate:"textoriginator|msisdn"`
@@ -112,11 +119,176 @@ func TestCValidator_Validate(t *testing.T) {
 			assert.NotNil(t, v.Validate(vStruct{"033123123121"}))
 		})
 	})
+
+	t.Run("maxrecipients", func(t *testing.T) {
+		v := utils.InitValidator(utils.InitEncoder(maxParts, utils.Reference8Bit), horizon, nil, maxRecipients, utils.InitClock())
+
+		type vStruct struct {
+			A []int64 `validate:"maxrecipients"`
+		}
+
+		t.Run("valid up to the limit", func(t *testing.T) {
+			assert.Nil(t, v.Validate(vStruct{[]int64{1, 2, 3}}))
+		})
+
+		t.Run("not valid beyond the limit", func(t *testing.T) {
+			assert.NotNil(t, v.Validate(vStruct{[]int64{1, 2, 3, 4}}))
+		})
+	})
+
+	t.Run("scheduled", func(t *testing.T) {
+		now := time.Date(2017, 1, 1, 0, 0, 0, 0, time.UTC)
+		v := utils.InitValidator(utils.InitEncoder(maxParts, utils.Reference8Bit), horizon, nil, maxRecipients, mocks.NewClockMock(now))
+
+		type vStruct struct {
+			A time.Time `validate:"scheduled"`
+		}
+
+		t.Run("valid in the future", func(t *testing.T) {
+			assert.Nil(t, v.Validate(vStruct{now.Add(time.Minute)}))
+		})
+
+		t.Run("not valid in the past", func(t *testing.T) {
+			assert.NotNil(t, v.Validate(vStruct{now.Add(-time.Minute)}))
+		})
+
+		t.Run("not valid beyond the horizon", func(t *testing.T) {
+			assert.NotNil(t, v.Validate(vStruct{now.Add(horizon + time.Minute)}))
+		})
+
+		t.Run("checked against the provided clock", func(t *testing.T) {
+			assert.NotNil(t, v.Validate(vStruct{time.Now().Add(time.Minute)}))
+		})
+	})
+
+	t.Run("maxparts", func(t *testing.T) {
+		v := utils.InitValidator(utils.InitEncoder(maxParts, utils.Reference8Bit), horizon, nil, maxRecipients, utils.InitClock())
+
+		type vStruct struct {
+			A string `validate:"maxparts=C B"`
+			B bool
+			C int
+		}
+
+		t.Run("valid up to the max amount of parts", func(t *testing.T) {
+			assert.Nil(t, v.Validate(vStruct{A: strings.Repeat("a", 153*2)}))
+			assert.Nil(t, v.Validate(vStruct{A: strings.Repeat("ы", 67*2)}))
+		})
+
+		t.Run("not valid if more parts are needed", func(t *testing.T) {
+			err := v.Validate(vStruct{A: strings.Repeat("a", 153*4+1)})
+
+			assert.Equal(t, map[string]string{"a": "needs 5 parts which is more than allowed"}, utils.HumaniseValidationErrors(err))
+		})
+
+		t.Run("unicode and extension table characters take more space", func(t *testing.T) {
+			assert.NotNil(t, v.Validate(vStruct{A: strings.Repeat("{", 153)}))
+			assert.NotNil(t, v.Validate(vStruct{A: strings.Repeat("a", 153) + strings.Repeat("ы", 60)}))
+		})
+
+		t.Run("not valid if more parts are needed than requested", func(t *testing.T) {
+			assert.NotNil(t, v.Validate(vStruct{A: strings.Repeat("a", 161), C: 1}))
+		})
+
+		t.Run("requested amount doesn't raise the limit", func(t *testing.T) {
+			assert.NotNil(t, v.Validate(vStruct{A: strings.Repeat("a", 153*3), C: 3}))
+		})
+
+		t.Run("valid if truncation is allowed", func(t *testing.T) {
+			assert.Nil(t, v.Validate(vStruct{A: strings.Repeat("a", 153*4+1), B: true}))
+		})
+	})
+
+	t.Run("partslimit", func(t *testing.T) {
+		v := utils.InitValidator(utils.InitEncoder(maxParts, utils.Reference8Bit), horizon, nil, maxRecipients, utils.InitClock())
+
+		type vStruct struct {
+			A int `validate:"partslimit"`
+		}
+
+		t.Run("valid up to the encoder's max amount of parts", func(t *testing.T) {
+			assert.Nil(t, v.Validate(vStruct{1}))
+			assert.Nil(t, v.Validate(vStruct{maxParts}))
+		})
+
+		t.Run("not valid otherwise", func(t *testing.T) {
+			assert.Equal(t, map[string]string{"a": "should be between 1 and 2"}, utils.HumaniseValidationErrors(v.Validate(vStruct{maxParts + 1})))
+			assert.NotNil(t, v.Validate(vStruct{0}))
+		})
+	})
+
+	t.Run("oneof", func(t *testing.T) {
+		v := utils.InitValidator(utils.InitEncoder(maxParts, utils.Reference8Bit), horizon, nil, maxRecipients, utils.InitClock())
+
+		type vStruct struct {
+			A string `validate:"oneof=otp bulk"`
+		}
+
+		t.Run("valid if value is listed", func(t *testing.T) {
+			assert.Nil(t, v.Validate(vStruct{"otp"}))
+			assert.Nil(t, v.Validate(vStruct{"bulk"}))
+		})
+
+		t.Run("not valid otherwise", func(t *testing.T) {
+			assert.Equal(t, map[string]string{"a": "should be one of otp, bulk"}, utils.HumaniseValidationErrors(v.Validate(vStruct{"urgent"})))
+			assert.NotNil(t, v.Validate(vStruct{""}))
+		})
+	})
+
+	t.Run("requiredwithout", func(t *testing.T) {
+		v := utils.InitValidator(utils.InitEncoder(maxParts, utils.Reference8Bit), horizon, nil, maxRecipients, utils.InitClock())
+
+		type vStruct struct {
+			A int64   `validate:"requiredwithout=B"`
+			B []int64 `validate:"requiredwithout=A"`
+		}
+
+		t.Run("valid if first field has a value", func(t *testing.T) {
+			assert.Nil(t, v.Validate(vStruct{A: 1}))
+		})
+
+		t.Run("valid if second field has a value", func(t *testing.T) {
+			assert.Nil(t, v.Validate(vStruct{B: []int64{1}}))
+		})
+
+		t.Run("not valid if both fields are empty", func(t *testing.T) {
+			assert.NotNil(t, v.Validate(vStruct{B: []int64{}}))
+		})
+	})
+
+	t.Run("approvedoriginator", func(t *testing.T) {
+		type vStruct struct {
+			A      string `validate:"approvedoriginator=Client"`
+			Client string
+		}
+
+		t.Run("any originator is valid without registry", func(t *testing.T) {
+			v := utils.InitValidator(utils.InitEncoder(maxParts, utils.Reference8Bit), horizon, nil, maxRecipients, utils.InitClock())
+			assert.Nil(t, v.Validate(vStruct{A: "Bank"}))
+		})
+
+		reg, _ := utils.InitOriginatorRegistry("")
+		reg.Approve(&utils.ApprovedOriginator{Originator: "Shop", Clients: []string{"shop"}})
+		v := utils.InitValidator(utils.InitEncoder(maxParts, utils.Reference8Bit), horizon, reg, maxRecipients, utils.InitClock())
+
+		t.Run("valid if originator is approved for the client", func(t *testing.T) {
+			assert.Nil(t, v.Validate(vStruct{"Shop", "shop"}))
+		})
+
+		t.Run("not valid for other client", func(t *testing.T) {
+			assert.NotNil(t, v.Validate(vStruct{"Shop", "bank"}))
+		})
+
+		t.Run("not valid if originator is not approved", func(t *testing.T) {
+			err := utils.HumaniseValidationErrors(v.Validate(vStruct{"Bank", "shop"}))
+			assert.Equal(t, map[string]string{"a": "should be an originator approved for the API key"}, err)
+		})
+	})
 }
 
 func TestHumaniseValidationErrors(t *testing.T) {
 	t.Run("msisdn error", func(t *testing.T) {
-		v := utils.InitValidator()
+		v := utils.InitValidator(utils.InitEncoder(maxParts, utils.Reference8Bit), horizon, nil, maxRecipients, utils.InitClock())
 
 		type vStruct struct {
 			A string `validate:"msisdn"`
@@ -127,8 +299,33 @@ func TestHumaniseValidationErrors(t *testing.T) {
 		assert.Equal(t, err, map[string]string{"a": "should be a valid MSISDN"})
 	})
 
+	t.Run("requiredwithout error", func(t *testing.T) {
+		v := utils.InitValidator(utils.InitEncoder(maxParts, utils.Reference8Bit), horizon, nil, maxRecipients, utils.InitClock())
+
+		type vStruct struct {
+			A int64 `validate:"requiredwithout=B"`
+			B int64
+		}
+
+		err := utils.HumaniseValidationErrors(v.Validate(vStruct{}))
+
+		assert.Equal(t, err, map[string]string{"a": "either recipient or recipients must have a value"})
+	})
+
+	t.Run("msisdn error for every invalid item of the list", func(t *testing.T) {
+		v := utils.InitValidator(utils.InitEncoder(maxParts, utils.Reference8Bit), horizon, nil, maxRecipients, utils.InitClock())
+
+		type vStruct struct {
+			A []int64 `validate:"dive,msisdn"`
+		}
+
+		err := utils.HumaniseValidationErrors(v.Validate(vStruct{[]int64{0, 33123123123, 1}}))
+
+		assert.Equal(t, err, map[string]string{"a[0]": "should be a valid MSISDN", "a[2]": "should be a valid MSISDN"})
+	})
+
 	t.Run("textoriginator error", func(t *testing.T) {
-		v := utils.InitValidator()
+		v := utils.InitValidator(utils.InitEncoder(maxParts, utils.Reference8Bit), horizon, nil, maxRecipients, utils.InitClock())
 
 		type vStruct struct {
 			A string `validate:"textoriginator"`
@@ -142,7 +339,7 @@ func TestHumaniseValidationErrors(t *testing.T) {
 	})
 
 	t.Run("required error", func(t *testing.T) {
-		v := utils.InitValidator()
+		v := utils.InitValidator(utils.InitEncoder(maxParts, utils.Reference8Bit), horizon, nil, maxRecipients, utils.InitClock())
 
 		type vStruct struct {
 			A string `validate:"required"`
@@ -156,7 +353,7 @@ func TestHumaniseValidationErrors(t *testing.T) {
 	})
 
 	t.Run("required error", func(t *testing.T) {
-		v := utils.InitValidator()
+		v := utils.InitValidator(utils.InitEncoder(maxParts, utils.Reference8Bit), horizon, nil, maxRecipients, utils.InitClock())
 
 		type vStruct struct {
 			A string `validate:"required"`
@@ -170,7 +367,7 @@ func TestHumaniseValidationErrors(t *testing.T) {
 	})
 
 	t.Run("textoriginator|msisdn error", func(t *testing.T) {
-		v := utils.InitValidator()
+		v := utils.InitValidator(utils.InitEncoder(maxParts, utils.Reference8Bit), horizon, nil, maxRecipients, utils.InitClock())
 
 		type vStruct struct {
 			A string `validate:"textoriginator|msisdn"`
@@ -184,7 +381,7 @@ func TestHumaniseValidationErrors(t *testing.T) {
 	})
 
 	t.Run("max error", func(t *testing.T) {
-		v := utils.InitValidator()
+		v := utils.InitValidator(utils.InitEncoder(maxParts, utils.Reference8Bit), horizon, nil, maxRecipients, utils.InitClock())
 
 		type vStruct struct {
 			A string `validate:"textoriginator|msisdn"`